@@ -0,0 +1,166 @@
+package btree
+
+import (
+	"bytes"
+	"fmt"
+	"simple-db/naive"
+)
+
+// turns keys or values into bytes and back
+type Codec[T any] struct {
+	Encode func(T) []byte
+	Decode func([]byte) (T, error)
+}
+
+// pages of the database file the tree is written to
+type PageStore interface {
+	Allocate() naive.PageID
+	Write(id naive.PageID, page []byte)
+	Read(id naive.PageID) ([]byte, error)
+}
+
+// writes nodes to pages, children before their parent. Returns page of the root,
+// the tree is read back from it
+func (b *BTree[K, V]) WritePages(store PageStore, keys Codec[K], values Codec[V]) (naive.PageID, error) {
+	return b.writeNode(b.root, store, keys, values)
+}
+
+func (b *BTree[K, V]) writeNode(n *node[K, V], store PageStore, keys Codec[K], values Codec[V]) (naive.PageID, error) {
+	var children []naive.PageID
+	for _, c := range n.children {
+		id, err := b.writeNode(c, store, keys, values)
+		if err != nil {
+			return 0, err
+		}
+		children = append(children, id)
+	}
+
+	page, err := encodeNode(n, children, keys, values)
+	if err != nil {
+		return 0, err
+	}
+	id := store.Allocate()
+	store.Write(id, page)
+	return id, nil
+}
+
+// node is a naive generic page of btree type. Every entry is a cell with a tuple of key, value and
+// the child holding smaller keys, the rightmost child of interior node is kept as the next page
+func encodeNode[K, V any](n *node[K, V], children []naive.PageID, keys Codec[K], values Codec[V]) ([]byte, error) {
+	typ := naive.BTreeLeafPageType
+	if !n.isLeaf {
+		typ = naive.BTreeInteriorPageType
+	}
+
+	p := naive.NewPage(typ, naive.PageSize)
+	for i, e := range n.entries {
+		t := naive.Tuple{
+			NumberOfFields: 3,
+			ColumnTypes:    []naive.ColumnType{naive.BlobField, naive.BlobField, naive.NullField},
+			ColumnDatas:    [][]byte{naive.SerializeBytes(keys.Encode(e.key)), naive.SerializeBytes(values.Encode(e.value)), nil},
+		}
+		if !n.isLeaf {
+			t.ColumnTypes[2], t.ColumnDatas[2] = naive.IntField, naive.SerializeInt(int32(children[i]))
+		}
+		if err := p.AppendCell(t.Serialize()); err != nil {
+			return nil, fmt.Errorf("node with %d entries doesn't fit in a page: %w", len(n.entries), err)
+		}
+	}
+	if !n.isLeaf {
+		p.Header.NextPage = children[len(children)-1]
+	}
+	return p.Serialize(), nil
+}
+
+// reads tree written by WritePages, its nodes can't have more children than the given order
+func ReadPages[K, V any](root naive.PageID, store PageStore, numberOfChildren int, cmp func(a, b K) int, keys Codec[K], values Codec[V]) (*BTree[K, V], error) {
+	b := New[K, V](numberOfChildren, cmp)
+	n, err := b.readNode(root, store, keys, values)
+	if err != nil {
+		return nil, err
+	}
+	b.root = n
+	return b, nil
+}
+
+func (b *BTree[K, V]) readNode(id naive.PageID, store PageStore, keys Codec[K], values Codec[V]) (*node[K, V], error) {
+	data, err := store.Read(id)
+	if err != nil {
+		return nil, fmt.Errorf("reading node on page %d: %w", id, err)
+	}
+	r := bytes.NewReader(data)
+	header, err := naive.DeserializeGenericHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("node on page %d: %w", id, err)
+	} else if header.PageTyp != naive.BTreeLeafPageType && header.PageTyp != naive.BTreeInteriorPageType {
+		return nil, fmt.Errorf("page %d is not a btree node, got page type %d", id, header.PageTyp)
+	}
+	p, err := naive.DeserializeGenericPage(header, r)
+	if err != nil {
+		return nil, fmt.Errorf("node on page %d: %w", id, err)
+	}
+
+	n := &node[K, V]{isLeaf: header.PageTyp == naive.BTreeLeafPageType}
+	for cell := range p.Cells() {
+		t, err := naive.DeserializeTuple(cell)
+		if err != nil {
+			return nil, fmt.Errorf("entry of node on page %d: %w", id, err)
+		}
+		e, child, err := decodeEntry(*t, keys, values)
+		if err != nil {
+			return nil, fmt.Errorf("entry of node on page %d: %w", id, err)
+		}
+		n.entries = append(n.entries, e)
+		b.len++
+
+		if n.isLeaf {
+			continue
+		}
+		c, err := b.readNode(child, store, keys, values)
+		if err != nil {
+			return nil, err
+		}
+		n.children = append(n.children, c)
+	}
+	if len(n.entries) > b.maxEntries() {
+		return nil, fmt.Errorf("node on page %d has %d entries, order %d allows %d", id, len(n.entries), b.order, b.maxEntries())
+	}
+
+	if !n.isLeaf {
+		c, err := b.readNode(header.NextPage, store, keys, values)
+		if err != nil {
+			return nil, err
+		}
+		n.children = append(n.children, c)
+	}
+	return n, nil
+}
+
+func decodeEntry[K, V any](t naive.Tuple, keys Codec[K], values Codec[V]) (entry[K, V], naive.PageID, error) {
+	var e entry[K, V]
+	if t.NumberOfFields != 3 {
+		return e, 0, fmt.Errorf("expected 3 fields, got %d", t.NumberOfFields)
+	}
+
+	rawKey, err := naive.DeserializeBytes(t.ColumnDatas[0])
+	if err != nil {
+		return e, 0, fmt.Errorf("key: %w", err)
+	} else if e.key, err = keys.Decode(rawKey); err != nil {
+		return e, 0, fmt.Errorf("key: %w", err)
+	}
+	rawValue, err := naive.DeserializeBytes(t.ColumnDatas[1])
+	if err != nil {
+		return e, 0, fmt.Errorf("value: %w", err)
+	} else if e.value, err = values.Decode(rawValue); err != nil {
+		return e, 0, fmt.Errorf("value: %w", err)
+	}
+
+	if t.ColumnTypes[2] == naive.NullField {
+		return e, 0, nil
+	}
+	child, err := naive.ReadInt(bytes.NewReader(t.ColumnDatas[2]))
+	if err != nil {
+		return e, 0, fmt.Errorf("child: %w", err)
+	}
+	return e, naive.PageID(child), nil
+}
@@ -1,37 +1,67 @@
+// Package btree is an in-memory b-tree that can be written to naive pages and read back.
+// It's standalone, naive stores its tables and indexes in its own page-backed b+trees.
+// Nodes use their own page types, so they can't be mistaken for pages of naive indexes
 package btree
 
 import (
+	"cmp"
+	"fmt"
+	"iter"
 	"slices"
-	"strconv"
 	"strings"
 )
 
-// [K cmp.Ordered, V any]
-type node struct{
-	keys []int // todo: entry {key, val}
-	
-	isLeaf bool
-	children []*node
+type entry[K, V any] struct {
+	key   K
+	value V
 }
 
-type BTree struct{
+type node[K, V any] struct {
+	entries []entry[K, V]
+
+	isLeaf   bool
+	children []*node[K, V]
+}
+
+// b-tree keeping entries in every node, ordered by the comparator
+type BTree[K, V any] struct {
 	order int // number of children
-	root *node
+	cmp   func(a, b K) int
+	root  *node[K, V]
+	len   int
 }
 
-func NewBtree(numberOfChildren int) *BTree {
-	return &BTree {
+func New[K, V any](numberOfChildren int, cmp func(a, b K) int) *BTree[K, V] {
+	if numberOfChildren < 3 {
+		panic(fmt.Sprintf("btree order has to be at least 3, got %d", numberOfChildren))
+	}
+	return &BTree[K, V]{
 		order: numberOfChildren,
-		root: &node{
-			keys:      nil,
-			isLeaf:    true,
-			children:  nil,
-		},
+		cmp:   cmp,
+		root:  &node[K, V]{isLeaf: true},
 	}
 }
 
-func (b *BTree) full(n *node) bool {
-	return len(n.keys) >= b.order-1
+func NewOrdered[K cmp.Ordered, V any](numberOfChildren int) *BTree[K, V] {
+	return New[K, V](numberOfChildren, cmp.Compare[K])
+}
+
+func (b *BTree[K, V]) Len() int {
+	return b.len
+}
+
+func (b *BTree[K, V]) maxEntries() int {
+	return b.order - 1
+}
+
+// every node but root keeps at least half of its children
+func (b *BTree[K, V]) minEntries() int {
+	return (b.order+1)/2 - 1
+}
+
+// position of the first entry with key not smaller than given one
+func (b *BTree[K, V]) find(n *node[K, V], key K) (int, bool) {
+	return slices.BinarySearchFunc(n.entries, key, func(e entry[K, V], key K) int { return b.cmp(e.key, key) })
 }
 
 // https://iq.opengenus.org/b-tree-in-python/
@@ -39,88 +69,207 @@ func (b *BTree) full(n *node) bool {
 // https://algs4.cs.princeton.edu/code/edu/princeton/cs/algs4/BTree.java.html
 
 // https://www.youtube.com/watch?v=tT2DT9Z4H-0&list=PL9xmBV_5YoZNFPPv98DjTdD9X6UI9KMHz&index=5
-func (b *BTree) insert(key int) {
-	if b.full(b.root) {
-		oldRoot := b.root
-
-		b.root = &node{}
-		b.root.children = append(b.root.children, oldRoot)
-		b.split(b.root, 0)
-		b.insertNonFull(b.root, key)
+
+// inserts the value, or replaces it when the key is already present
+func (b *BTree[K, V]) Put(key K, value V) {
+	split, right := b.put(b.root, entry[K, V]{key, value})
+	if right == nil {
 		return
 	}
-	
-	b.insertNonFull(b.root, key)
+
+	// root overflowed, tree grows by one level
+	b.root = &node[K, V]{
+		entries:  []entry[K, V]{split},
+		children: []*node[K, V]{b.root, right},
+	}
 }
 
-func (b *BTree) insertNonFull(n *node, key int) {
+// returns median entry and new right node, when the node had to be split
+func (b *BTree[K, V]) put(n *node[K, V], e entry[K, V]) (entry[K, V], *node[K, V]) {
+	i, found := b.find(n, e.key)
+	if found {
+		n.entries[i].value = e.value
+		return entry[K, V]{}, nil
+	}
+
 	if n.isLeaf {
-		n.keys = append(n.keys, key)
-		slices.Sort(n.keys)
-		return
+		n.entries = slices.Insert(n.entries, i, e)
+		b.len++
+	} else {
+		split, right := b.put(n.children[i], e)
+		if right == nil {
+			return entry[K, V]{}, nil
+		}
+		n.entries = slices.Insert(n.entries, i, split)
+		n.children = slices.Insert(n.children, i+1, right)
 	}
 
-	i := 0
-	for i < len(n.keys) && key > n.keys[i] {
-		i++
+	if len(n.entries) <= b.maxEntries() {
+		return entry[K, V]{}, nil
 	}
-	if b.full(n) {
-		b.split(n, i)
-		if key > n.keys[i] {
-			i++
-		}
+	return b.split(n)
+}
+
+// median goes to the parent, entries after it to the new right node
+func (b *BTree[K, V]) split(n *node[K, V]) (entry[K, V], *node[K, V]) {
+	mid := len(n.entries) / 2
+	median := n.entries[mid]
+
+	right := &node[K, V]{isLeaf: n.isLeaf}
+	right.entries = slices.Clone(n.entries[mid+1:])
+	n.entries = slices.Clip(n.entries[:mid])
+	if !n.isLeaf {
+		right.children = slices.Clone(n.children[mid+1:])
+		n.children = slices.Clip(n.children[:mid+1])
 	}
-	b.insertNonFull(n.children[i], key)
+	return median, right
 }
 
-func (b *BTree) split(parent *node, fullChildIdx int) {
-	// todo: check ranges
-	fullChild := parent.children[fullChildIdx]
-	medianId := len(fullChild.keys)/2
+func (b *BTree[K, V]) Get(key K) (V, bool) {
+	n := b.root
+	for {
+		i, found := b.find(n, key)
+		if found {
+			return n.entries[i].value, true
+		} else if n.isLeaf {
+			var zero V
+			return zero, false
+		}
+		n = n.children[i]
+	}
+}
 
-	newNode := &node{ isLeaf: fullChild.isLeaf }
-	parent.children = slices.Insert(parent.children, fullChildIdx + 1, newNode)
+// removes the key. Nodes left with too few entries borrow one from a sibling,
+// or are merged with it when the sibling can't spare any
+func (b *BTree[K, V]) Delete(key K) bool {
+	found := b.delete(b.root, key)
+	if found {
+		b.len--
+	}
+	if len(b.root.entries) == 0 && !b.root.isLeaf {
+		b.root = b.root.children[0]
+	}
+	return found
+}
 
-	// insert median to parent
-	parent.keys = slices.Insert(parent.keys, fullChildIdx, fullChild.keys[medianId])
+func (b *BTree[K, V]) delete(n *node[K, V], key K) bool {
+	i, found := b.find(n, key)
+	if n.isLeaf {
+		if found {
+			n.entries = slices.Delete(n.entries, i, i+1)
+		}
+		return found
+	}
 
-	// not include median, because we've just moved it to the parent
-	newNode.keys = fullChild.keys[1+medianId:] 
-	fullChild.keys = fullChild.keys[:medianId]
+	if found {
+		// entry is replaced by its predecessor, the biggest one of the left subtree
+		n.entries[i] = b.deleteMax(n.children[i])
+	} else if !b.delete(n.children[i], key) {
+		return false
+	}
+	b.rebalance(n, i)
+	return true
+}
 
-	if !fullChild.isLeaf {
-		newNode.children = fullChild.children[1+len(fullChild.children)/2:]
-		fullChild.children = fullChild.children[:len(fullChild.children)/2]
+func (b *BTree[K, V]) deleteMax(n *node[K, V]) entry[K, V] {
+	if n.isLeaf {
+		last := n.entries[len(n.entries)-1]
+		n.entries = n.entries[:len(n.entries)-1]
+		return last
 	}
+
+	i := len(n.children) - 1
+	last := b.deleteMax(n.children[i])
+	b.rebalance(n, i)
+	return last
 }
 
-func (b *BTree) search(key int) (int, bool) {
-	var fn func(*node) (int, bool)
-	fn = func(n *node) (int, bool) {
-		i := 0
-		for i < len(n.keys) && key > n.keys[i] {
-			i++
+// fixes i-th child of the node after it lost an entry
+func (b *BTree[K, V]) rebalance(n *node[K, V], i int) {
+	child := n.children[i]
+	if len(child.entries) >= b.minEntries() {
+		return
+	}
+
+	if i > 0 && len(n.children[i-1].entries) > b.minEntries() {
+		// separator comes down to the child, biggest entry of the left sibling replaces it
+		left := n.children[i-1]
+		child.entries = slices.Insert(child.entries, 0, n.entries[i-1])
+		n.entries[i-1] = left.entries[len(left.entries)-1]
+		left.entries = left.entries[:len(left.entries)-1]
+		if !left.isLeaf {
+			child.children = slices.Insert(child.children, 0, left.children[len(left.children)-1])
+			left.children = left.children[:len(left.children)-1]
 		}
-		if i < len(n.keys) && key == n.keys[i] {
-			return n.keys[i], true
-		} else if n.isLeaf {
-			return 0, false
+	} else if i < len(n.children)-1 && len(n.children[i+1].entries) > b.minEntries() {
+		right := n.children[i+1]
+		child.entries = append(child.entries, n.entries[i])
+		n.entries[i] = right.entries[0]
+		right.entries = slices.Delete(right.entries, 0, 1)
+		if !right.isLeaf {
+			child.children = append(child.children, right.children[0])
+			right.children = slices.Delete(right.children, 0, 1)
 		}
-		return fn(b.root.children[i])
+	} else if i > 0 {
+		b.merge(n, i-1)
+	} else {
+		b.merge(n, i)
+	}
+}
+
+// i-th child of the node takes the separator and all entries of the next child
+func (b *BTree[K, V]) merge(n *node[K, V], i int) {
+	left, right := n.children[i], n.children[i+1]
+	left.entries = append(append(left.entries, n.entries[i]), right.entries...)
+	left.children = append(left.children, right.children...)
+
+	n.entries = slices.Delete(n.entries, i, i+1)
+	n.children = slices.Delete(n.children, i+1, i+2)
+}
+
+// entries with keys in [from, to), in key order
+func (b *BTree[K, V]) Ascend(from, to K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		b.ascend(b.root, &from, &to, yield)
 	}
-	
-	return fn(b.root)
 }
 
-func (b *BTree) delete(key int) bool {
-	panic("todo")
+// all entries in key order
+func (b *BTree[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		b.ascend(b.root, nil, nil, yield)
+	}
 }
 
-func (b *BTree) String() string {
+// nil bounds are open, returns false when iteration should stop
+func (b *BTree[K, V]) ascend(n *node[K, V], from, to *K, yield func(K, V) bool) bool {
+	i := 0
+	if from != nil {
+		i, _ = b.find(n, *from)
+	}
+
+	for ; i <= len(n.entries); i++ {
+		if !n.isLeaf && !b.ascend(n.children[i], from, to, yield) {
+			return false
+		} else if i == len(n.entries) {
+			return true
+		}
+
+		e := n.entries[i]
+		if to != nil && b.cmp(e.key, *to) >= 0 {
+			return false
+		} else if !yield(e.key, e.value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *BTree[K, V]) String() string {
 	out := strings.Builder{}
-	
-	var fn func(*node,int)
-	fn = func(n *node, depth int) {
+
+	var fn func(*node[K, V], int)
+	fn = func(n *node[K, V], depth int) {
 		writeLine := func(s string) {
 			// ignore length, always nil err
 			if out.Len() != 0 {
@@ -137,15 +286,15 @@ func (b *BTree) String() string {
 			return
 		}
 
-		keys := make([]string, 0, len(n.keys))
-		for _, k := range n.keys {
-			keys = append(keys, strconv.Itoa(k))
+		keys := make([]string, 0, len(n.entries))
+		for _, e := range n.entries {
+			keys = append(keys, fmt.Sprint(e.key))
 		}
 
 		if len(keys) != 0 {
 			s := "[" + strings.Join(keys, ",") + "]"
 			if n.isLeaf {
-				writeLine("L:" +s)
+				writeLine("L:" + s)
 			} else {
 				writeLine(s)
 			}
@@ -155,7 +304,7 @@ func (b *BTree) String() string {
 			fn(child, depth+1)
 		}
 	}
-	
+
 	fn(b.root, 0)
 	return out.String()
 }
@@ -1,29 +1,36 @@
 package btree
 
 import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"simple-db/naive"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestDebugTree(t *testing.T) {
-	t.Skip("todo")
+	bt := NewOrdered[int, struct{}](3)
 
-	// todo: remove when legit inserting works
-	bt := NewBtree(3)
-
-	bt.root = &node{[]int{5}, false, []*node{
-		{
-			[]int{3}, false, []*node{
-				{[]int{1,2}, true, nil}, {[]int{4}, true, nil},
-			},
-		},
-		{
-			[]int{7,11}, false, []*node{
-				{[]int{6}, true, nil}, {[]int{9}, true, nil}, {[]int{14, 18}, true, nil},
-			},
-		},
-	}}
+	leaf := func(keys ...int) *node[int, struct{}] {
+		n := &node[int, struct{}]{isLeaf: true}
+		for _, k := range keys {
+			n.entries = append(n.entries, entry[int, struct{}]{key: k})
+		}
+		return n
+	}
+	interior := func(keys []int, children ...*node[int, struct{}]) *node[int, struct{}] {
+		n := leaf(keys...)
+		n.isLeaf, n.children = false, children
+		return n
+	}
+	bt.root = interior([]int{5},
+		interior([]int{3}, leaf(1, 2), leaf(4)),
+		interior([]int{7, 11}, leaf(6), leaf(9), leaf(14, 18)),
+	)
 
 	expected := `[5]
 	[3]
@@ -37,29 +44,27 @@ func TestDebugTree(t *testing.T) {
 }
 
 func TestInserting(t *testing.T) {
-	t.Skip("todo")
-
 	tdt := []struct {
-		name string
-		input []int
+		name     string
+		input    []int
 		expected string
-	} {
+	}{
 		{
-			"simple 1", 
-			[]int{3,5,8,1,2,6,9,4,7,11,10},
-`[8]
-	[3 5]
-		L:[1,2]
-		L:[4]
+			"simple 1",
+			[]int{3, 5, 8, 1, 2, 6, 9, 4, 7, 11, 10},
+			`[5]
+	[2]
+		L:[1]
+		L:[3,4]
+	[8,10]
 		L:[6,7]
-	[11]
-		L:[9,10]
-		L:[12]`,
+		L:[9]
+		L:[11]`,
 		},
 		{
 			"simple 2",
 			[]int{3, 5, 1, 2, 6, 4, 7, 18, 9, 11, 14},
-`[5]
+			`[5]
 	[3]
 		L:[1,2]
 		L:[4]
@@ -70,13 +75,20 @@ func TestInserting(t *testing.T) {
 		},
 		{
 			"single entries",
-			[]int{3,1},
+			[]int{3, 1},
 			`L:[1,3]`,
 		},
 		{
 			"single split",
-			[]int{3,5,1},
-`[3]
+			[]int{3, 5, 1},
+			`[3]
+	L:[1]
+	L:[5]`,
+		},
+		{
+			"repeated keys",
+			[]int{3, 5, 3, 5, 1},
+			`[3]
 	L:[1]
 	L:[5]`,
 		},
@@ -84,12 +96,301 @@ func TestInserting(t *testing.T) {
 
 	for _, tc := range tdt {
 		t.Run(tc.name, func(t *testing.T) {
-			bt := NewBtree(3)
+			bt := NewOrdered[int, struct{}](3)
 			for _, v := range tc.input {
-				bt.insert(v)
+				bt.Put(v, struct{}{})
 			}
-			
+
 			assert.Equal(t, tc.expected, bt.String())
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestDeleting(t *testing.T) {
+	input := []int{3, 5, 1, 2, 6, 4, 7, 18, 9, 11, 14}
+	tdt := []struct {
+		name     string
+		deleted  []int
+		expected string
+	}{
+		{
+			"from leaf",
+			[]int{14},
+			`[5]
+	[3]
+		L:[1,2]
+		L:[4]
+	[7,11]
+		L:[6]
+		L:[9]
+		L:[18]`,
+		},
+		{
+			"borrow from left sibling",
+			[]int{4},
+			`[5]
+	[2]
+		L:[1]
+		L:[3]
+	[7,11]
+		L:[6]
+		L:[9]
+		L:[14,18]`,
+		},
+		{
+			"borrow from right sibling",
+			[]int{9},
+			`[5]
+	[3]
+		L:[1,2]
+		L:[4]
+	[7,14]
+		L:[6]
+		L:[11]
+		L:[18]`,
+		},
+		{
+			"from interior node",
+			[]int{11},
+			`[5]
+	[3]
+		L:[1,2]
+		L:[4]
+	[7,14]
+		L:[6]
+		L:[9]
+		L:[18]`,
+		},
+		{
+			"merge then borrow in interior node",
+			[]int{1, 2, 4},
+			`[7]
+	[5]
+		L:[3]
+		L:[6]
+	[11]
+		L:[9]
+		L:[14,18]`,
+		},
+		{
+			"merge shrinks the tree",
+			[]int{18, 14, 11, 9},
+			`[3,5]
+	L:[1,2]
+	L:[4]
+	L:[6,7]`,
+		},
+		{
+			"missing key",
+			[]int{8},
+			`[5]
+	[3]
+		L:[1,2]
+		L:[4]
+	[7,11]
+		L:[6]
+		L:[9]
+		L:[14,18]`,
+		},
+		{
+			"everything",
+			input,
+			``,
+		},
+	}
+
+	for _, tc := range tdt {
+		t.Run(tc.name, func(t *testing.T) {
+			bt := NewOrdered[int, struct{}](3)
+			for _, v := range input {
+				bt.Put(v, struct{}{})
+			}
+			for _, v := range tc.deleted {
+				assert.Equal(t, slices.Contains(input, v), bt.Delete(v))
+			}
+
+			assert.Equal(t, tc.expected, bt.String())
+		})
+	}
+}
+
+func TestRandomOperations(t *testing.T) {
+	for _, order := range []int{3, 4, 5, 16} {
+		t.Run(fmt.Sprintf("order %d", order), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(int64(order)))
+			bt := NewOrdered[int, string](order)
+			expected := map[int]string{}
+
+			for i := range 3000 {
+				k := rnd.Intn(500)
+				if rnd.Intn(3) == 0 {
+					_, present := expected[k]
+					assert.Equal(t, present, bt.Delete(k))
+					delete(expected, k)
+				} else {
+					bt.Put(k, fmt.Sprint(i))
+					expected[k] = fmt.Sprint(i)
+				}
+			}
+
+			assert.Equal(t, len(expected), bt.Len())
+			assertBalanced(t, bt)
+			for k := range 500 {
+				v, ok := bt.Get(k)
+				assert.Equal(t, expected[k], v)
+				_, present := expected[k]
+				assert.Equal(t, present, ok)
+			}
+
+			var keys []int
+			for k, v := range bt.All() {
+				assert.Equal(t, expected[k], v)
+				keys = append(keys, k)
+			}
+			assert.True(t, slices.IsSorted(keys))
+			assert.Len(t, keys, len(expected))
+		})
+	}
+}
+
+// every leaf on the same depth, every node but root at least half full
+func assertBalanced[K, V any](t *testing.T, bt *BTree[K, V]) {
+	t.Helper()
+	leafDepth := -1
+	var walk func(n *node[K, V], depth int)
+	walk = func(n *node[K, V], depth int) {
+		if n != bt.root {
+			assert.GreaterOrEqual(t, len(n.entries), bt.minEntries())
+		}
+		assert.LessOrEqual(t, len(n.entries), bt.maxEntries())
+		if n.isLeaf {
+			if leafDepth == -1 {
+				leafDepth = depth
+			}
+			assert.Equal(t, leafDepth, depth, "leaves on different depth")
+			return
+		}
+		assert.Len(t, n.children, len(n.entries)+1)
+		for _, c := range n.children {
+			walk(c, depth+1)
+		}
+	}
+	walk(bt.root, 0)
+}
+
+func TestAscend(t *testing.T) {
+	bt := NewOrdered[int, int](4)
+	for i := range 100 {
+		bt.Put(i*2, i)
+	}
+
+	collect := func(from, to int) []int {
+		var out []int
+		for k, v := range bt.Ascend(from, to) {
+			assert.Equal(t, k/2, v)
+			out = append(out, k)
+		}
+		return out
+	}
+	assert.Equal(t, []int{10, 12, 14}, collect(10, 16))
+	assert.Equal(t, []int{12, 14, 16}, collect(11, 17))
+	assert.Equal(t, []int{0, 2}, collect(-5, 3))
+	assert.Equal(t, []int{196, 198}, collect(195, 1000))
+	assert.Nil(t, collect(20, 20))
+	assert.Nil(t, collect(300, 400))
+
+	var firstThree []int
+	for k := range bt.Ascend(50, 100) {
+		if len(firstThree) == 3 {
+			break
+		}
+		firstThree = append(firstThree, k)
+	}
+	assert.Equal(t, []int{50, 52, 54}, firstThree)
+
+	// comparator decides the order
+	desc := New[string, int](3, func(a, b string) int { return strings.Compare(b, a) })
+	for i, s := range []string{"b", "d", "a", "c"} {
+		desc.Put(s, i)
+	}
+	var keys []string
+	for k := range desc.Ascend("d", "a") {
+		keys = append(keys, k)
+	}
+	assert.Equal(t, []string{"d", "c", "b"}, keys)
+}
+
+type memoryPages struct {
+	pages map[naive.PageID][]byte
+}
+
+func (m *memoryPages) Allocate() naive.PageID {
+	return naive.PageID(len(m.pages) + 1)
+}
+
+func (m *memoryPages) Write(id naive.PageID, page []byte) {
+	m.pages[id] = page
+}
+
+func (m *memoryPages) Read(id naive.PageID) ([]byte, error) {
+	p, ok := m.pages[id]
+	if !ok {
+		return nil, fmt.Errorf("page %d not found", id)
+	}
+	return p, nil
+}
+
+func TestPages(t *testing.T) {
+	intCodec := Codec[int]{
+		Encode: func(i int) []byte { return binary.BigEndian.AppendUint64(nil, uint64(i)) },
+		Decode: func(b []byte) (int, error) {
+			if len(b) != 8 {
+				return 0, fmt.Errorf("expected 8 bytes, got %d", len(b))
+			}
+			return int(binary.BigEndian.Uint64(b)), nil
+		},
+	}
+	stringCodec := Codec[string]{
+		Encode: func(s string) []byte { return []byte(s) },
+		Decode: func(b []byte) (string, error) { return string(b), nil },
+	}
+
+	bt := NewOrdered[int, string](32)
+	for i := range 1000 {
+		bt.Put(i, strings.Repeat("v", i%50))
+	}
+	for i := 0; i < 1000; i += 3 {
+		bt.Delete(i)
+	}
+
+	store := &memoryPages{map[naive.PageID][]byte{}}
+	root, err := bt.WritePages(store, intCodec, stringCodec)
+	assert.NoError(t, err)
+	for id, p := range store.pages {
+		assert.Len(t, p, naive.PageSize, "page %d", id)
+	}
+
+	got, err := ReadPages(root, store, 32, func(a, b int) int { return a - b }, intCodec, stringCodec)
+	assert.NoError(t, err)
+	assert.Equal(t, bt.String(), got.String())
+	assert.Equal(t, bt.Len(), got.Len())
+	v, ok := got.Get(10)
+	assert.True(t, ok)
+	assert.Equal(t, strings.Repeat("v", 10), v)
+	got.Put(3, "x")
+	assertBalanced(t, got)
+
+	_, err = ReadPages(root, store, 8, func(a, b int) int { return a - b }, intCodec, stringCodec)
+	assert.Error(t, err, "nodes have more entries than order allows")
+
+	store.pages[root] = naive.NewPage(naive.IndexLeafPageType, naive.PageSize).Serialize()
+	_, err = ReadPages(root, store, 32, func(a, b int) int { return a - b }, intCodec, stringCodec)
+	assert.Error(t, err, "pages of naive indexes are not btree nodes")
+
+	huge := NewOrdered[int, string](8)
+	for i := range 7 {
+		huge.Put(i, strings.Repeat("x", 1000))
+	}
+	_, err = huge.WritePages(store, intCodec, stringCodec)
+	assert.Error(t, err, "node doesn't fit in a page")
+}
@@ -14,10 +14,26 @@ func main() {
 	fmt.Println("'dump_db <filename>' to dump current db to <filename>")
 	fmt.Println("'load_db <filename>' to load <filename> to db")
 	fmt.Println("'schema' - to print tables and schema")
-	fmt.Println("'load_sql <filename>' - execute sql file, statements separated by newlines")
+	fmt.Println("'load_sql <filename>' - execute sql file, statements separated by newlines, in a single transaction")
 	fmt.Println("or type some sql statement to execute")
 
+	// database file is optional, without it everything is kept in memory
 	storage := naive.NewDatabase()
+	if len(os.Args) > 1 {
+		db, err := naive.Open(os.Args[1])
+		if err != nil {
+			fmt.Println("failed to open database:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("using database file %q\n", os.Args[1])
+		storage = db
+	}
+	defer func() {
+		if err := storage.Close(); err != nil {
+			fmt.Println("failed to close database:", err)
+		}
+	}()
+
 	scanner := bufio.NewScanner(os.Stdin)
 
 	for scanner.Scan() {
@@ -39,7 +55,7 @@ func main() {
 			if err := loadFile(storage, fileName); err != nil {
 				fmt.Printf("failed to load file: %q. Current db is not changed\n", fileName)
 			} else {
-				fmt.Printf("db refreshed from %q\n", fileName)
+				fmt.Printf("db refreshed from %q, changes are kept in memory\n", fileName)
 			}
 		} else if ok, _ := hasPrefixAndTrim(s, "schema"); ok {
 			schema := storage.Schema()
@@ -52,6 +68,9 @@ func main() {
 				fmt.Println(tableName + ":")
 				q := schemaToQuery(tableSchema)
 				fmt.Println(fmtQueryRes(q))
+				for _, idx := range tableSchema.Indexes {
+					fmt.Println(fmtIndex(idx))
+				}
 				fmt.Println()
 			}
 		} else if ok, fileName := hasPrefixAndTrim(s, "load_sql "); ok {
@@ -79,8 +98,12 @@ func handleSql(storage *naive.Database, s string) error {
 	}
 
 	switch got := got.(type) {
+	case nil:
+		// statement without result, like create or insert
 	case naive.QueryResult:
 		fmt.Println(fmtQueryRes(got))
+	case int:
+		fmt.Printf("%d rows affected\n", got)
 	default:
 		return fmt.Errorf("invalid statement for sql: %q: %T", s, got)
 	}
@@ -136,13 +159,24 @@ func executeCommandsFromFile(s *naive.Database, fileName string) error {
 	if err != nil {
 		return fmt.Errorf("error reading the file %v: %w", fileName, err)
 	}
+	// file is applied as a whole or not at all
+	tx, err := s.Begin()
+	if err != nil {
+		return err
+	}
 	data := strings.Replace(string(f), "\r", "", -1)
 	for _, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
 		if err := handleSql(s, line); err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				return fmt.Errorf("%w, rollback failed: %w", err, rollbackErr)
+			}
 			return err
 		}
 	}
-	return nil
+	return tx.Commit()
 }
 
 func loadFile(s *naive.Database, fileName string) error {
@@ -156,19 +190,42 @@ func loadFile(s *naive.Database, fileName string) error {
 		return fmt.Errorf("error deserializing the file %q: %w", fileName, err)
 	}
 
+	// database file of the current db is closed, loaded one lives in memory
+	if err := s.Close(); err != nil {
+		return fmt.Errorf("error closing current db: %w", err)
+	}
 	*s = *newDb
 	return nil
 }
 
 func schemaToQuery(sch naive.TableSchema) naive.QueryResult {
+	references := map[naive.FieldName]string{}
+	for _, fk := range sch.ForeignKeys {
+		col := naive.FieldName(fk.Column)
+		fk.Column = ""
+		references[col] = fk.String()
+	}
+
 	columns := [][]string{}
 	for i := 0; i < len(sch.FieldNames); i++ {
 		fieldName := sch.FieldNames[i]
 		fieldType := sch.FieldsTypes[i]
-		columns = append(columns, []string{string(fieldName), fieldType.String()})
+		columns = append(columns, []string{string(fieldName), fieldType.String(), references[fieldName]})
 	}
 	return naive.QueryResult{
-		Header: []naive.FieldName{"column name", "column type"},
+		Header: []naive.FieldName{"column name", "column type", "references"},
 		Values: columns,
 	}
 }
+
+func fmtIndex(idx naive.IndexSchema) string {
+	cols := make([]string, 0, len(idx.Columns))
+	for _, c := range idx.Columns {
+		cols = append(cols, string(c))
+	}
+	kind := "index"
+	if idx.Unique {
+		kind = "unique index"
+	}
+	return fmt.Sprintf("%v %v(%v)", kind, idx.Name, strings.Join(cols, ", "))
+}
@@ -1,10 +1,19 @@
 package naive
 
 import (
+	"bytes"
 	"cmp"
+	"container/heap"
+	"encoding/hex"
+	"fmt"
 	"iter"
+	"maps"
+	"math"
 	"simple-db/sql"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type RowIter iter.Seq[Row]
@@ -38,54 +47,806 @@ func Project(rows RowIter, fields []FieldName) RowIter {
 	}
 }
 
+// skips offset rows and stops pulling from the input once limit rows are produced
+func Limit(rows RowIter, limit, offset int) RowIter {
+	return func(yield func(Row) bool) {
+		if limit <= 0 {
+			return
+		}
+
+		skipped, produced := 0, 0
+		for r := range rows {
+			if skipped < offset {
+				skipped++
+				continue
+			} else if !yield(r) {
+				return
+			}
+
+			produced++
+			if produced == limit {
+				return
+			}
+		}
+	}
+}
+
+func Concat(rows RowIter, rows2 RowIter) RowIter {
+	return func(yield func(Row) bool) {
+		for r := range rows {
+			if !yield(r) {
+				return
+			}
+		}
+		for r := range rows2 {
+			if !yield(r) {
+				return
+			}
+		}
+	}
+}
+
+// renames columns from to columns to, other columns are dropped
+func Rename(rows RowIter, from, to []FieldName) RowIter {
+	return func(yield func(Row) bool) {
+		for r := range rows {
+			out := Row{}
+			for i, f := range from {
+				out[to[i]] = r[f]
+			}
+			if !yield(out) {
+				return
+			}
+		}
+	}
+}
+
+// yields first occurrence of each combination of values in fields
+func Distinct(rows RowIter, fields []FieldName) RowIter {
+	return func(yield func(Row) bool) {
+		seen := map[string]bool{}
+		for r := range rows {
+			k := rowKey(r, fields)
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			if !yield(r) {
+				return
+			}
+		}
+	}
+}
+
+// distinct rows present in both inputs, second one is kept in memory
+func Intersect(rows RowIter, rows2 RowIter, fields []FieldName) RowIter {
+	return func(yield func(Row) bool) {
+		other := keySet(rows2, fields)
+		for r := range Distinct(rows, fields) {
+			if other[rowKey(r, fields)] && !yield(r) {
+				return
+			}
+		}
+	}
+}
+
+// distinct rows of the first input, not present in the second one
+func Except(rows RowIter, rows2 RowIter, fields []FieldName) RowIter {
+	return func(yield func(Row) bool) {
+		other := keySet(rows2, fields)
+		for r := range Distinct(rows, fields) {
+			if !other[rowKey(r, fields)] && !yield(r) {
+				return
+			}
+		}
+	}
+}
+
+func keySet(rows RowIter, fields []FieldName) map[string]bool {
+	out := map[string]bool{}
+	for r := range rows {
+		out[rowKey(r, fields)] = true
+	}
+	return out
+}
+
+func rowKey(r Row, fields []FieldName) string {
+	vals := make([]ColumnData, 0, len(fields))
+	for _, f := range fields {
+		vals = append(vals, r[f])
+	}
+	return groupKey(vals)
+}
+
 func Product(rows RowIter, rows2 RowIter) RowIter {
 	return func(yield func(Row) bool) {
 		for r1 := range rows {
 			for r2 := range rows2 {
-				newData := Row{}
-				for k, v := range r1 {
-					newData[k] = v
+				if !yield(mergeRows(r1, r2)) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func Join(rows RowIter, rows2 RowIter, predicate func(Row) bool) RowIter {
+	return Select(Product(rows, rows2), predicate)
+}
+
+// left outer join, rows without a match are combined with nullRow
+func LeftJoin(rows RowIter, rows2 RowIter, predicate func(Row) bool, nullRow Row) RowIter {
+	return func(yield func(Row) bool) {
+		for r1 := range rows {
+			matched := false
+			for r2 := range rows2 {
+				merged := mergeRows(r1, r2)
+				if !predicate(merged) {
+					continue
+				}
+				matched = true
+				if !yield(merged) {
+					return
 				}
-				for k, v := range r2 {
-					newData[k] = v
+			}
+
+			if !matched && !yield(mergeRows(r1, nullRow)) {
+				return
+			}
+		}
+	}
+}
+
+// equi join, rows2 are put in a hash table by their keys and rows look up matching ones
+// in it. Keys that are not ok (null) never match. Matches are kept only when predicate holds,
+// rows without a match are combined with nullRow unless it's nil
+func HashJoin(rows RowIter, rows2 RowIter, key, key2 func(Row) (string, bool), predicate func(Row) bool, nullRow Row) RowIter {
+	return func(yield func(Row) bool) {
+		table := map[string][]Row{}
+		for r2 := range rows2 {
+			if k, ok := key2(r2); ok {
+				table[k] = append(table[k], r2)
+			}
+		}
+
+		for r1 := range rows {
+			matched := false
+			if k, ok := key(r1); ok {
+				for _, r2 := range table[k] {
+					merged := mergeRows(r1, r2)
+					if !predicate(merged) {
+						continue
+					}
+					matched = true
+					if !yield(merged) {
+						return
+					}
 				}
+			}
+
+			if !matched && nullRow != nil && !yield(mergeRows(r1, nullRow)) {
+				return
+			}
+		}
+	}
+}
+
+func mergeRows(r1, r2 Row) Row {
+	newData := make(Row, len(r1)+len(r2))
+	for k, v := range r1 {
+		newData[k] = v
+	}
+	for k, v := range r2 {
+		newData[k] = v
+	}
+	return newData
+}
+
+// state of a single aggregate function for one group
+type Accumulator interface {
+	Add(v ColumnData)
+	Result() ColumnData
+}
+
+type Aggregation struct {
+	Name FieldName // column of the output row with the result
+	Arg  func(Row) ColumnData
+	New  func() Accumulator
+}
 
-				if !yield(newData) {
+// hash aggregation. Rows are grouped by values of keys, output row of a group has
+// columns of its first row and results of all aggregations.
+// Without keys everything is a single group, also when there are no rows at all
+func HashAggregate(rows RowIter, keys []func(Row) ColumnData, aggs []Aggregation) RowIter {
+	type group struct {
+		first Row
+		accs  []Accumulator
+	}
+	newGroup := func(first Row) *group {
+		g := &group{first: first}
+		for _, a := range aggs {
+			g.accs = append(g.accs, a.New())
+		}
+		return g
+	}
+
+	return func(yield func(Row) bool) {
+		groups := map[string]*group{}
+		var order []*group
+
+		for r := range rows {
+			vals := make([]ColumnData, 0, len(keys))
+			for _, key := range keys {
+				vals = append(vals, key(r))
+			}
+			k := groupKey(vals)
+
+			g, ok := groups[k]
+			if !ok {
+				g = newGroup(r)
+				groups[k] = g
+				order = append(order, g)
+			}
+			for i, a := range aggs {
+				g.accs[i].Add(a.Arg(r))
+			}
+		}
+
+		if len(keys) == 0 && len(order) == 0 {
+			order = append(order, newGroup(Row{}))
+		}
+
+		for _, g := range order {
+			out := maps.Clone(g.first)
+			for i, a := range aggs {
+				out[a.Name] = g.accs[i].Result()
+			}
+			if !yield(out) {
+				return
+			}
+		}
+	}
+}
+
+// hashable representation of values, nulls are equal to each other
+func groupKey(vals []ColumnData) string {
+	var b strings.Builder
+	for _, v := range vals {
+		fmt.Fprintf(&b, "%d:%#v,", v.Typ, v.Data)
+	}
+	return b.String()
+}
+
+// counts values that are not null
+type countAcc struct {
+	n int32
+}
+
+func (c *countAcc) Add(v ColumnData) {
+	if v.Typ != Null {
+		c.n++
+	}
+}
+func (c *countAcc) Result() ColumnData { return ColumnData{Int32, c.n} }
+
+// null when there were no values, float when any of the values was a float
+// and bigint when any of them was a bigint
+type sumAcc struct {
+	sum      int64
+	floatSum float64
+	seen     bool
+	isFloat  bool
+	isBigInt bool
+}
+
+func (s *sumAcc) Add(v ColumnData) {
+	switch v.Typ {
+	case Null:
+		return
+	case Int32:
+		s.add(int64(v.Data.(int32)))
+	case Int64:
+		s.add(v.Data.(int64))
+		s.isBigInt = true
+	case Float:
+		s.floatSum += v.Data.(float64)
+		s.isFloat = true
+	default:
+		raise("sum: unsupported type %v", v.Typ)
+	}
+	s.seen = true
+}
+func (s *sumAcc) Result() ColumnData {
+	if !s.seen {
+		return ColumnData{Null, nil}
+	} else if s.isFloat {
+		return ColumnData{Float, s.floatSum + float64(s.sum)}
+	} else if s.isBigInt {
+		return ColumnData{Int64, s.sum}
+	} else if s.sum > math.MaxInt32 || s.sum < math.MinInt32 {
+		raise("sum: integer overflow")
+	}
+	return ColumnData{Int32, int32(s.sum)}
+}
+
+func (s *sumAcc) add(i int64) {
+	sum, ok := addInt64(s.sum, i)
+	if !ok {
+		raise("sum: integer overflow")
+	}
+	s.sum = sum
+}
+
+type avgAcc struct {
+	sum float64
+	n   int
+}
+
+func (a *avgAcc) Add(v ColumnData) {
+	switch v.Typ {
+	case Null:
+		return
+	case Int32, Int64, Float:
+		f, _ := toFloat(v)
+		a.sum += f
+		a.n++
+	default:
+		raise("avg: unsupported type %v", v.Typ)
+	}
+}
+func (a *avgAcc) Result() ColumnData {
+	if a.n == 0 {
+		return ColumnData{Null, nil}
+	}
+	return ColumnData{Float, a.sum / float64(a.n)}
+}
+
+// keeps the value for which compareValues has the wanted sign, -1 for min and 1 for max
+type extremeAcc struct {
+	sign int
+	best ColumnData
+}
+
+func (e *extremeAcc) Add(v ColumnData) {
+	if v.Typ == Null {
+		return
+	} else if e.best.Typ == Null {
+		e.best = v
+	} else if v.Typ != e.best.Typ {
+		raise("can't compare %v with %v", v.Typ, e.best.Typ)
+	} else if compareValues(v, e.best)*e.sign > 0 {
+		e.best = v
+	}
+}
+func (e *extremeAcc) Result() ColumnData { return e.best }
+
+// temporary storage for operators that can't keep all rows in memory
+type RowSpiller interface {
+	// stores rows and returns iterator reading them back in the same order.
+	// Storage is given back by calling release
+	Spill(rows []Row) (spilled RowIter, release func())
+}
+
+// external merge sort. Input is sorted in chunks of about memoryBudget bytes,
+// each chunk is spilled as a sorted run and all runs are merged at the end
+func Sort(rows RowIter, compare func(a, b Row) int, memoryBudget int, spiller RowSpiller) RowIter {
+	return func(yield func(Row) bool) {
+		var runs []RowIter
+		var releases []func()
+		defer func() {
+			for _, release := range releases {
+				release()
+			}
+		}()
+
+		var buf []Row
+		bufSize := 0
+		for r := range rows {
+			buf = append(buf, r)
+			bufSize += approxRowSize(r)
+
+			if spiller != nil && bufSize > memoryBudget {
+				slices.SortStableFunc(buf, compare)
+				run, release := spiller.Spill(buf)
+				runs = append(runs, run)
+				releases = append(releases, release)
+				buf, bufSize = nil, 0
+			}
+		}
+
+		slices.SortStableFunc(buf, compare)
+		if len(runs) == 0 {
+			for _, r := range buf {
+				if !yield(r) {
 					return
 				}
 			}
+			return
 		}
+
+		// last run is still in memory, no need to spill it
+		runs = append(runs, RowIter(slices.Values(buf)))
+		mergeRuns(runs, compare, yield)
 	}
 }
 
-// todo: add error handling
+type runHead struct {
+	row Row
+	run int
+}
+
+type runHeap struct {
+	heads   []runHead
+	compare func(a, b Row) int
+}
+
+func (h *runHeap) Len() int { return len(h.heads) }
+func (h *runHeap) Less(i, j int) bool {
+	if c := h.compare(h.heads[i].row, h.heads[j].row); c != 0 {
+		return c < 0
+	}
+	// equal rows are taken in run order, so the sort stays stable
+	return h.heads[i].run < h.heads[j].run
+}
+func (h *runHeap) Swap(i, j int) { h.heads[i], h.heads[j] = h.heads[j], h.heads[i] }
+func (h *runHeap) Push(x any)    { h.heads = append(h.heads, x.(runHead)) }
+func (h *runHeap) Pop() any {
+	last := h.heads[len(h.heads)-1]
+	h.heads = h.heads[:len(h.heads)-1]
+	return last
+}
+
+// k-way merge of sorted runs
+func mergeRuns(runs []RowIter, compare func(a, b Row) int, yield func(Row) bool) {
+	nexts := make([]func() (Row, bool), 0, len(runs))
+	for _, run := range runs {
+		next, stop := iter.Pull(iter.Seq[Row](run))
+		defer stop()
+		nexts = append(nexts, next)
+	}
+
+	h := &runHeap{compare: compare}
+	for i, next := range nexts {
+		if r, ok := next(); ok {
+			h.heads = append(h.heads, runHead{r, i})
+		}
+	}
+	heap.Init(h)
+
+	for h.Len() > 0 {
+		head := h.heads[0]
+		if !yield(head.row) {
+			return
+		}
+
+		if r, ok := nexts[head.run](); ok {
+			h.heads[0] = runHead{r, head.run}
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+}
+
+// rough estimate of memory used by a row, to decide when to spill
+func approxRowSize(r Row) int {
+	size := 0
+	for k, v := range r {
+		size += len(k) + 16
+		switch d := v.Data.(type) {
+		case string:
+			size += len(d)
+		case []byte:
+			size += len(d)
+		}
+	}
+	return size
+}
+
+// orders values of the same type
+func compareValues(a, b ColumnData) int {
+	debugAssert(a.Typ == b.Typ, "can't compare different types %v %v", a.Typ, b.Typ)
+
+	switch a.Typ {
+	case Null:
+		return 0
+	case Int32:
+		return cmp.Compare(a.Data.(int32), b.Data.(int32))
+	case String:
+		return cmp.Compare(a.Data.(string), b.Data.(string))
+	case Float:
+		return cmp.Compare(a.Data.(float64), b.Data.(float64))
+	case Boolean:
+		return cmp.Compare(boolToInt(a.Data.(bool)), boolToInt(b.Data.(bool)))
+	case Int64:
+		return cmp.Compare(a.Data.(int64), b.Data.(int64))
+	case Blob:
+		return bytes.Compare(a.Data.([]byte), b.Data.([]byte))
+	case Date, Timestamp:
+		return a.Data.(time.Time).Compare(b.Data.(time.Time))
+	}
+
+	debugAssert(false, "unsupported type for comparison: %v", a.Typ)
+	return 0
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// rows for which the predicate is unknown (null) are filtered out, same as for false
 func buildPredicate(pred sql.Expression) func(Row) bool {
 	return func(r Row) bool {
 		col := predBuilder(pred, r)
-		debugAssert(col.Typ == Boolean, "boolean predicate required, got %v", col.Typ)
+		if col.Typ == Null {
+			return false
+		} else if col.Typ != Boolean {
+			raise("boolean predicate required, got %v", col.Typ)
+		}
 		return col.Data.(bool)
 	}
 }
 
-func castAndBinaryOp[T any](left, right any, op func(T, T) bool) bool {
-	lV := left.(T)
-	rV := right.(T)
-	return op(lV, rV)
+func isArithmetic(op string) bool {
+	switch op {
+	case "+", "-", "*", "/", "%":
+		return true
+	}
+	return false
 }
 
-func eq[T comparable](a, b T) bool   { return a == b }
-func neq[T comparable](a, b T) bool  { return a != b }
-func or(a, b bool) bool              { return a || b }
-func and(a, b bool) bool             { return a && b }
-func gt[T cmp.Ordered](a, b T) bool  { return a > b }
-func geq[T cmp.Ordered](a, b T) bool { return a >= b }
-func lt[T cmp.Ordered](a, b T) bool  { return a < b }
-func leq[T cmp.Ordered](a, b T) bool { return a <= b }
+// integer literal, bigint when it doesn't fit into int, or float when it has a decimal point
+func parseNumber(lexeme string) ColumnData {
+	if strings.Contains(lexeme, ".") {
+		f, err := strconv.ParseFloat(lexeme, 64)
+		if err != nil {
+			raise("invalid number %v: %w", lexeme, err)
+		}
+		return ColumnData{Float, f}
+	}
 
-func buildCastAndOperand[T any](left, right ColumnData, fn func(a, b T) bool) func() bool {
-	return func() bool {
-		return castAndBinaryOp(left.Data, right.Data, fn)
+	i, err := strconv.ParseInt(lexeme, 10, 64)
+	if err != nil {
+		raise("integer %v out of range", lexeme)
+	} else if i > math.MaxInt32 || i < math.MinInt32 {
+		return ColumnData{Int64, i}
 	}
+	return ColumnData{Int32, int32(i)}
+}
+
+func toFloat(c ColumnData) (float64, bool) {
+	switch c.Typ {
+	case Int32:
+		return float64(c.Data.(int32)), true
+	case Int64:
+		return float64(c.Data.(int64)), true
+	case Float:
+		return c.Data.(float64), true
+	}
+	return 0, false
+}
+
+// brings operands to a common type: int to bigint to float, date to timestamp,
+// and strings compared with dates are parsed as dates
+func promoteTypes(left, right ColumnData) (ColumnData, ColumnData) {
+	rank := map[FieldType]int{Int32: 1, Int64: 2, Float: 3, Date: 1, Timestamp: 2}
+	isTime := func(t FieldType) bool { return t == Date || t == Timestamp }
+
+	wider := left.Typ
+	switch {
+	case left.Typ == String && isTime(right.Typ):
+		wider = right.Typ
+	case right.Typ == String && isTime(left.Typ):
+		wider = left.Typ
+	case isTime(left.Typ) != isTime(right.Typ) || rank[left.Typ] == 0 || rank[right.Typ] == 0:
+		return left, right
+	case rank[right.Typ] > rank[left.Typ]:
+		wider = right.Typ
+	}
+
+	l, err := convertTo(left, wider)
+	if err != nil {
+		raise("%w", err)
+	}
+	r, err := convertTo(right, wider)
+	if err != nil {
+		raise("%w", err)
+	}
+	return l, r
+}
+
+// ints stay ints, unless mixed with bigints or floats. Null in any operand gives null
+func arithmetic(op string, left, right ColumnData) ColumnData {
+	if left.Typ == Null || right.Typ == Null {
+		return ColumnData{Null, nil}
+	}
+
+	if left.Typ == Int32 && right.Typ == Int32 {
+		a, b := int64(left.Data.(int32)), int64(right.Data.(int32))
+		res := intArithmetic(op, a, b)
+		if res > math.MaxInt32 || res < math.MinInt32 {
+			raise("integer overflow in %d %v %d", a, op, b)
+		}
+		return ColumnData{Int32, int32(res)}
+	}
+
+	left, right = promoteTypes(left, right)
+	if left.Typ == Int64 && right.Typ == Int64 {
+		return ColumnData{Int64, intArithmetic(op, left.Data.(int64), right.Data.(int64))}
+	}
+
+	a, okA := toFloat(left)
+	b, okB := toFloat(right)
+	if !okA || !okB {
+		raise("unsupported operand types for %v: %v and %v", op, left.Typ, right.Typ)
+	}
+	switch op {
+	case "+":
+		return ColumnData{Float, a + b}
+	case "-":
+		return ColumnData{Float, a - b}
+	case "*":
+		return ColumnData{Float, a * b}
+	}
+	if b == 0 {
+		raise("division by zero")
+	} else if op == "%" {
+		return ColumnData{Float, math.Mod(a, b)}
+	}
+	return ColumnData{Float, a / b}
+}
+
+// raises on overflow of int64
+func intArithmetic(op string, a, b int64) int64 {
+	var res int64
+	ok := true
+	switch op {
+	case "+":
+		res, ok = addInt64(a, b)
+	case "-":
+		res, ok = subInt64(a, b)
+	case "*":
+		res, ok = mulInt64(a, b)
+	case "/", "%":
+		if b == 0 {
+			raise("division by zero")
+		} else if a == math.MinInt64 && b == -1 {
+			ok = false
+		} else if op == "/" {
+			res = a / b
+		} else {
+			res = a % b
+		}
+	}
+	if !ok {
+		raise("integer overflow in %d %v %d", a, op, b)
+	}
+	return res
+}
+
+func addInt64(a, b int64) (int64, bool) {
+	res := a + b
+	return res, (res > a) == (b > 0)
+}
+
+func subInt64(a, b int64) (int64, bool) {
+	res := a - b
+	return res, (res < a) == (b > 0)
+}
+
+func mulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	res := a * b
+	return res, res/b == a && !(a == math.MinInt64 && b == -1)
+}
+
+func prefix(op string, v ColumnData) ColumnData {
+	if v.Typ == Null {
+		return v
+	}
+
+	switch {
+	case op == "-" && v.Typ == Int32:
+		if v.Data.(int32) == math.MinInt32 {
+			raise("integer overflow in -(%d)", v.Data)
+		}
+		return ColumnData{Int32, -v.Data.(int32)}
+	case op == "-" && v.Typ == Int64:
+		if v.Data.(int64) == math.MinInt64 {
+			raise("integer overflow in -(%d)", v.Data)
+		}
+		return ColumnData{Int64, -v.Data.(int64)}
+	case op == "-" && v.Typ == Float:
+		return ColumnData{Float, -v.Data.(float64)}
+	case op == "not" && v.Typ == Boolean:
+		return ColumnData{Boolean, !v.Data.(bool)}
+	}
+	raise("unsupported operand type for %v: %v", op, v.Typ)
+	return v
+}
+
+// value of expression that doesn't use any columns
+func evalConstant(expr sql.Expression) (_ ColumnData, err error) {
+	defer recoverEvalError(&err)
+	if usesColumns(expr) {
+		return ColumnData{}, fmt.Errorf("columns can't be used in %v", expr)
+	}
+	return predBuilder(expr, Row{}), nil
+}
+
+func usesColumns(expr sql.Expression) bool {
+	switch v := expr.(type) {
+	case *sql.InfixExpression:
+		return usesColumns(v.Left) || usesColumns(v.Right)
+	case *sql.PrefixExpression:
+		return usesColumns(v.Right)
+	case *sql.IsNullExpression:
+		return usesColumns(v.Expr)
+	case *sql.FunctionCall:
+		if _, ok := scalarFunctions[v.Name]; ok {
+			return slices.ContainsFunc(v.Args, usesColumns)
+		}
+		return true
+	case sql.ColumnLiteral:
+		return true
+	}
+	return false
+}
+
+// three valued and/or, null stands for unknown
+func logical(op string, left, right ColumnData) ColumnData {
+	for _, v := range []ColumnData{left, right} {
+		if v.Typ != Null && v.Typ != Boolean {
+			raise("%v expects boolean operands, got %v", op, v.Typ)
+		}
+	}
+
+	// false decides and, true decides or, whatever the other operand is
+	decisive := op == "or"
+	isDecisive := func(v ColumnData) bool { return v.Typ == Boolean && v.Data.(bool) == decisive }
+	if isDecisive(left) || isDecisive(right) {
+		return ColumnData{Boolean, decisive}
+	} else if left.Typ == Null || right.Typ == Null {
+		return ColumnData{Null, nil}
+	}
+	return ColumnData{Boolean, !decisive}
+}
+
+// functions evaluated for each row, as opposed to aggregates
+type scalarFunction struct {
+	minArgs, maxArgs int // maxArgs is -1 when there is no limit
+	// arguments are evaluated lazily, so functions can skip some of them
+	eval func(args []func() ColumnData) ColumnData
+}
+
+var scalarFunctions = map[string]scalarFunction{
+	"coalesce": {1, -1, coalesce},
+	"ifnull":   {2, 2, coalesce},
+}
+
+// first argument that is not null
+func coalesce(args []func() ColumnData) ColumnData {
+	for _, arg := range args {
+		if v := arg(); v.Typ != Null {
+			return v
+		}
+	}
+	return ColumnData{Null, nil}
+}
+
+// comparison operators, applied to the result of compareValues
+var comparisons = map[string]func(int) bool{
+	"=":  func(c int) bool { return c == 0 },
+	"!=": func(c int) bool { return c != 0 },
+	">":  func(c int) bool { return c > 0 },
+	">=": func(c int) bool { return c >= 0 },
+	"<":  func(c int) bool { return c < 0 },
+	"<=": func(c int) bool { return c <= 0 },
 }
 
 func predBuilder(pred sql.Expression, r Row) ColumnData {
@@ -94,47 +855,78 @@ func predBuilder(pred sql.Expression, r Row) ColumnData {
 		left := predBuilder(v.Left, r)
 		right := predBuilder(v.Right, r)
 
-		if v.Operator.Lexeme == "and" {
-			return ColumnData{Boolean, castAndBinaryOp(left.Data, right.Data, and)}
-		} else if v.Operator.Lexeme == "or" {
-			return ColumnData{Boolean, castAndBinaryOp(left.Data, right.Data, or)}
-		}
-
-		op := map[string]map[FieldType]func() bool{
-			"=": {
-				String:  buildCastAndOperand(left, right, eq[string]),
-				Int32:   buildCastAndOperand(left, right, eq[int32]),
-				Boolean: buildCastAndOperand(left, right, eq[bool]),
-			},
-			"!=": {
-				String:  buildCastAndOperand(left, right, neq[string]),
-				Int32:   buildCastAndOperand(left, right, neq[int32]),
-				Boolean: buildCastAndOperand(left, right, neq[bool]),
-			},
-			">":  {Int32: buildCastAndOperand(left, right, gt[int32])},
-			">=": {Int32: buildCastAndOperand(left, right, geq[int32])},
-			"<":  {Int32: buildCastAndOperand(left, right, lt[int32])},
-			"<=": {Int32: buildCastAndOperand(left, right, leq[int32])},
-		}
-
-		ops, ok := op[v.Operator.Lexeme]
-		debugAssert(ok, "unsupported op: %v", v.Operator)
-		debugAssert(left.Typ == right.Typ, "incompatible types %v %v", left.Typ, right.Typ)
+		if isArithmetic(v.Operator.Lexeme) {
+			return arithmetic(v.Operator.Lexeme, left, right)
+		} else if v.Operator.Lexeme == "and" || v.Operator.Lexeme == "or" {
+			return logical(v.Operator.Lexeme, left, right)
+		}
 
-		fn, ok := ops[left.Typ]
-		debugAssert(ok, "unknown type %v", left.Typ)
-		return ColumnData{Boolean, fn()}
+		fn, ok := comparisons[v.Operator.Lexeme]
+		debugAssert(ok, "unsupported op: %v", v.Operator)
+		// comparing with null gives unknown
+		if left.Typ == Null || right.Typ == Null {
+			return ColumnData{Null, nil}
+		}
+		left, right = promoteTypes(left, right)
+		if left.Typ != right.Typ {
+			raise("can't compare %v with %v", left.Typ, right.Typ)
+		}
+		return ColumnData{Boolean, fn(compareValues(left, right))}
+	case *sql.PrefixExpression:
+		return prefix(v.Operator.Lexeme, predBuilder(v.Right, r))
+	case *sql.IsNullExpression:
+		isNull := predBuilder(v.Expr, r).Typ == Null
+		return ColumnData{Boolean, isNull != v.Not}
 	case sql.ValueLiteral:
 		if v.Tok.Typ == sql.Number {
-			return ColumnData{Int32, int32(must(strconv.Atoi(v.Tok.Lexeme)))}
+			return parseNumber(v.Tok.Lexeme)
 		} else if v.Tok.Typ == sql.String {
 			return ColumnData{String, v.Tok.Lexeme}
 		} else if v.Tok.Typ == sql.Boolean {
 			return ColumnData{Boolean, must(strconv.ParseBool(v.Tok.Lexeme))}
+		} else if v.Tok.Typ == sql.Blob {
+			b, err := hex.DecodeString(v.Tok.Lexeme)
+			if err != nil {
+				raise("invalid blob literal %v: %w", v, err)
+			}
+			return ColumnData{Blob, b}
+		} else if v.Tok.Typ == sql.Date {
+			d, err := parseDate(v.Tok.Lexeme)
+			if err != nil {
+				raise("%w", err)
+			}
+			return ColumnData{Date, d}
+		} else if v.Tok.Typ == sql.Timestamp {
+			t, err := parseTimestamp(v.Tok.Lexeme)
+			if err != nil {
+				raise("%w", err)
+			}
+			return ColumnData{Timestamp, t}
 		}
 		debugAssert(false, "unsupported type %v", v)
+	case sql.NullLiteral:
+		return ColumnData{Null, nil}
+	case sql.ConstantLiteral:
+		return v.Value.(ColumnData)
 	case sql.ColumnLiteral:
 		return r[FieldName(v.Name.Lexeme)]
+	case *sql.FunctionCall:
+		if fn, ok := scalarFunctions[v.Name]; ok {
+			args := []func() ColumnData{}
+			for _, arg := range v.Args {
+				args = append(args, func() ColumnData { return predBuilder(arg, r) })
+			}
+			return fn.eval(args)
+		}
+
+		// aggregates are computed by HashAggregate and stored under their name
+		res, ok := r[FieldName(v.String())]
+		if err := validateCall(v); err != nil {
+			raise("%w", err)
+		} else if !ok {
+			raise("aggregate function %v can't be used here", v)
+		}
+		return res
 	}
 
 	debugAssert(false, "unknown predicate type received %T", pred)
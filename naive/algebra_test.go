@@ -1,7 +1,10 @@
 package naive
 
 import (
+	"cmp"
+	"fmt"
 	"iter"
+	"math"
 	"slices"
 	"testing"
 
@@ -215,4 +218,325 @@ func TestAlgebraCombined(t *testing.T) {
 		expected := []Row{{"foo": col(t,2)}}
 		assert.Equal(t, expected, slices.Collect(iter.Seq[Row](got)))
 	})
-}
\ No newline at end of file
+}
+func TestAlgebraJoin(t *testing.T) {
+	left := []Row{
+		{"id": col(t, 1), "name": col(t, "one")},
+		{"id": col(t, 2), "name": col(t, "two")},
+		{"id": col(t, 3), "name": col(t, "three")},
+	}
+	right := []Row{
+		{"parent": col(t, 1), "data": col(t, "a")},
+		{"parent": col(t, 1), "data": col(t, "b")},
+		{"parent": col(t, 3), "data": col(t, "c")},
+	}
+	sameParent := func(r Row) bool { return r["id"].Data == r["parent"].Data }
+
+	t.Run("inner join", func(t *testing.T) {
+		got := Join(RowIter(slices.Values(left)), RowIter(slices.Values(right)), sameParent)
+
+		assert.ElementsMatch(t, []Row{
+			{"id": col(t, 1), "name": col(t, "one"), "parent": col(t, 1), "data": col(t, "a")},
+			{"id": col(t, 1), "name": col(t, "one"), "parent": col(t, 1), "data": col(t, "b")},
+			{"id": col(t, 3), "name": col(t, "three"), "parent": col(t, 3), "data": col(t, "c")},
+		}, slices.Collect(iter.Seq[Row](got)))
+	})
+
+	t.Run("left join", func(t *testing.T) {
+		nulls := Row{"parent": {Null, nil}, "data": {Null, nil}}
+		got := LeftJoin(RowIter(slices.Values(left)), RowIter(slices.Values(right)), sameParent, nulls)
+
+		assert.ElementsMatch(t, []Row{
+			{"id": col(t, 1), "name": col(t, "one"), "parent": col(t, 1), "data": col(t, "a")},
+			{"id": col(t, 1), "name": col(t, "one"), "parent": col(t, 1), "data": col(t, "b")},
+			{"id": col(t, 2), "name": col(t, "two"), "parent": {Null, nil}, "data": {Null, nil}},
+			{"id": col(t, 3), "name": col(t, "three"), "parent": col(t, 3), "data": col(t, "c")},
+		}, slices.Collect(iter.Seq[Row](got)))
+	})
+
+	t.Run("left join with empty right side", func(t *testing.T) {
+		nulls := Row{"parent": {Null, nil}}
+		got := LeftJoin(RowIter(slices.Values(left[:1])), RowIter(slices.Values([]Row{})), sameParent, nulls)
+
+		assert.Equal(t, []Row{
+			{"id": col(t, 1), "name": col(t, "one"), "parent": {Null, nil}},
+		}, slices.Collect(iter.Seq[Row](got)))
+	})
+}
+
+type memSpiller struct {
+	spilled  int
+	released int
+}
+
+func (m *memSpiller) Spill(rows []Row) (RowIter, func()) {
+	m.spilled++
+	run := slices.Clone(rows)
+	return RowIter(slices.Values(run)), func() { m.released++ }
+}
+
+func TestAlgebraSort(t *testing.T) {
+	var rows []Row
+	for i := range 50 {
+		rows = append(rows, Row{"id": {Int32, int32((i * 7) % 50)}, "seq": {Int32, int32(i)}})
+	}
+	byId := func(a, b Row) int { return compareValues(a["id"], b["id"]) }
+
+	ids := func(got RowIter) []int32 {
+		var out []int32
+		for r := range got {
+			out = append(out, r["id"].Data.(int32))
+		}
+		return out
+	}
+	var exp []int32
+	for i := range 50 {
+		exp = append(exp, int32(i))
+	}
+
+	t.Run("in memory", func(t *testing.T) {
+		spiller := &memSpiller{}
+		got := Sort(RowIter(slices.Values(rows)), byId, 1<<20, spiller)
+
+		assert.Equal(t, exp, ids(got))
+		assert.Zero(t, spiller.spilled)
+	})
+
+	t.Run("merges spilled runs", func(t *testing.T) {
+		spiller := &memSpiller{}
+		got := Sort(RowIter(slices.Values(rows)), byId, 100, spiller)
+
+		assert.Equal(t, exp, ids(got))
+		assert.Greater(t, spiller.spilled, 1)
+		assert.Equal(t, spiller.spilled, spiller.released)
+	})
+
+	t.Run("stable across runs", func(t *testing.T) {
+		spiller := &memSpiller{}
+		byParity := func(a, b Row) int {
+			return cmp.Compare(a["id"].Data.(int32)%2, b["id"].Data.(int32)%2)
+		}
+		got := slices.Collect(iter.Seq[Row](Sort(RowIter(slices.Values(rows)), byParity, 100, spiller)))
+
+		assert.Len(t, got, len(rows))
+		assert.True(t, slices.IsSortedFunc(got, func(a, b Row) int {
+			if c := byParity(a, b); c != 0 {
+				return c
+			}
+			return compareValues(a["seq"], b["seq"])
+		}))
+	})
+
+	t.Run("early stop releases runs", func(t *testing.T) {
+		spiller := &memSpiller{}
+		for range Sort(RowIter(slices.Values(rows)), byId, 100, spiller) {
+			break
+		}
+		assert.Equal(t, spiller.spilled, spiller.released)
+	})
+}
+
+func TestAlgebraHashAggregate(t *testing.T) {
+	rows := []Row{
+		{"dept": col(t, "a"), "salary": {Int32, int32(10)}},
+		{"dept": col(t, "b"), "salary": {Int32, int32(5)}},
+		{"dept": col(t, "a"), "salary": {Null, nil}},
+		{"dept": col(t, "a"), "salary": {Int32, int32(20)}},
+		{"dept": {Null, nil}, "salary": {Int32, int32(1)}},
+	}
+	dept := func(r Row) ColumnData { return r["dept"] }
+	salary := func(r Row) ColumnData { return r["salary"] }
+	aggs := []Aggregation{
+		{Name: "count", Arg: salary, New: func() Accumulator { return &countAcc{} }},
+		{Name: "sum", Arg: salary, New: func() Accumulator { return &sumAcc{} }},
+		{Name: "avg", Arg: salary, New: func() Accumulator { return &avgAcc{} }},
+		{Name: "min", Arg: salary, New: func() Accumulator { return &extremeAcc{sign: -1} }},
+		{Name: "max", Arg: salary, New: func() Accumulator { return &extremeAcc{sign: 1} }},
+	}
+
+	t.Run("grouped", func(t *testing.T) {
+		got := HashAggregate(RowIter(slices.Values(rows)), []func(Row) ColumnData{dept}, aggs)
+
+		assert.Equal(t, []Row{
+			{"dept": col(t, "a"), "salary": {Int32, int32(10)}, "count": {Int32, int32(2)}, "sum": {Int32, int32(30)}, "avg": {Float, 15.0}, "min": {Int32, int32(10)}, "max": {Int32, int32(20)}},
+			{"dept": col(t, "b"), "salary": {Int32, int32(5)}, "count": {Int32, int32(1)}, "sum": {Int32, int32(5)}, "avg": {Float, 5.0}, "min": {Int32, int32(5)}, "max": {Int32, int32(5)}},
+			{"dept": {Null, nil}, "salary": {Int32, int32(1)}, "count": {Int32, int32(1)}, "sum": {Int32, int32(1)}, "avg": {Float, 1.0}, "min": {Int32, int32(1)}, "max": {Int32, int32(1)}},
+		}, slices.Collect(iter.Seq[Row](got)))
+	})
+
+	t.Run("empty input without keys", func(t *testing.T) {
+		got := HashAggregate(RowIter(slices.Values([]Row{})), nil, aggs)
+
+		assert.Equal(t, []Row{
+			{"count": {Int32, int32(0)}, "sum": {Null, nil}, "avg": {Null, nil}, "min": {Null, nil}, "max": {Null, nil}},
+		}, slices.Collect(iter.Seq[Row](got)))
+	})
+
+	t.Run("empty input with keys", func(t *testing.T) {
+		got := HashAggregate(RowIter(slices.Values([]Row{})), []func(Row) ColumnData{dept}, aggs)
+		assert.Empty(t, slices.Collect(iter.Seq[Row](got)))
+	})
+}
+
+func TestAlgebraLimit(t *testing.T) {
+	var rows []Row
+	for i := range 10 {
+		rows = append(rows, Row{"id": {Int32, int32(i)}})
+	}
+	ids := func(got RowIter) []int32 {
+		out := []int32{}
+		for r := range got {
+			out = append(out, r["id"].Data.(int32))
+		}
+		return out
+	}
+
+	testCases := []struct {
+		desc          string
+		limit, offset int
+		expected      []int32
+		expectedPulls int
+	}{
+		{"limit", 3, 0, []int32{0, 1, 2}, 3},
+		{"limit with offset", 2, 4, []int32{4, 5}, 6},
+		{"limit bigger than input", 20, 0, []int32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, 10},
+		{"offset past input", 2, 15, []int32{}, 10},
+		{"zero limit", 0, 0, []int32{}, 0},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			pulls := 0
+			counted := RowIter(func(yield func(Row) bool) {
+				for _, r := range rows {
+					pulls++
+					if !yield(r) {
+						return
+					}
+				}
+			})
+
+			assert.Equal(t, tC.expected, ids(Limit(counted, tC.limit, tC.offset)))
+			assert.Equal(t, tC.expectedPulls, pulls)
+		})
+	}
+}
+
+func TestAlgebraSetOperations(t *testing.T) {
+	rowsOf := func(vals ...any) RowIter {
+		var out []Row
+		for _, v := range vals {
+			switch v := v.(type) {
+			case nil:
+				out = append(out, Row{"v": {Null, nil}})
+			default:
+				out = append(out, Row{"v": col(t, v.(int))})
+			}
+		}
+		return RowIter(slices.Values(out))
+	}
+	fields := []FieldName{"v"}
+
+	testCases := []struct {
+		desc     string
+		got      RowIter
+		expected RowIter
+	}{
+		{"distinct", Distinct(rowsOf(1, 2, 1, nil, 3, nil), fields), rowsOf(1, 2, nil, 3)},
+		{"concat", Concat(rowsOf(1, 2), rowsOf(2, 3)), rowsOf(1, 2, 2, 3)},
+		{"intersect", Intersect(rowsOf(1, 2, 2, nil, 4), rowsOf(2, 4, 5, nil), fields), rowsOf(2, nil, 4)},
+		{"except", Except(rowsOf(1, 2, 1, nil, 3), rowsOf(2, nil), fields), rowsOf(1, 3)},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, slices.Collect(iter.Seq[Row](tC.expected)), slices.Collect(iter.Seq[Row](tC.got)))
+		})
+	}
+
+	t.Run("rename", func(t *testing.T) {
+		got := Rename(RowIter(slices.Values([]Row{{"a": col(t, 1), "b": col(t, 2)}})), []FieldName{"b"}, []FieldName{"x"})
+		assert.Equal(t, []Row{{"x": col(t, 2)}}, slices.Collect(iter.Seq[Row](got)))
+	})
+}
+
+func TestAlgebraArithmetic(t *testing.T) {
+	i := func(v int32) ColumnData { return ColumnData{Int32, v} }
+	f := func(v float64) ColumnData { return ColumnData{Float, v} }
+	big := func(v int64) ColumnData { return ColumnData{Int64, v} }
+	null := ColumnData{Null, nil}
+
+	testCases := []struct {
+		desc        string
+		op          string
+		left, right ColumnData
+		expected    ColumnData
+	}{
+		{"int sum", "+", i(2), i(3), i(5)},
+		{"int sub", "-", i(2), i(3), i(-1)},
+		{"int mul", "*", i(4), i(3), i(12)},
+		{"int div truncates", "/", i(7), i(2), i(3)},
+		{"int mod", "%", i(7), i(3), i(1)},
+		{"int with float", "+", i(1), f(0.5), f(1.5)},
+		{"float div", "/", f(1), i(4), f(0.25)},
+		{"float mod", "%", f(7.5), i(2), f(1.5)},
+		{"null", "+", i(1), null, null},
+		{"int with bigint", "*", i(1 << 20), big(1 << 20), big(1 << 40)},
+		{"bigint with float", "-", big(3), f(0.5), f(2.5)},
+		{"bigint mod", "%", big(-7), big(3), big(-1)},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, arithmetic(tC.op, tC.left, tC.right))
+		})
+	}
+
+	errorCases := []struct {
+		desc        string
+		op          string
+		left, right ColumnData
+	}{
+		{"int division by zero", "/", i(1), i(0)},
+		{"int modulo by zero", "%", i(1), i(0)},
+		{"float division by zero", "/", f(1), f(0)},
+		{"overflow", "*", i(1 << 20), i(1 << 20)},
+		{"string operand", "+", i(1), ColumnData{String, "a"}},
+		{"bigint overflow", "+", big(math.MaxInt64), i(1)},
+		{"bigint mul overflow", "*", big(math.MinInt64), big(-1)},
+		{"bigint division by zero", "/", big(1), i(0)},
+	}
+	for _, tC := range errorCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			var err error
+			func() {
+				defer recoverEvalError(&err)
+				arithmetic(tC.op, tC.left, tC.right)
+			}()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAlgebraThreeValuedLogic(t *testing.T) {
+	tr, fa, null := ColumnData{Boolean, true}, ColumnData{Boolean, false}, ColumnData{Null, nil}
+
+	testCases := []struct {
+		left, right ColumnData
+		and, or     ColumnData
+	}{
+		{tr, tr, tr, tr},
+		{tr, fa, fa, tr},
+		{fa, fa, fa, fa},
+		{tr, null, null, tr},
+		{fa, null, fa, null},
+		{null, fa, fa, null},
+		{null, tr, null, tr},
+		{null, null, null, null},
+	}
+	for _, tC := range testCases {
+		t.Run(fmt.Sprintf("%v %v", tC.left.Data, tC.right.Data), func(t *testing.T) {
+			assert.Equal(t, tC.and, logical("and", tC.left, tC.right))
+			assert.Equal(t, tC.or, logical("or", tC.left, tC.right))
+		})
+	}
+
+	assert.Equal(t, null, prefix("not", null))
+}
@@ -0,0 +1,357 @@
+package naive
+
+import (
+	"bytes"
+	"fmt"
+	"iter"
+	"slices"
+	"sort"
+)
+
+// b+tree stored in pages, cells are ordered by their key compared bytewise.
+// Leaves hold values and are linked to their right sibling by NextPage,
+// interior pages hold child pointers and their NextPage is the rightmost child.
+// Root stays on the same page for the whole life of the tree, so the catalog can point to it
+type bplusTree struct {
+	s        *StorageEngine
+	root     PageID
+	leaf     PageType
+	interior PageType
+}
+
+func (s *StorageEngine) tableTree(root PageID) *bplusTree {
+	return &bplusTree{s, root, TableLeafPageType, TableInteriorPageType}
+}
+
+func (s *StorageEngine) indexTree(root PageID) *bplusTree {
+	return &bplusTree{s, root, IndexLeafPageType, IndexInteriorPageType}
+}
+
+const usablePageSpace = PageSize - genericHeaderSize
+
+// three biggest cells with their length and slot always fit in a page,
+// so a page split in two halves never overflows
+const maxCellSize = usablePageSpace/3 - 4 - rowIdSize
+
+// interior cell: key and a child holding keys smaller than it, but not smaller than the previous key
+func interiorCell(key []byte, child PageID) []byte {
+	return append(SerializeBytes(key), SerializeInt(int32(child))...)
+}
+
+func leafCell(key, value []byte) []byte {
+	return append(SerializeBytes(key), value...)
+}
+
+func cellKey(cell []byte) []byte {
+	return must(DeserializeBytes(BytesWithHeader(cell)))
+}
+
+func cellValue(cell []byte) []byte {
+	return cell[4+len(cellKey(cell)):]
+}
+
+func cellChild(cell []byte) PageID {
+	return PageID(endinanness.Uint32(cellValue(cell)))
+}
+
+// position of the first cell with key not smaller than given one
+func search(p *GenericPage, key []byte) (int, bool) {
+	i := sort.Search(p.cellCount(), func(i int) bool { return bytes.Compare(cellKey(p.cell(i)), key) >= 0 })
+	return i, i < p.cellCount() && bytes.Equal(cellKey(p.cell(i)), key)
+}
+
+// position of the child of interior page that can hold the key
+func childIndex(p *GenericPage, key []byte) int {
+	return sort.Search(p.cellCount(), func(i int) bool { return bytes.Compare(cellKey(p.cell(i)), key) > 0 })
+}
+
+func child(p *GenericPage, i int) PageID {
+	if i == p.cellCount() {
+		return p.Header.NextPage
+	}
+	return cellChild(p.cell(i))
+}
+
+func setChild(p *GenericPage, i int, id PageID) {
+	if i == p.cellCount() {
+		p.Header.NextPage = id
+		return
+	}
+	debugAsserErr(p.replaceCell(i, interiorCell(cellKey(p.cell(i)), id)), "same size cell should fit")
+}
+
+func cellsOf(p *GenericPage) [][]byte {
+	out := make([][]byte, 0, p.cellCount())
+	for i := range p.cellCount() {
+		out = append(out, slices.Clone(p.cell(i)))
+	}
+	return out
+}
+
+// new page of given type and next page, filled with cells
+func pageWithCells(typ PageType, next PageID, cells [][]byte) (*GenericPage, error) {
+	p := NewPage(typ, PageSize)
+	p.Header.NextPage = next
+	for i, c := range cells {
+		if err := p.insertCell(i, c); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// page is pinned until it's released
+func (t *bplusTree) read(id PageID) *GenericPage {
+	p, ok := t.s.ReadGenericPage(id)
+	debugAssert(ok && (p.Header.PageTyp == t.leaf || p.Header.PageTyp == t.interior),
+		"tree corruption, page %d is not part of the tree", id)
+	return p
+}
+
+func (t *bplusTree) release(id PageID) {
+	t.s.ReleasePage(id)
+}
+
+// private copy of the page, pages read from the storage are shared. Copy isn't pinned
+func (t *bplusTree) readForUpdate(id PageID) *GenericPage {
+	defer t.release(id)
+	return t.read(id).clone()
+}
+
+// leaf the key belongs to, pinned until it's released. From nil goes to the leftmost leaf
+func (t *bplusTree) leafOf(key []byte) (PageID, *GenericPage) {
+	id, p := t.root, t.read(t.root)
+	for p.Header.PageTyp == t.interior {
+		next := child(p, 0)
+		if key != nil {
+			next = child(p, childIndex(p, key))
+		}
+		t.release(id)
+		id, p = next, t.read(next)
+	}
+	return id, p
+}
+
+func (t *bplusTree) write(id PageID, p *GenericPage) {
+	t.s.persistPage(id, p.Serialize())
+}
+
+func (t *bplusTree) get(key []byte) ([]byte, bool) {
+	id, p := t.leafOf(key)
+	defer t.release(id)
+	if i, found := search(p, key); found {
+		return cellValue(p.cell(i)), true
+	}
+	return nil, false
+}
+
+// inserts the value, or replaces it when the key is already present
+func (t *bplusTree) put(key, value []byte) error {
+	cell := leafCell(key, value)
+	if len(cell) > maxCellSize {
+		return fmt.Errorf("cell of %d bytes doesn't fit in a page, max is %d", len(cell), maxCellSize)
+	}
+
+	split := t.putInto(t.root, key, cell)
+	if split == nil {
+		return nil
+	}
+
+	// root can't move, its content goes to a new left child
+	left := t.readForUpdate(t.root)
+	leftID, _ := t.s.AllocatePage(left.Header.PageTyp)
+	t.write(leftID, left)
+	root := must(pageWithCells(t.interior, split.right, [][]byte{interiorCell(split.key, leftID)}))
+	t.write(t.root, root)
+	return nil
+}
+
+// first key of the new right page and its id
+type pageSplit struct {
+	key   []byte
+	right PageID
+}
+
+func (t *bplusTree) putInto(id PageID, key, cell []byte) *pageSplit {
+	p := t.readForUpdate(id)
+	if p.Header.PageTyp == t.leaf {
+		i, found := search(p, key)
+		if found {
+			p.removeCell(i)
+		}
+		return t.insertOrSplit(id, p, i, cell)
+	}
+
+	i := childIndex(p, key)
+	left := child(p, i)
+	split := t.putInto(left, key, cell)
+	if split == nil {
+		return nil
+	}
+	// pointer to the split child now points to its right part, left one goes before the new key
+	setChild(p, i, split.right)
+	return t.insertOrSplit(id, p, i, interiorCell(split.key, left))
+}
+
+func (t *bplusTree) insertOrSplit(id PageID, p *GenericPage, i int, cell []byte) *pageSplit {
+	if err := p.insertCell(i, cell); err == nil {
+		t.write(id, p)
+		return nil
+	}
+
+	cells := slices.Insert(cellsOf(p), i, cell)
+	mid := splitPoint(cells)
+	rightID, _ := t.s.AllocatePage(p.Header.PageTyp)
+
+	var left, right *GenericPage
+	if p.Header.PageTyp == t.leaf {
+		right = must(pageWithCells(t.leaf, p.Header.NextPage, cells[mid:]))
+		left = must(pageWithCells(t.leaf, rightID, cells[:mid]))
+	} else {
+		// middle key moves up, its child becomes rightmost child of the left page
+		right = must(pageWithCells(t.interior, p.Header.NextPage, cells[mid+1:]))
+		left = must(pageWithCells(t.interior, cellChild(cells[mid]), cells[:mid]))
+	}
+	t.write(id, left)
+	t.write(rightID, right)
+	return &pageSplit{slices.Clone(cellKey(cells[mid])), rightID}
+}
+
+// index of the first cell of the right half, halves have about the same size
+// and both get at least one cell
+func splitPoint(cells [][]byte) int {
+	total := 0
+	for _, c := range cells {
+		total += len(c)
+	}
+
+	left, mid := 0, 0
+	for mid < len(cells)-2 && left < total/2 {
+		left += len(cells[mid])
+		mid++
+	}
+	return max(mid, 1)
+}
+
+// removes the key, pages that get less than half full are merged with a sibling when they fit together
+func (t *bplusTree) delete(key []byte) bool {
+	found := t.deleteFrom(t.root, key)
+
+	// root left with a single child takes over its content
+	for root := t.readForUpdate(t.root); root.Header.PageTyp == t.interior && root.cellCount() == 0; root = t.readForUpdate(t.root) {
+		only := root.Header.NextPage
+		t.write(t.root, t.readForUpdate(only))
+		t.s.freePages([]PageID{only})
+	}
+	return found
+}
+
+func (t *bplusTree) deleteFrom(id PageID, key []byte) bool {
+	p := t.readForUpdate(id)
+	if p.Header.PageTyp == t.leaf {
+		i, found := search(p, key)
+		if found {
+			p.removeCell(i)
+			t.write(id, p)
+		}
+		return found
+	}
+
+	i := childIndex(p, key)
+	if !t.deleteFrom(child(p, i), key) {
+		return false
+	}
+	if t.readForUpdate(child(p, i)).usedSpace() >= usablePageSpace/2 {
+		return true
+	} else if i > 0 {
+		t.merge(id, p, i-1)
+	} else if p.cellCount() > 0 {
+		t.merge(id, p, i)
+	}
+	return true
+}
+
+// merges i-th child of interior page with the next one, if they fit in a single page
+func (t *bplusTree) merge(id PageID, p *GenericPage, i int) {
+	leftID, rightID := child(p, i), child(p, i+1)
+	left, right := t.readForUpdate(leftID), t.readForUpdate(rightID)
+
+	cells := cellsOf(left)
+	if left.Header.PageTyp == t.interior {
+		// separator comes down, pointing to the rightmost child of the left page
+		cells = append(cells, interiorCell(cellKey(p.cell(i)), left.Header.NextPage))
+	}
+	cells = append(cells, cellsOf(right)...)
+
+	merged, err := pageWithCells(left.Header.PageTyp, right.Header.NextPage, cells)
+	if err != nil {
+		return
+	}
+	t.write(leftID, merged)
+
+	p.removeCell(i)
+	setChild(p, i, leftID)
+	t.write(id, p)
+	t.s.freePages([]PageID{rightID})
+}
+
+// leaf cells in key order, starting from the first key not smaller than from. Nil from starts at the beginning.
+// Leaf stays pinned while its cells are yielded
+func (t *bplusTree) ascend(from []byte) iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		id, p := t.leafOf(from)
+		defer func() { t.release(id) }()
+
+		i := 0
+		if from != nil {
+			i, _ = search(p, from)
+		}
+		for {
+			for ; i < p.cellCount(); i++ {
+				c := p.cell(i)
+				if !yield(cellKey(c), cellValue(c)) {
+					return
+				}
+			}
+			if p.Header.NextPage == 0 {
+				return
+			}
+			next := p.Header.NextPage
+			t.release(id)
+			id, p, i = next, t.read(next), 0
+		}
+	}
+}
+
+// biggest key of the tree
+func (t *bplusTree) last() ([]byte, bool) {
+	p := t.readForUpdate(t.root)
+	for p.Header.PageTyp == t.interior {
+		p = t.readForUpdate(p.Header.NextPage)
+	}
+	if n := p.cellCount(); n > 0 {
+		return slices.Clone(cellKey(p.cell(n - 1))), true
+	}
+
+	// rightmost leaf can be left empty when there was no sibling to merge it with
+	var out []byte
+	for k := range t.ascend(nil) {
+		out = k
+	}
+	return slices.Clone(out), out != nil
+}
+
+// every page of the tree, root first
+func (t *bplusTree) pages() []PageID {
+	out := []PageID{t.root}
+	for i := 0; i < len(out); i++ {
+		p := t.read(out[i])
+		if p.Header.PageTyp == t.interior {
+			for c := range p.cellCount() + 1 {
+				out = append(out, child(p, c))
+			}
+		}
+		t.release(out[i])
+	}
+	return out
+}
@@ -0,0 +1,192 @@
+package naive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// frames of the pool used by storage engines, 1MB with 4KB pages
+const defaultPoolFrames = 256
+
+var errPoolPinned = errors.New("all frames of the buffer pool are pinned")
+
+// page loaded into the pool. Data and page are never modified in place, writes replace them
+type frame struct {
+	id   PageID
+	data []byte
+	page *GenericPage // data deserialized on the first ReadGenericPage, nil until then
+
+	pins       int  // readers currently using the frame, pinned frames are not evicted
+	dirty      bool // data differs from the pager and has to be written back before eviction
+	referenced bool // second chance of the clock
+	used       bool
+}
+
+type BufferPoolStats struct {
+	Hits      int
+	Misses    int // pages read from the pager
+	Evictions int
+}
+
+// fixed number of frames in front of the pager. Written pages stay in their frame
+// until they are evicted or flushed, frames to evict are chosen by the clock algorithm
+type BufferPool struct {
+	pages    pager
+	frames   []frame
+	table    map[PageID]int // frame holding the page
+	hand     int            // next frame the clock looks at
+	stats    BufferPoolStats
+	flushLog func() error // makes changes of evicted pages durable before they are written, nil without log
+}
+
+func newBufferPool(p pager, frames int) *BufferPool {
+	debugAssert(frames > 0, "buffer pool needs at least one frame, got %d", frames)
+	return &BufferPool{
+		pages:  p,
+		frames: make([]frame, frames),
+		table:  map[PageID]int{},
+	}
+}
+
+func (b *BufferPool) Stats() BufferPoolStats {
+	return b.stats
+}
+
+// loads the page into a frame and pins it, so it stays there until unpinned.
+// Returns false when the page doesn't exist
+func (b *BufferPool) pin(id PageID) (*frame, bool, error) {
+	if i, ok := b.table[id]; ok {
+		b.stats.Hits++
+		f := &b.frames[i]
+		f.pins++
+		f.referenced = true
+		return f, true, nil
+	}
+
+	data, ok := b.pages.read(id)
+	if !ok {
+		return nil, false, nil
+	}
+	i, err := b.victim()
+	if err != nil {
+		return nil, false, fmt.Errorf("loading page %d: %w", id, err)
+	}
+	b.stats.Misses++
+	// pager may reuse the memory it returned
+	b.frames[i] = frame{id: id, data: bytes.Clone(data), pins: 1, referenced: true, used: true}
+	b.table[id] = i
+	return &b.frames[i], true, nil
+}
+
+func (b *BufferPool) unpin(id PageID) {
+	i, ok := b.table[id]
+	debugAssert(ok && b.frames[i].pins > 0, "page %d is not pinned", id)
+	b.frames[i].pins--
+}
+
+// content of the page without loading it into a frame, it can't be modified.
+// Returns false when the page doesn't exist
+func (b *BufferPool) peek(id PageID) ([]byte, bool) {
+	if i, ok := b.table[id]; ok {
+		return b.frames[i].data, true
+	}
+	data, ok := b.pages.read(id)
+	return bytes.Clone(data), ok
+}
+
+// replaces content of the page, it's written to the pager on eviction or flush.
+// Pool keeps the data, caller can't modify it afterwards
+func (b *BufferPool) write(id PageID, data []byte) error {
+	debugAssert(len(data) == PageSize, "enforcing page size")
+
+	i, ok := b.table[id]
+	if !ok {
+		var err error
+		if i, err = b.victim(); err != nil {
+			return fmt.Errorf("writing page %d: %w", id, err)
+		}
+		b.frames[i] = frame{id: id, used: true}
+		b.table[id] = i
+	}
+	f := &b.frames[i]
+	f.data, f.page = data, nil
+	f.dirty, f.referenced = true, true
+	return nil
+}
+
+// free frame, or the first unpinned one not referenced since the last pass of the clock.
+// Dirty page of the evicted frame goes to the pager
+func (b *BufferPool) victim() (int, error) {
+	// two rounds, the first one may only clear reference bits
+	for range 2 * len(b.frames) {
+		i := b.hand
+		f := &b.frames[i]
+		b.hand = (b.hand + 1) % len(b.frames)
+
+		if !f.used {
+			return i, nil
+		} else if f.pins > 0 {
+			continue
+		} else if f.referenced {
+			f.referenced = false
+			continue
+		}
+
+		if err := b.writeBack(f); err != nil {
+			return 0, err
+		}
+		delete(b.table, f.id)
+		b.stats.Evictions++
+		return i, nil
+	}
+	return 0, fmt.Errorf("%w, %d frames", errPoolPinned, len(b.frames))
+}
+
+// writes dirty page to the pager, changes of the page are written to the log first
+func (b *BufferPool) writeBack(f *frame) error {
+	if !f.dirty {
+		return nil
+	} else if b.flushLog != nil {
+		if err := b.flushLog(); err != nil {
+			return fmt.Errorf("writing log before page %d: %w", f.id, err)
+		}
+	}
+	if err := b.pages.write(f.id, f.data); err != nil {
+		return fmt.Errorf("writing page %d: %w", f.id, err)
+	}
+	f.dirty = false
+	return nil
+}
+
+// writes dirty pages to the pager and makes them durable, they stay cached
+func (b *BufferPool) flush() error {
+	for i := range b.frames {
+		if f := &b.frames[i]; f.used {
+			if err := b.writeBack(f); err != nil {
+				return err
+			}
+		}
+	}
+	return b.pages.flush()
+}
+
+// drops pages from the given number on, from the frames and the pager. Dirty ones aren't written
+func (b *BufferPool) truncate(pages int) error {
+	for i := range b.frames {
+		if f := &b.frames[i]; f.used && int(f.id) >= pages {
+			debugAssert(f.pins == 0, "truncated page %d is pinned", f.id)
+			delete(b.table, f.id)
+			*f = frame{}
+		}
+	}
+	return b.pages.truncate(pages)
+}
+
+func (b *BufferPool) close() error {
+	err := b.flush()
+	if closeErr := b.pages.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+package naive
+
+import (
+	"fmt"
+	"maps"
+	"simple-db/sql"
+	"strings"
+)
+
+type ConstraintKind int
+
+const (
+	NotNullConstraint ConstraintKind = iota
+	CheckConstraint
+	UniqueConstraint
+	PrimaryKeyConstraint
+	ForeignKeyConstraint
+)
+
+func (c ConstraintKind) String() string {
+	return [...]string{
+		"not null",
+		"check",
+		"unique",
+		"primary key",
+		"foreign key",
+	}[c]
+}
+
+// returned when insert, update or delete would break a constraint of the table
+type ConstraintError struct {
+	Kind   ConstraintKind
+	Table  string
+	Column string
+	Check  string // expression of the failed check constraint
+}
+
+func (e *ConstraintError) Error() string {
+	if e.Kind == CheckConstraint {
+		return fmt.Sprintf("%v constraint failed for %v.%v: %v", e.Kind, e.Table, e.Column, e.Check)
+	}
+	return fmt.Sprintf("%v constraint failed for %v.%v", e.Kind, e.Table, e.Column)
+}
+
+// checks constraints of a table before it's created or altered
+func validateConstraints(table string, schema TableSchema) error {
+	scope := &queryScope{tables: []scopedTable{{table, schema}}}
+	primaryKeys := 0
+	for i, name := range schema.FieldNames {
+		c := schema.Constraints[name]
+		if c.PrimaryKey {
+			primaryKeys++
+		}
+
+		if c.Default != nil {
+			if _, err := defaultValue(c.Default, schema.FieldsTypes[i]); err != nil {
+				return fmt.Errorf("invalid default for column %q: %w", name, err)
+			}
+		}
+
+		if c.Check == nil {
+			continue
+		} else if err := scope.validate(c.Check); err != nil {
+			return fmt.Errorf("invalid check for column %q: %w", name, err)
+		} else if containsAggregate(c.Check) {
+			return fmt.Errorf("aggregate functions are not allowed in check for column %q", name)
+		} else if typ := scope.typeOf(c.Check); typ != Boolean && typ != Null {
+			return fmt.Errorf("check for column %q must be boolean, got %v", name, typ)
+		}
+	}
+
+	if primaryKeys > 1 {
+		return fmt.Errorf("table %v can have only one primary key", table)
+	}
+	return nil
+}
+
+func defaultValue(expr sql.Expression, typ FieldType) (ColumnData, error) {
+	v, err := evalConstant(expr)
+	if err != nil {
+		return v, err
+	}
+	return convertTo(v, typ)
+}
+
+// not null and check constraints of a single row. Check that evaluates to null passes,
+// only false breaks it. Index keys of the row have to fit in index pages
+func checkRow(table string, schema TableSchema, r Row) (err error) {
+	defer recoverEvalError(&err)
+	qualified := qualify(table, maps.Clone(r))
+
+	for _, name := range schema.FieldNames {
+		c := schema.Constraints[name]
+		if (c.NotNull || c.PrimaryKey) && r[name].Typ == Null {
+			return &ConstraintError{Kind: NotNullConstraint, Table: table, Column: string(name)}
+		} else if c.Check == nil {
+			continue
+		}
+
+		res := predBuilder(c.Check, qualified)
+		if res.Typ == Boolean && !res.Data.(bool) {
+			return &ConstraintError{Kind: CheckConstraint, Table: table, Column: string(name), Check: c.Check.String()}
+		} else if res.Typ != Boolean && res.Typ != Null {
+			return fmt.Errorf("check for column %q must be boolean, got %v", name, res.Typ)
+		}
+	}
+
+	for _, idx := range schema.Indexes {
+		if err := checkIndexKey(table, idx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columns with values that can't repeat in rows of the table
+type uniqueKey struct {
+	columns []FieldName
+	kind    ConstraintKind
+}
+
+// unique and primary key columns, and columns of unique indexes created by users
+func uniqueKeys(schema TableSchema) []uniqueKey {
+	var keys []uniqueKey
+	for _, name := range schema.FieldNames {
+		if c := schema.Constraints[name]; c.PrimaryKey {
+			keys = append(keys, uniqueKey{[]FieldName{name}, PrimaryKeyConstraint})
+		} else if c.Unique {
+			keys = append(keys, uniqueKey{[]FieldName{name}, UniqueConstraint})
+		}
+	}
+	for _, idx := range schema.Indexes {
+		if idx.Unique && !idx.Implicit {
+			keys = append(keys, uniqueKey{idx.Columns, UniqueConstraint})
+		}
+	}
+	return keys
+}
+
+// values of the key columns, false when one of them is null. Nulls are not equal to each other,
+// so they never break uniqueness
+func (k uniqueKey) values(r Row) ([]ColumnData, bool) {
+	vals := make([]ColumnData, 0, len(k.columns))
+	for _, name := range k.columns {
+		if r[name].Typ == Null {
+			return nil, false
+		}
+		vals = append(vals, r[name])
+	}
+	return vals, true
+}
+
+func (k uniqueKey) err(table string) error {
+	columns := make([]string, 0, len(k.columns))
+	for _, name := range k.columns {
+		columns = append(columns, string(name))
+	}
+	return &ConstraintError{Kind: k.kind, Table: table, Column: strings.Join(columns, ", ")}
+}
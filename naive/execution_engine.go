@@ -5,18 +5,24 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"simple-db/sql"
+	"slices"
+	"strings"
+	"time"
 )
 
 type Database struct {
 	*ExecutionEngine
+	tx *Tx // explicit transaction, nil when every statement is committed on its own
 }
 
 func (d *Database) Serialize() []byte {
 	var out bytes.Buffer
 	for i := range d.storage.root.NumberOfPages {
-		p := d.storage.allPages[byteOffsetFromPageID(PageID(i)):byteOffsetFromPageID(PageID(i+1))]
-		out.Write(p)
+		data, ok := d.storage.pool.peek(PageID(i))
+		debugAssert(ok, "page %d not found", i)
+		out.Write(data)
 	}
 	res := out.Bytes()
 	debugAssert(len(res)%PageSize == 0, "serialized database should be multiplication of page size")
@@ -71,19 +77,68 @@ func NewDatabaseFromBytes(r io.Reader) (*Database, error) {
 }
 
 func NewDatabase() *Database {
-	return &Database{NewExecutionEngine(NewStorageEngine())}
+	return &Database{ExecutionEngine: NewExecutionEngine(NewStorageEngine())}
 }
 
 func NewDatabaseWithStorage(storage *StorageEngine) *Database {
-	return &Database{NewExecutionEngine(storage)}
+	return &Database{ExecutionEngine: NewExecutionEngine(storage)}
 }
 
+// executes the statement, a failed one leaves no changes behind. Outside of a transaction
+// its changes are committed and flushed to the storage before it returns
 func (d *Database) Execute(sqlStatement string) (any, error) {
 	stmt, err := sql.Parse(sql.Lex(sqlStatement))
 	if err != nil {
 		return nil, err
 	}
 
+	switch stmt.(type) {
+	case *sql.BeginStatement:
+		_, err := d.Begin()
+		return nil, err
+	case *sql.CommitStatement:
+		if d.tx == nil {
+			return nil, errNoTransaction
+		}
+		return nil, d.tx.Commit()
+	case *sql.RollbackStatement:
+		if d.tx == nil {
+			return nil, errNoTransaction
+		}
+		return nil, d.tx.Rollback()
+	}
+
+	savepoint := d.storage.savepoint()
+	res, err := d.execute(stmt)
+	if err != nil {
+		if rollbackErr := d.storage.rollback(savepoint); rollbackErr != nil {
+			return nil, fmt.Errorf("undoing failed statement: %w", rollbackErr)
+		}
+	}
+	if d.tx != nil {
+		return res, err
+	}
+	d.storage.commit()
+	if flushErr := d.storage.Flush(); flushErr != nil {
+		return nil, fmt.Errorf("writing changes: %w", flushErr)
+	}
+	return res, err
+}
+
+// flushes and closes the database file, open transaction is rolled back
+func (d *Database) Close() error {
+	var err error
+	if d.tx != nil {
+		err = d.tx.Rollback()
+	}
+	if closeErr := d.storage.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (d *Database) execute(stmt sql.Statement) (_ any, err error) {
+	defer recoverEvalError(&err)
 	switch stmt := stmt.(type) {
 	case *sql.CreateStatement:
 		return nil, d.CreateTable(*stmt)
@@ -91,18 +146,40 @@ func (d *Database) Execute(sqlStatement string) (any, error) {
 		return nil, d.Insert(*stmt)
 	case *sql.SelectStatement:
 		return d.Select(*stmt)
+	case *sql.CompoundSelectStatement:
+		return d.SelectCompound(*stmt)
+	case *sql.ExplainStatement:
+		return d.Explain(*stmt)
+	case *sql.UpdateStatement:
+		return d.Update(*stmt)
+	case *sql.DeleteStatement:
+		return d.Delete(*stmt)
+	case *sql.DropTableStatement:
+		return nil, d.DropTable(*stmt)
+	case *sql.AlterTableStatement:
+		return nil, d.AlterTable(*stmt)
+	case *sql.CreateIndexStatement:
+		return nil, d.CreateIndex(*stmt)
+	case *sql.DropIndexStatement:
+		return nil, d.DropIndex(*stmt)
 	default:
 		return nil, fmt.Errorf("unknown statement type %T", stmt)
 	}
 }
 
+// sorts bigger than that spill to temporary files
+const defaultSortMemoryBudget = 4 * 1024 * 1024
+
 type ExecutionEngine struct {
 	storage *StorageEngine
+	// approximate number of bytes of rows sorted in memory
+	SortMemoryBudget int
 }
 
 func NewExecutionEngine(storage *StorageEngine) *ExecutionEngine {
 	return &ExecutionEngine{
-		storage: storage,
+		storage:          storage,
+		SortMemoryBudget: defaultSortMemoryBudget,
 	}
 }
 
@@ -111,25 +188,293 @@ func (e *ExecutionEngine) Schema() Schema {
 }
 
 func (e *ExecutionEngine) CreateTable(stmt sql.CreateStatement) error {
-	_, schemaFound := FindStartingPage(e.Schema(), string(stmt.Table))
-	if schemaFound {
-		return fmt.Errorf("table %v already present", stmt.Table)
+	if err := e.nameTaken(stmt.Table); err != nil {
+		return err
 	} else if len(stmt.Columns) == 0 {
 		return fmt.Errorf("empty table definition provided")
 	}
 
-	// empty data page
-	dataPageID, _ := e.storage.AllocatePage(DataPageType, stmt.Table)
+	tableSchema, err := tableSchemaFromCreate(stmt)
+	if err != nil {
+		return err
+	} else if err := validateConstraints(stmt.Table, tableSchema); err != nil {
+		return err
+	}
+	all := e.Schema()
+	all[TableName(stmt.Table)] = tableSchema
+	if err := validateForeignKeys(stmt.Table, tableSchema, all); err != nil {
+		return err
+	}
+	var implicit []sql.CreateIndexStatement
+	for _, col := range stmt.Columns {
+		if c := col.Constraints; c.PrimaryKey || c.Unique {
+			idx := sql.CreateIndexStatement{Name: implicitIndexName(stmt.Table, col.Name), Table: stmt.Table, Columns: []string{col.Name}, Unique: true}
+			if err := e.nameTaken(idx.Name); err != nil {
+				return err
+			}
+			implicit = append(implicit, idx)
+		}
+	}
+
+	// empty leaf is the root of the table tree
+	dataPageID, _ := e.storage.AllocatePage(TableLeafPageType)
 
 	sch := SchemaTuple{
-		PageTyp:        DataPageType,
+		PageTyp:        TableLeafPageType,
 		StartingPageID: dataPageID,
 		Name:           stmt.Table,
 		SqlStatement:   stmt.String(),
 	}
 
-	_, _, err := e.storage.AddTuple(schemaName, sch.ToTuple())
-	return err
+	if _, err := e.storage.AddTuple(schemaName, sch.ToTuple()); err != nil {
+		return err
+	}
+	// unique keys are looked up in their index
+	for _, idx := range implicit {
+		if err := e.createIndex(idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ExecutionEngine) DropTable(stmt sql.DropTableStatement) error {
+	if stmt.Table == schemaName {
+		return fmt.Errorf("can't drop %v", schemaName)
+	}
+
+	schema, schemaFound := e.Schema()[TableName(stmt.Table)]
+	if !schemaFound {
+		if stmt.IfExists {
+			return nil
+		}
+		return fmt.Errorf("table %v not found", stmt.Table)
+	} else if refs := referencedBy(e.Schema(), stmt.Table); len(refs) > 0 {
+		return fmt.Errorf("can't drop %v, it's referenced by %v", stmt.Table, strings.Join(refs, ", "))
+	}
+
+	for _, idx := range schema.Indexes {
+		if err := e.storage.DropIndex(idx.Name); err != nil {
+			return err
+		}
+	}
+	return e.storage.DropTable(stmt.Table)
+}
+
+func (e *ExecutionEngine) AlterTable(stmt sql.AlterTableStatement) error {
+	if stmt.Table == schemaName {
+		return fmt.Errorf("can't alter %v", schemaName)
+	}
+
+	_, sch, ok := e.storage.findSchemaTuple(stmt.Table)
+	if !ok || sch.PageTyp == IndexLeafPageType {
+		return fmt.Errorf("table %v not found", stmt.Table)
+	}
+	indexes := e.Schema()[TableName(stmt.Table)].Indexes
+	create, err := sch.CreateStatement()
+	if err != nil {
+		return fmt.Errorf("schema corruption for %v: %w", stmt.Table, err)
+	}
+	columnIdx := func(name string) int {
+		return slices.IndexFunc(create.Columns, func(c sql.ColumnDefinition) bool { return c.Name == name })
+	}
+
+	// data is changed only after the new definition is validated
+	applyData := func() error { return nil }
+	switch stmt.Action {
+	case sql.AddColumn:
+		if columnIdx(stmt.Column.Name) != -1 {
+			return fmt.Errorf("column %q already present in %v", stmt.Column.Name, stmt.Table)
+		} else if stmt.Column.Constraints.PrimaryKey || stmt.Column.Constraints.Unique {
+			return fmt.Errorf("can't add primary key or unique column %q to existing table", stmt.Column.Name)
+		}
+		create.Columns = append(create.Columns, stmt.Column)
+		if err := e.checkAddedColumn(*create, sch.StartingPageID); err != nil {
+			return err
+		}
+	case sql.DropColumn:
+		idx := columnIdx(stmt.Column.Name)
+		if idx == -1 {
+			return fmt.Errorf("unknown column %q for %v", stmt.Column.Name, stmt.Table)
+		} else if len(create.Columns) == 1 {
+			return fmt.Errorf("can't drop the only column of %v", stmt.Table)
+		}
+		for _, idx := range indexes {
+			if slices.Contains(idx.Columns, FieldName(stmt.Column.Name)) && !idx.Implicit {
+				return fmt.Errorf("can't drop column %q of %v, it's used by index %v", stmt.Column.Name, stmt.Table, idx.Name)
+			}
+		}
+		applyData = func() error { return e.dropColumnData(stmt.Table, sch.StartingPageID, idx) }
+		create.Columns = slices.Delete(create.Columns, idx, idx+1)
+	case sql.RenameColumn:
+		idx := columnIdx(stmt.Column.Name)
+		if idx == -1 {
+			return fmt.Errorf("unknown column %q for %v", stmt.Column.Name, stmt.Table)
+		} else if columnIdx(stmt.NewName) != -1 {
+			return fmt.Errorf("column %q already present in %v", stmt.NewName, stmt.Table)
+		} else if c := create.Columns[idx].Constraints; c.PrimaryKey || c.Unique {
+			if err := e.nameTaken(implicitIndexName(stmt.Table, stmt.NewName)); err != nil {
+				return err
+			}
+		}
+		create.Columns[idx].Name = stmt.NewName
+		for _, fk := range foreignKeysOf(create) {
+			if fk.Column == stmt.Column.Name {
+				fk.Column = stmt.NewName
+			}
+			if fk.RefTable == create.Table && fk.RefColumn == stmt.Column.Name {
+				fk.RefColumn = stmt.NewName
+			}
+		}
+	case sql.RenameTable:
+		if err := e.nameTaken(stmt.NewName); err != nil {
+			return err
+		}
+		for _, idx := range indexes {
+			if !idx.Implicit {
+				continue
+			} else if err := e.nameTaken(implicitIndexName(stmt.NewName, string(idx.Columns[0]))); err != nil {
+				return err
+			}
+		}
+		for _, fk := range foreignKeysOf(create) {
+			if fk.RefTable == create.Table {
+				fk.RefTable = stmt.NewName
+			}
+		}
+		sch.Name = stmt.NewName
+		create.Table = stmt.NewName
+	default:
+		return fmt.Errorf("unknown alter table action %v", stmt.Action)
+	}
+
+	// renamed or dropped columns can still be used by check constraints
+	newSchema, err := tableSchemaFromCreate(*create)
+	if err != nil {
+		return err
+	} else if err := validateConstraints(create.Table, newSchema); err != nil {
+		return err
+	}
+	// other tables can reference renamed or dropped columns
+	all := e.Schema()
+	delete(all, TableName(stmt.Table))
+	all[TableName(create.Table)] = newSchema
+	for _, name := range slices.Sorted(maps.Keys(all)) {
+		if err := validateForeignKeys(string(name), all[name], all); err != nil {
+			return err
+		}
+	}
+
+	if err := applyData(); err != nil {
+		return err
+	}
+	sch.SqlStatement = create.String()
+	if err := e.storage.UpdateSchemaTuple(stmt.Table, *sch); err != nil {
+		return err
+	}
+
+	// indexes follow renames of the table and its columns, implicit ones are renamed
+	// and dropped together with their column
+	for _, idx := range indexes {
+		if stmt.Action == sql.DropColumn && idx.Implicit && idx.Columns[0] == FieldName(stmt.Column.Name) {
+			if err := e.storage.DropIndex(idx.Name); err != nil {
+				return err
+			}
+			continue
+		} else if stmt.Action != sql.RenameColumn && stmt.Action != sql.RenameTable {
+			continue
+		}
+
+		_, idxSch, ok := e.storage.findSchemaTuple(idx.Name)
+		debugAssert(ok, "schema corruption, index %v not found", idx.Name)
+		createIdx, err := idxSch.CreateIndexStatement()
+		if err != nil {
+			return fmt.Errorf("schema corruption for %v: %w", idx.Name, err)
+		}
+
+		createIdx.Table = create.Table
+		for i, col := range createIdx.Columns {
+			if stmt.Action == sql.RenameColumn && col == stmt.Column.Name {
+				createIdx.Columns[i] = stmt.NewName
+			}
+		}
+		if idx.Implicit {
+			createIdx.Name = implicitIndexName(createIdx.Table, createIdx.Columns[0])
+			idxSch.Name = createIdx.Name
+		}
+		idxSch.SqlStatement = createIdx.String()
+		if err := e.storage.UpdateSchemaTuple(idx.Name, *idxSch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// existing rows have to satisfy constraints of the column added as last one to create statement.
+// Tuples aren't rewritten, the column is read as its default from tuples written before it
+func (e *ExecutionEngine) checkAddedColumn(create sql.CreateStatement, startPage PageID) error {
+	schema, err := tableSchemaFromCreate(create)
+	if err != nil {
+		return err
+	} else if err := validateConstraints(create.Table, schema); err != nil {
+		return err
+	}
+
+	added := create.Columns[len(create.Columns)-1]
+	value := addedColumnValue(schema, len(schema.FieldNames)-1)
+	if _, _, err := serializeColumn(schema.FieldsTypes[len(schema.FieldsTypes)-1], value); err != nil {
+		return err
+	}
+
+	// non null default has to be present in the referenced table, if there are rows to fill
+	missingReference := false
+	if fk := added.Constraints.References; fk != nil && value.Typ != Null {
+		if parent, ok := e.Schema()[TableName(fk.RefTable)]; ok {
+			missingReference = true
+			for range e.rowsWithValues(parent, []FieldName{FieldName(fk.RefColumn)}, []ColumnData{value}) {
+				missingReference = false
+				break
+			}
+		}
+	}
+
+	for _, tup := range e.storage.TuplesWithID(startPage) {
+		if err := checkRow(create.Table, schema, e.parseTupleToRow(tup, schema)); err != nil {
+			return err
+		} else if missingReference {
+			return &ConstraintError{Kind: ForeignKeyConstraint, Table: create.Table, Column: added.Name}
+		}
+	}
+	return nil
+}
+
+// removes column data from every tuple, so positions match the new schema
+func (e *ExecutionEngine) dropColumnData(table string, startPage PageID, idx int) error {
+	var changes []rowChange
+	for id, tup := range e.storage.TuplesWithID(startPage) {
+		if int(tup.NumberOfFields) <= idx {
+			continue
+		}
+		tup.NumberOfFields--
+		tup.ColumnTypes = slices.Delete(tup.ColumnTypes, idx, idx+1)
+		tup.ColumnDatas = slices.Delete(tup.ColumnDatas, idx, idx+1)
+		changes = append(changes, rowChange{id, tup})
+	}
+	return e.applyChanges(table, changes)
+}
+
+type rowChange struct {
+	id    RowID
+	tuple Tuple
+}
+
+func (e *ExecutionEngine) applyChanges(table string, changes []rowChange) error {
+	for _, c := range changes {
+		if err := e.storage.UpdateTuple(table, c.id, c.tuple); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (e *ExecutionEngine) Insert(stmt sql.InsertStatement) error {
@@ -155,7 +500,7 @@ func (e *ExecutionEngine) Insert(stmt sql.InsertStatement) error {
 
 		parsed, err := ParseExpressionValueToType(val, typ)
 		if err != nil {
-			return fmt.Errorf("type mismatch for column %q for table %v, expected %v", col, stmt.Table, typ)
+			return fmt.Errorf("invalid value for column %q for table %v, expected %v: %w", col, stmt.Table, typ, err)
 		}
 
 		if parsed == nil {
@@ -168,93 +513,762 @@ func (e *ExecutionEngine) Insert(stmt sql.InsertStatement) error {
 		}
 	}
 
+	for i, col := range schema.FieldNames {
+		if _, ok := inputLookup[col]; ok {
+			continue
+		}
+		def := schema.Constraints[col].Default
+		if def == nil {
+			return fmt.Errorf("column %q not provided for %v", col, stmt.Table)
+		}
+		v, err := defaultValue(def, schema.FieldsTypes[i])
+		if err != nil {
+			return fmt.Errorf("default for column %q for %v: %w", col, stmt.Table, err)
+		}
+		inputLookup[col] = v
+	}
+
+	if err := checkRow(stmt.Table, schema, inputLookup); err != nil {
+		return err
+	}
+	changes := e.newChangeSet()
+	changes.insert(TableName(stmt.Table), inputLookup)
+	if err := changes.verify(); err != nil {
+		return err
+	}
+
 	tuple := Tuple{
 		NumberOfFields: int32(len(schema.FieldsTypes)),
 	}
 
-	for _, col := range schema.FieldNames {
-		d, ok := inputLookup[col]
-		if !ok {
-			return fmt.Errorf("column %q not provided for %v", col, stmt.Table)
+	for i, col := range schema.FieldNames {
+		colTyp, data, err := serializeColumn(schema.FieldsTypes[i], inputLookup[col])
+		if err != nil {
+			return fmt.Errorf("column %q for %v: %w", col, stmt.Table, err)
 		}
+		tuple.ColumnDatas = append(tuple.ColumnDatas, data)
+		tuple.ColumnTypes = append(tuple.ColumnTypes, colTyp)
+	}
+
+	id, err := e.storage.AddTuple(stmt.Table, tuple)
+	if err != nil {
+		return err
+	}
+	e.indexRow(schema, id, inputLookup)
+	return nil
+}
+
+func serializeColumn(fieldTyp FieldType, d ColumnData) (ColumnType, []byte, error) {
+	d, err := convertTo(d, fieldTyp)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	switch d.Typ {
+	case Null:
+		return NullField, nil, nil
+	case Int32:
+		return IntField, SerializeInt(d.Data.(int32)), nil
+	case Float:
+		return FloatField, SerializeFloat(d.Data.(float64)), nil
+	case String:
+		return StringField, SerializeString(d.Data.(string)), nil
+	case Boolean:
+		return BooleanField, SerializeBool(d.Data.(bool)), nil
+	case Int64:
+		return BigIntField, SerializeInt64(d.Data.(int64)), nil
+	case Blob:
+		return BlobField, SerializeBytes(d.Data.([]byte)), nil
+	case Date:
+		return DateField, SerializeInt(int32(d.Data.(time.Time).Unix() / secondsPerDay)), nil
+	case Timestamp:
+		return TimestampField, SerializeInt64(d.Data.(time.Time).UnixMicro()), nil
+	default:
+		return 0, nil, fmt.Errorf("unsupported column type %v", d.Typ)
+	}
+}
 
-		switch d.Typ {
-		case Int32:
-			tuple.ColumnDatas = append(tuple.ColumnDatas, SerializeInt(d.Data.(int32)))
-			tuple.ColumnTypes = append(tuple.ColumnTypes, IntField)
-		case String:
-			tuple.ColumnDatas = append(tuple.ColumnDatas, SerializeString(d.Data.(string)))
-			tuple.ColumnTypes = append(tuple.ColumnTypes, StringField)
-		case Boolean:
-			tuple.ColumnDatas = append(tuple.ColumnDatas, SerializeBool(d.Data.(bool)))
-			tuple.ColumnTypes = append(tuple.ColumnTypes, BooleanField)
-		case Null:
-			tuple.ColumnDatas = append(tuple.ColumnDatas, nil)
-			tuple.ColumnTypes = append(tuple.ColumnTypes, NullField)
+func (e *ExecutionEngine) Update(stmt sql.UpdateStatement) (_ int, err error) {
+	defer recoverEvalError(&err)
+	schema, ok := e.storage.GetSchema()[TableName(stmt.Table)]
+	if !ok {
+		return 0, fmt.Errorf("table %v does not exist", stmt.Table)
+	}
+
+	columnIdx := map[FieldName]int{}
+	for i, name := range schema.FieldNames {
+		columnIdx[name] = i
+	}
+	scope := tableScope(stmt.Table, schema)
+	for _, a := range stmt.Assignments {
+		if _, ok := columnIdx[FieldName(a.Column)]; !ok {
+			return 0, fmt.Errorf("unknown column %q for %v", a.Column, stmt.Table)
+		} else if err := scope.validate(a.Value); err != nil {
+			return 0, err
 		}
 	}
 
-	_, _, err := e.storage.AddTuple(stmt.Table, tuple)
-	return err
+	predicate := func(Row) bool { return true }
+	if stmt.Where != nil {
+		if err := scope.validate(stmt.Where.Predicate); err != nil {
+			return 0, err
+		}
+		predicate = buildPredicate(stmt.Where.Predicate)
+	}
+
+	// collect changes first, tree pages can't change while they are walked
+	changes := e.newChangeSet()
+	updated := 0
+	for id, tup := range e.storage.TuplesWithID(schema.StartPage) {
+		row := qualify(stmt.Table, e.parseTupleToRow(tup, schema))
+		if !predicate(row) {
+			continue
+		}
+
+		// values are computed from the row before the statement, but foreign key
+		// actions of previous rows could have changed it already
+		cur := changes.current(TableName(stmt.Table), id, tup)
+		newRow := pendingRow{maps.Clone(cur.row), cur.tuple}
+		for _, a := range stmt.Assignments {
+			i := columnIdx[FieldName(a.Column)]
+			v, err := convertTo(predBuilder(a.Value, row), schema.FieldsTypes[i])
+			if err != nil {
+				return 0, fmt.Errorf("column %q for %v: %w", a.Column, stmt.Table, err)
+			}
+			newRow.tuple, err = setColumn(newRow.tuple, schema, i, v)
+			if err != nil {
+				return 0, fmt.Errorf("column %q for %v: %w", a.Column, stmt.Table, err)
+			}
+			newRow.row[FieldName(a.Column)] = v
+		}
+		if err := changes.change(TableName(stmt.Table), id, cur.row, newRow); err != nil {
+			return 0, err
+		}
+		updated++
+	}
+
+	// constraints are checked against tables as they would be after the update
+	if err := changes.verify(); err != nil {
+		return 0, err
+	} else if err := changes.apply(); err != nil {
+		return 0, err
+	}
+	return updated, nil
 }
 
-func (e *ExecutionEngine) Select(stmt sql.SelectStatement) (QueryResult, error) {
-	// todo: better structure, currently it's not lazy
-	var zero QueryResult
+func (e *ExecutionEngine) Delete(stmt sql.DeleteStatement) (_ int, err error) {
+	defer recoverEvalError(&err)
 	schema, ok := e.storage.GetSchema()[TableName(stmt.Table)]
 	if !ok {
-		return zero, fmt.Errorf("table %v does not exist", stmt.Table)
+		return 0, fmt.Errorf("table %v does not exist", stmt.Table)
+	}
+
+	predicate := func(Row) bool { return true }
+	if stmt.Where != nil {
+		if err := tableScope(stmt.Table, schema).validate(stmt.Where.Predicate); err != nil {
+			return 0, err
+		}
+		predicate = buildPredicate(stmt.Where.Predicate)
+	}
+
+	changes := e.newChangeSet()
+	deleted := 0
+	for id, tup := range e.storage.TuplesWithID(schema.StartPage) {
+		row := qualify(stmt.Table, e.parseTupleToRow(tup, schema))
+		if !predicate(row) {
+			continue
+		}
+		cur := changes.current(TableName(stmt.Table), id, tup)
+		if err := changes.change(TableName(stmt.Table), id, cur.row, pendingRow{}); err != nil {
+			return 0, err
+		}
+		deleted++
+	}
+
+	if err := changes.verify(); err != nil {
+		return 0, err
+	} else if err := changes.apply(); err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+func (e *ExecutionEngine) Select(stmt sql.SelectStatement) (_ QueryResult, err error) {
+	defer recoverEvalError(&err)
+	plan, err := e.planSelect(stmt)
+	if err != nil {
+		return QueryResult{}, err
 	}
+	return e.collect(plan)
+}
 
-	columnsToQuery, err := colsToQuery(stmt, schema)
+func (e *ExecutionEngine) SelectCompound(stmt sql.CompoundSelectStatement) (_ QueryResult, err error) {
+	defer recoverEvalError(&err)
+	plan, err := e.planCompound(stmt)
 	if err != nil {
-		return zero, err
+		return QueryResult{}, err
 	}
+	return e.collect(plan)
+}
+
+// logical plan of a query and its result header. Rows are keyed by the header
+type queryPlan struct {
+	header []FieldName
+	types  []FieldType // Null when type is not known, e.g. null literal
+	node   logicalNode
+}
 
-	out := QueryResult{
-		Header: columnsToQuery,
+func (e *ExecutionEngine) collect(plan *queryPlan) (QueryResult, error) {
+	out := QueryResult{Header: plan.header}
+	for row := range e.physical(plan.node).iter() {
+		vals := make([]string, 0, len(plan.header))
+		for _, col := range plan.header {
+			vals = append(vals, formatValue(row[col]))
+		}
+		out.Values = append(out.Values, vals)
 	}
+	return out, nil
+}
 
-	// todo: row iterator. Should I use regular tuples here and late materialize?
-	rowIt := e.rowIteratorzz(schema)
+func (e *ExecutionEngine) planSelect(stmt sql.SelectStatement) (*queryPlan, error) {
+	scope, err := newQueryScope(e.storage.GetSchema(), stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	header, outputs, err := colsToQuery(stmt, scope)
+	if err != nil {
+		return nil, err
+	}
 	if stmt.Where != nil {
-		rowIt = Select(rowIt, buildPredicate(stmt.Where.Predicate))
+		if err := scope.validate(stmt.Where.Predicate); err != nil {
+			return nil, err
+		} else if containsAggregate(stmt.Where.Predicate) {
+			return nil, fmt.Errorf("aggregate functions are not allowed in where")
+		}
+	}
+	for _, order := range stmt.OrderBy {
+		if err := scope.validate(order.Expr); err != nil {
+			return nil, err
+		}
+	}
+
+	aggregations, err := aggregationsToCompute(stmt, scope)
+	if err != nil {
+		return nil, err
 	}
-	projection := Project(rowIt, columnsToQuery)
 
-	for row := range projection {
-		vals := make([]string, 0, len(columnsToQuery))
-		for _, col := range columnsToQuery {
-			vals = append(vals, fmt.Sprint(row[FieldName(col)].Data))
+	types := make([]FieldType, 0, len(outputs))
+	for _, expr := range outputs {
+		types = append(types, scope.typeOf(expr))
+	}
+
+	p := &planner{scope}
+	node := p.selectNode(stmt, header, outputs, aggregations)
+	return &queryPlan{header, types, p.optimize(node, p.usedColumns(stmt, outputs))}, nil
+}
+
+func evalOutputs(rows RowIter, header []FieldName, outputs []sql.Expression) RowIter {
+	return func(yield func(Row) bool) {
+		for r := range rows {
+			out := Row{}
+			for i, expr := range outputs {
+				out[header[i]] = predBuilder(expr, r)
+			}
+			if !yield(out) {
+				return
+			}
 		}
-		out.Values = append(out.Values, vals)
 	}
+}
 
+// header and column types come from the leftmost select
+func (e *ExecutionEngine) planCompound(stmt sql.CompoundSelectStatement) (*queryPlan, error) {
+	var left *queryPlan
+	var err error
+	switch l := stmt.Left.(type) {
+	case *sql.SelectStatement:
+		left, err = e.planSelect(*l)
+	case *sql.CompoundSelectStatement:
+		left, err = e.planCompound(*l)
+	default:
+		err = fmt.Errorf("unsupported statement in compound select %T", l)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := e.planSelect(*stmt.Right)
+	if err != nil {
+		return nil, err
+	}
+	if len(left.header) != len(right.header) {
+		return nil, fmt.Errorf("selects in compound statement have different number of columns: %d and %d", len(left.header), len(right.header))
+	}
+
+	types := slices.Clone(left.types)
+	for i, typ := range right.types {
+		if types[i] == Null {
+			types[i] = typ
+		} else if typ != Null && typ != types[i] {
+			return nil, fmt.Errorf("column %v has type %v in one select and %v in the other", left.header[i], types[i], typ)
+		}
+	}
+
+	if _, ok := setOperations[stmt.Op]; !ok {
+		return nil, fmt.Errorf("unsupported set operation %v", stmt.Op)
+	}
+	var node logicalNode = &setOpNode{left.node, right.node, stmt.Op, left.header, right.header}
+
+	for _, order := range stmt.OrderBy {
+		if err := validateResultRef(order.Expr, left.header); err != nil {
+			return nil, err
+		}
+	}
+	if len(stmt.OrderBy) > 0 {
+		node = &sortNode{node, stmt.OrderBy}
+	}
+	if stmt.Limit != nil {
+		node = &limitNode{node, *stmt.Limit}
+	}
+	return &queryPlan{left.header, types, node}, nil
+}
+
+// order by of a compound statement can only use columns of the result
+func validateResultRef(expr sql.Expression, header []FieldName) error {
+	switch v := expr.(type) {
+	case *sql.InfixExpression:
+		if err := validateResultRef(v.Left, header); err != nil {
+			return err
+		}
+		return validateResultRef(v.Right, header)
+	case *sql.PrefixExpression:
+		return validateResultRef(v.Right, header)
+	case *sql.IsNullExpression:
+		return validateResultRef(v.Expr, header)
+	case sql.ColumnLiteral:
+		if !slices.Contains(header, FieldName(v.String())) {
+			return fmt.Errorf("%v is not a column of the compound select result", v)
+		}
+	case *sql.FunctionCall:
+		if slices.Contains(header, FieldName(v.String())) {
+			return nil
+		} else if _, ok := scalarFunctions[v.Name]; !ok {
+			return fmt.Errorf("%v is not a column of the compound select result", v)
+		}
+		for _, arg := range v.Args {
+			if err := validateResultRef(arg, header); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var aggregateFunctions = map[string]func() Accumulator{
+	"count": func() Accumulator { return &countAcc{} },
+	"sum":   func() Accumulator { return &sumAcc{} },
+	"avg":   func() Accumulator { return &avgAcc{} },
+	"min":   func() Accumulator { return &extremeAcc{sign: -1} },
+	"max":   func() Accumulator { return &extremeAcc{sign: 1} },
+}
+
+func isAggregateQuery(stmt sql.SelectStatement) bool {
+	if len(stmt.GroupBy) > 0 || stmt.Having != nil {
+		return true
+	}
+	return slices.ContainsFunc(stmt.Columns, func(c sql.ResultColumn) bool { return containsAggregate(c.Expr) })
+}
+
+func containsAggregate(expr sql.Expression) bool {
+	switch v := expr.(type) {
+	case *sql.InfixExpression:
+		return containsAggregate(v.Left) || containsAggregate(v.Right)
+	case *sql.PrefixExpression:
+		return containsAggregate(v.Right)
+	case *sql.IsNullExpression:
+		return containsAggregate(v.Expr)
+	case *sql.FunctionCall:
+		_, ok := aggregateFunctions[v.Name]
+		return ok || slices.ContainsFunc(v.Args, containsAggregate)
+	}
+	return false
+}
+
+// all distinct aggregate calls used in the query. Also checks that columns outside
+// of aggregates are grouped
+func aggregationsToCompute(stmt sql.SelectStatement, scope *queryScope) ([]Aggregation, error) {
+	for _, expr := range stmt.GroupBy {
+		if err := scope.validate(expr); err != nil {
+			return nil, err
+		} else if containsAggregate(expr) {
+			return nil, fmt.Errorf("aggregate functions are not allowed in group by")
+		}
+	}
+	if !isAggregateQuery(stmt) {
+		for _, o := range stmt.OrderBy {
+			if containsAggregate(o.Expr) {
+				return nil, fmt.Errorf("aggregate function %v used in query without aggregation", o.Expr)
+			}
+		}
+		return nil, nil
+	} else if stmt.HasWildcard {
+		return nil, fmt.Errorf("select * can't be used with aggregation")
+	}
+
+	exprs := []sql.Expression{}
+	for _, c := range stmt.Columns {
+		exprs = append(exprs, c.Expr)
+	}
+	if stmt.Having != nil {
+		if err := scope.validate(stmt.Having); err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, stmt.Having)
+	}
+	for _, o := range stmt.OrderBy {
+		exprs = append(exprs, o.Expr)
+	}
+
+	var out []Aggregation
+	seen := map[FieldName]bool{}
+	var collect func(expr sql.Expression) error
+	collect = func(expr sql.Expression) error {
+		// grouped expressions have the same value for the whole group
+		if slices.ContainsFunc(stmt.GroupBy, func(g sql.Expression) bool { return g.String() == expr.String() }) {
+			return nil
+		}
+
+		switch v := expr.(type) {
+		case *sql.InfixExpression:
+			if err := collect(v.Left); err != nil {
+				return err
+			}
+			return collect(v.Right)
+		case *sql.PrefixExpression:
+			return collect(v.Right)
+		case *sql.IsNullExpression:
+			return collect(v.Expr)
+		case *sql.FunctionCall:
+			if _, ok := scalarFunctions[v.Name]; ok {
+				for _, arg := range v.Args {
+					if err := collect(arg); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			name := FieldName(v.String())
+			if seen[name] {
+				return nil
+			}
+			seen[name] = true
+
+			agg := Aggregation{Name: name, New: aggregateFunctions[v.Name]}
+			if v.Wildcard {
+				agg.Arg = func(Row) ColumnData { return ColumnData{Boolean, true} }
+			} else {
+				arg := v.Args[0]
+				agg.Arg = func(r Row) ColumnData { return predBuilder(arg, r) }
+			}
+			out = append(out, agg)
+			return nil
+		case sql.ColumnLiteral:
+			grouped, err := scope.isGrouped(v, stmt.GroupBy)
+			if err != nil {
+				return err
+			} else if !grouped {
+				return fmt.Errorf("column %v must be used in group by or in an aggregate function", v)
+			}
+		}
+		return nil
+	}
+	for _, expr := range exprs {
+		if err := collect(expr); err != nil {
+			return nil, err
+		}
+	}
 	return out, nil
 }
 
-func (e *ExecutionEngine) rowIteratorzz(tableSchema TableSchema) RowIter {
+func orderByComparator(clauses []sql.OrderByClause) func(a, b Row) int {
+	return func(a, b Row) int {
+		for _, c := range clauses {
+			if res := compareForOrder(predBuilder(c.Expr, a), predBuilder(c.Expr, b), c); res != 0 {
+				return res
+			}
+		}
+		return 0
+	}
+}
+
+// nulls are bigger than any value, unless the clause says otherwise
+func compareForOrder(left, right ColumnData, c sql.OrderByClause) int {
+	leftNull, rightNull := left.Typ == Null, right.Typ == Null
+	if leftNull || rightNull {
+		if leftNull && rightNull {
+			return 0
+		}
+		nullsFirst := c.Nulls == sql.NullsFirst || (c.Nulls == sql.NullsDefault && c.Desc)
+		if leftNull == nullsFirst {
+			return -1
+		}
+		return 1
+	}
+
+	res := compareValues(left, right)
+	if c.Desc {
+		return -res
+	}
+	return res
+}
+
+// rows of the table with only the given columns parsed
+func (e *ExecutionEngine) tableScan(t scopedTable, columns []FieldName) RowIter {
 	return func(yield func(Row) bool) {
-		for tup := range e.storage.Tuples(tableSchema.StartPage) {
-			row := e.parseTupleToRow(tup, tableSchema.FieldNames)
-			if !yield(row) {
+		for tup := range e.storage.Tuples(t.schema.StartPage) {
+			row := e.parseColumns(tup, t.schema, columns)
+			if !yield(qualify(t.name, row)) {
 				return
 			}
 		}
 	}
 }
 
+func qualify(table string, row Row) Row {
+	for _, name := range slices.Collect(maps.Keys(row)) {
+		row[qualifiedName(table, name)] = row[name]
+	}
+	return row
+}
+
+func qualifiedName(table string, column FieldName) FieldName {
+	return FieldName(table + "." + string(column))
+}
+
+func nullRow(table string, tableSchema TableSchema) Row {
+	out := Row{}
+	for _, name := range tableSchema.FieldNames {
+		out[name] = ColumnData{Null, nil}
+	}
+	return qualify(table, out)
+}
+
+// tables used by a query, resolves column names used in the statement
+type queryScope struct {
+	tables []scopedTable
+}
+
+type scopedTable struct {
+	name   string
+	schema TableSchema
+}
+
+func newQueryScope(schema Schema, stmt sql.SelectStatement) (*queryScope, error) {
+	names := []string{stmt.Table}
+	for _, j := range stmt.Joins {
+		names = append(names, j.Table)
+	}
+
+	out := &queryScope{}
+	for _, name := range names {
+		tableSchema, ok := schema[TableName(name)]
+		if !ok {
+			return nil, fmt.Errorf("table %v does not exist", name)
+		} else if slices.ContainsFunc(out.tables, func(t scopedTable) bool { return t.name == name }) {
+			return nil, fmt.Errorf("table %v used more than once", name)
+		}
+		out.tables = append(out.tables, scopedTable{name, tableSchema})
+	}
+
+	for _, j := range stmt.Joins {
+		if j.On == nil {
+			continue
+		} else if err := out.validate(j.On); err != nil {
+			return nil, err
+		} else if containsAggregate(j.On) {
+			return nil, fmt.Errorf("aggregate functions are not allowed in join conditions")
+		}
+	}
+	return out, nil
+}
+
+// scope of the table changed by update or delete
+func tableScope(table string, schema TableSchema) *queryScope {
+	return &queryScope{[]scopedTable{{table, schema}}}
+}
+
+// checks if column exists and is not ambiguous
+func (q *queryScope) resolve(column string) error {
+	_, err := q.canonical(column)
+	return err
+}
+
+// table qualified name of the column
+func (q *queryScope) canonical(column string) (FieldName, error) {
+	if table, col, ok := strings.Cut(column, "."); ok {
+		for _, t := range q.tables {
+			if t.name == table && slices.Contains(t.schema.FieldNames, FieldName(col)) {
+				return FieldName(column), nil
+			}
+		}
+		return "", fmt.Errorf("unknown column %v", column)
+	}
+
+	var found []string
+	for _, t := range q.tables {
+		if slices.Contains(t.schema.FieldNames, FieldName(column)) {
+			found = append(found, t.name)
+		}
+	}
+	if len(found) == 0 {
+		return "", fmt.Errorf("unknown column %v in table %v", column, q.tables[0].name)
+	} else if len(found) > 1 {
+		return "", fmt.Errorf("column %v is ambiguous, present in tables %v", column, strings.Join(found, ", "))
+	}
+	return qualifiedName(found[0], FieldName(column)), nil
+}
+
+func (q *queryScope) isGrouped(col sql.ColumnLiteral, groupBy []sql.Expression) (bool, error) {
+	name, err := q.canonical(col.Name.Lexeme)
+	if err != nil {
+		return false, err
+	}
+	for _, expr := range groupBy {
+		grouped, ok := expr.(sql.ColumnLiteral)
+		if !ok {
+			continue
+		} else if groupedName, err := q.canonical(grouped.Name.Lexeme); err == nil && groupedName == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// static type of the expression, Null when it can't be known upfront
+func (q *queryScope) typeOf(expr sql.Expression) FieldType {
+	switch v := expr.(type) {
+	case *sql.InfixExpression:
+		if !isArithmetic(v.Operator.Lexeme) {
+			return Boolean
+		}
+		left, right := q.typeOf(v.Left), q.typeOf(v.Right)
+		isInt := func(t FieldType) bool { return t == Int32 || t == Int64 }
+		if left == Float || right == Float {
+			return Float
+		} else if left == Int32 && right == Int32 {
+			return Int32
+		} else if isInt(left) && isInt(right) {
+			return Int64
+		}
+	case *sql.PrefixExpression:
+		if v.Operator.Lexeme == "not" {
+			return Boolean
+		}
+		return q.typeOf(v.Right)
+	case *sql.IsNullExpression:
+		return Boolean
+	case sql.ValueLiteral:
+		return predBuilder(v, nil).Typ
+	case sql.ConstantLiteral:
+		return v.Value.(ColumnData).Typ
+	case sql.ColumnLiteral:
+		name, err := q.canonical(v.Name.Lexeme)
+		debugAsserErr(err, "column should be validated")
+		table, col, _ := strings.Cut(string(name), ".")
+		for _, t := range q.tables {
+			if idx := slices.Index(t.schema.FieldNames, FieldName(col)); t.name == table && idx != -1 {
+				return t.schema.FieldsTypes[idx]
+			}
+		}
+	case *sql.FunctionCall:
+		switch v.Name {
+		case "count":
+			return Int32
+		case "avg":
+			return Float
+		case "sum", "min", "max":
+			return q.typeOf(v.Args[0])
+		case "coalesce", "ifnull":
+			for _, arg := range v.Args {
+				if typ := q.typeOf(arg); typ != Null {
+					return typ
+				}
+			}
+		}
+	}
+	return Null
+}
+
+func (q *queryScope) validate(expr sql.Expression) error {
+	switch v := expr.(type) {
+	case *sql.InfixExpression:
+		if err := q.validate(v.Left); err != nil {
+			return err
+		}
+		return q.validate(v.Right)
+	case *sql.PrefixExpression:
+		return q.validate(v.Right)
+	case *sql.IsNullExpression:
+		return q.validate(v.Expr)
+	case sql.ColumnLiteral:
+		return q.resolve(v.Name.Lexeme)
+	case *sql.FunctionCall:
+		if err := validateCall(v); err != nil {
+			return err
+		}
+		for _, arg := range v.Args {
+			if err := q.validate(arg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checks the function exists and gets the right number of arguments
+func validateCall(v *sql.FunctionCall) error {
+	if fn, ok := scalarFunctions[v.Name]; ok {
+		if v.Wildcard {
+			return fmt.Errorf("%v(*) is not supported", v.Name)
+		} else if len(v.Args) < fn.minArgs || (fn.maxArgs != -1 && len(v.Args) > fn.maxArgs) {
+			return fmt.Errorf("wrong number of arguments for %v: %d", v.Name, len(v.Args))
+		}
+		return nil
+	}
+
+	if _, ok := aggregateFunctions[v.Name]; !ok {
+		return fmt.Errorf("unknown function %v", v.Name)
+	} else if v.Wildcard && v.Name != "count" {
+		return fmt.Errorf("%v(*) is not supported", v.Name)
+	} else if !v.Wildcard && len(v.Args) != 1 {
+		return fmt.Errorf("%v expects 1 argument, got %d", v.Name, len(v.Args))
+	} else if slices.ContainsFunc(v.Args, containsAggregate) {
+		return fmt.Errorf("aggregate functions can't be nested: %v", v)
+	}
+	return nil
+}
+
 type QueryResult struct {
 	Header []FieldName
 	Values [][]string
 }
 
-func (e *ExecutionEngine) parseTupleToRow(t Tuple, schema []FieldName) Row {
+func (e *ExecutionEngine) parseTupleToRow(t Tuple, schema TableSchema) Row {
+	return e.parseColumns(t, schema, schema.FieldNames)
+}
+
+// parses only the given columns, others aren't decoded and their overflow pages aren't read
+func (e *ExecutionEngine) parseColumns(t Tuple, schema TableSchema, columns []FieldName) Row {
 	out := Row{}
 	for i := range t.NumberOfFields {
 		data := t.ColumnDatas[i]
 		typ := t.ColumnTypes[i]
-		fieldName := schema[i]
+		fieldName := schema.FieldNames[i]
+		if !slices.Contains(columns, fieldName) {
+			continue
+		}
 		buf := bytes.NewBuffer(data)
 
 		var columnData *ColumnData
@@ -265,21 +1279,53 @@ func (e *ExecutionEngine) parseTupleToRow(t Tuple, schema []FieldName) Row {
 			columnData = &ColumnData{Boolean, must(ReadBool(buf))}
 		case IntField:
 			columnData = &ColumnData{Int32, must(ReadInt(buf))}
+		case FloatField:
+			columnData = &ColumnData{Float, must(ReadFloat(buf))}
 		case StringField:
 			columnData = &ColumnData{String, must(ReadString(buf))}
-		case OverflowField:
+		case BigIntField:
+			columnData = &ColumnData{Int64, must(ReadInt64(buf))}
+		case DateField:
+			days := must(ReadInt(buf))
+			columnData = &ColumnData{Date, time.Unix(int64(days)*secondsPerDay, 0).UTC()}
+		case TimestampField:
+			columnData = &ColumnData{Timestamp, time.UnixMicro(must(ReadInt64(buf))).UTC()}
+		case BlobField:
+			columnData = &ColumnData{Blob, must(ReadBytes(buf))}
+		case OverflowField, OverflowBlobField:
 			length := must(ReadInt(buf))
 			firstPageID := must(ReadInt(buf))
-			parsedData := e.followOverflowChain(int(length), PageID(firstPageID))
-			columnData = &ColumnData{String, string(parsedData)}
+			// chain holds the whole serialized column, including its length header
+			parsedData := bytes.NewBuffer(e.followOverflowChain(int(length), PageID(firstPageID)))
+			if typ == OverflowBlobField {
+				columnData = &ColumnData{Blob, must(ReadBytes(parsedData))}
+			} else {
+				columnData = &ColumnData{String, must(ReadString(parsedData))}
+			}
 		default:
 			debugAssert(false, "unexpected field type: %d", typ)
 		}
 		out[fieldName] = *columnData
 	}
+
+	// columns added after the tuple was written
+	for i := int(t.NumberOfFields); i < len(schema.FieldNames); i++ {
+		if slices.Contains(columns, schema.FieldNames[i]) {
+			out[schema.FieldNames[i]] = addedColumnValue(schema, i)
+		}
+	}
 	return out
 }
 
+// value of i-th column in tuples written before the column was added. Tuples aren't
+// rewritten when a column is added, it's read as its default, defaults can't be changed later
+func addedColumnValue(schema TableSchema, i int) ColumnData {
+	if def := schema.Constraints[schema.FieldNames[i]].Default; def != nil {
+		return must(defaultValue(def, schema.FieldsTypes[i]))
+	}
+	return ColumnData{Null, nil}
+}
+
 func (e *ExecutionEngine) followOverflowChain(dataLen int, firstPage PageID) []byte {
 	buf := bytes.NewBuffer(make([]byte, 0, dataLen))
 	remainingDataLen := dataLen
@@ -295,25 +1341,30 @@ func (e *ExecutionEngine) followOverflowChain(dataLen int, firstPage PageID) []b
 	return buf.Bytes()
 }
 
-func colsToQuery(stmt sql.SelectStatement, schema TableSchema) ([]FieldName, error) {
-	out := []FieldName{}
+// header of the result and expressions evaluated for each of its columns
+func colsToQuery(stmt sql.SelectStatement, scope *queryScope) ([]FieldName, []sql.Expression, error) {
+	header := []FieldName{}
+	outputs := []sql.Expression{}
 
 	if stmt.HasWildcard {
-		for _, name := range schema.FieldNames {
-			out = append(out, FieldName(name))
+		for _, t := range scope.tables {
+			for _, name := range t.schema.FieldNames {
+				if len(scope.tables) > 1 {
+					name = qualifiedName(t.name, name)
+				}
+				header = append(header, name)
+				outputs = append(outputs, sql.ColumnLiteral{Name: sql.Token{Typ: sql.Identifier, Lexeme: string(name)}})
+			}
 		}
-		return out, nil
-	}
-	allNames := map[FieldName]bool{}
-	for _, v := range schema.FieldNames {
-		allNames[v] = true
+		return header, outputs, nil
 	}
 
 	for _, v := range stmt.Columns {
-		if _, ok := allNames[FieldName(v)]; !ok {
-			return nil, fmt.Errorf("unknown column %v in table %v", v, stmt.Table)
+		if err := scope.validate(v.Expr); err != nil {
+			return nil, nil, err
 		}
-		out = append(out, FieldName(v))
+		header = append(header, FieldName(v.Name))
+		outputs = append(outputs, v.Expr)
 	}
-	return out, nil
+	return header, outputs, nil
 }
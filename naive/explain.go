@@ -0,0 +1,92 @@
+package naive
+
+import (
+	"fmt"
+	"simple-db/sql"
+	"strings"
+	"time"
+)
+
+// operators of the select, one per row. Analyze runs the query and adds what each
+// operator did, its inputs included
+func (e *ExecutionEngine) Explain(stmt sql.ExplainStatement) (_ QueryResult, err error) {
+	defer recoverEvalError(&err)
+	var plan *queryPlan
+	switch s := stmt.Statement.(type) {
+	case *sql.SelectStatement:
+		plan, err = e.planSelect(*s)
+	case *sql.CompoundSelectStatement:
+		plan, err = e.planCompound(*s)
+	default:
+		err = fmt.Errorf("only select statements can be explained, got %T", s)
+	}
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	root := e.physical(plan.node)
+	indented := func(o *operator, depth int) string {
+		return strings.Repeat("  ", depth) + o.describe()
+	}
+	if !stmt.Analyze {
+		out := QueryResult{Header: []FieldName{"plan"}}
+		root.walk(0, func(o *operator, depth int) {
+			out.Values = append(out.Values, []string{indented(o, depth)})
+		})
+		return out, nil
+	}
+
+	stats := map[*operator]*operatorStats{}
+	e.analyze(root, stats)
+	for range root.iter() {
+	}
+
+	out := QueryResult{Header: []FieldName{"plan", "rows", "pages", "time"}}
+	root.walk(0, func(o *operator, depth int) {
+		st := stats[o]
+		out.Values = append(out.Values, []string{indented(o, depth), fmt.Sprint(st.rows), fmt.Sprint(st.pages), st.elapsed.String()})
+	})
+	return out, nil
+}
+
+// what an operator did while the query ran, time and pages of its inputs are included.
+// Time the consumer of its rows spends on them is not
+type operatorStats struct {
+	rows    int
+	pages   int
+	elapsed time.Duration
+}
+
+// makes operator and its inputs collect stats while they run
+func (e *ExecutionEngine) analyze(o *operator, stats map[*operator]*operatorStats) {
+	st := &operatorStats{}
+	stats[o] = st
+	rows := o.rows
+	o.rows = func(inputs []RowIter) RowIter {
+		return e.measure(rows(inputs), st)
+	}
+	for _, in := range o.inputs {
+		e.analyze(in, stats)
+	}
+}
+
+// operators can be run more than once, e.g. inner side of nested loop, stats add up
+func (e *ExecutionEngine) measure(rows RowIter, st *operatorStats) RowIter {
+	return func(yield func(Row) bool) {
+		start, pages := time.Now(), e.storage.pagesRead
+		pause := func() {
+			st.elapsed += time.Since(start)
+			st.pages += e.storage.pagesRead - pages
+		}
+
+		for r := range rows {
+			st.rows++
+			pause()
+			if !yield(r) {
+				return
+			}
+			start, pages = time.Now(), e.storage.pagesRead
+		}
+		pause()
+	}
+}
@@ -0,0 +1,348 @@
+package naive
+
+import (
+	"fmt"
+	"iter"
+	"maps"
+	"simple-db/sql"
+	"slices"
+)
+
+// checks foreign keys of a table against tables they reference.
+// all has to contain the table itself, for self references
+func validateForeignKeys(table string, schema TableSchema, all Schema) error {
+	for _, fk := range schema.ForeignKeys {
+		idx := slices.Index(schema.FieldNames, FieldName(fk.Column))
+		if idx == -1 {
+			return fmt.Errorf("unknown column %q in foreign key of %v", fk.Column, table)
+		}
+
+		parent, ok := all[TableName(fk.RefTable)]
+		if !ok {
+			return fmt.Errorf("table %v referenced by %v.%v not found", fk.RefTable, table, fk.Column)
+		}
+		refIdx := slices.Index(parent.FieldNames, FieldName(fk.RefColumn))
+		if refIdx == -1 {
+			return fmt.Errorf("column %v.%v referenced by %v.%v not found", fk.RefTable, fk.RefColumn, table, fk.Column)
+		} else if c := parent.Constraints[FieldName(fk.RefColumn)]; !c.PrimaryKey && !c.Unique {
+			return fmt.Errorf("column %v.%v referenced by %v.%v must be primary key or unique", fk.RefTable, fk.RefColumn, table, fk.Column)
+		} else if parent.FieldsTypes[refIdx] != schema.FieldsTypes[idx] {
+			return fmt.Errorf("column %v.%v of type %v can't reference %v.%v of type %v",
+				table, fk.Column, schema.FieldsTypes[idx], fk.RefTable, fk.RefColumn, parent.FieldsTypes[refIdx])
+		}
+
+		c := schema.Constraints[FieldName(fk.Column)]
+		setsNull := fk.OnDelete == sql.ReferenceSetNull || fk.OnUpdate == sql.ReferenceSetNull
+		if setsNull && (c.NotNull || c.PrimaryKey) {
+			return fmt.Errorf("not null column %v.%v can't use set null action", table, fk.Column)
+		}
+	}
+	return nil
+}
+
+// tables other than the given one, with foreign keys referencing it
+func referencedBy(all Schema, table string) []string {
+	var out []string
+	for _, name := range slices.Sorted(maps.Keys(all)) {
+		if string(name) == table {
+			continue
+		}
+		for _, fk := range all[name].ForeignKeys {
+			if fk.RefTable == table {
+				out = append(out, string(name)+"."+fk.Column)
+			}
+		}
+	}
+	return out
+}
+
+// self references of a table, they follow renames of the table and its columns
+func foreignKeysOf(create *sql.CreateStatement) []*sql.ForeignKey {
+	var out []*sql.ForeignKey
+	for _, col := range create.Columns {
+		if col.Constraints.References != nil {
+			out = append(out, col.Constraints.References)
+		}
+	}
+	for i := range create.ForeignKeys {
+		out = append(out, &create.ForeignKeys[i])
+	}
+	return out
+}
+
+// changes of a single statement together with the ones made by foreign key actions.
+// Nothing is written until all of them are known and checked
+type changeSet struct {
+	e        *ExecutionEngine
+	schema   Schema
+	pending  map[TableName]map[RowID]pendingRow
+	inserted map[TableName][]Row
+}
+
+type pendingRow struct {
+	row   Row // nil for deleted rows
+	tuple Tuple
+}
+
+func (e *ExecutionEngine) newChangeSet() *changeSet {
+	return &changeSet{
+		e:        e,
+		schema:   e.Schema(),
+		pending:  map[TableName]map[RowID]pendingRow{},
+		inserted: map[TableName][]Row{},
+	}
+}
+
+// stored row with pending changes applied
+func (c *changeSet) current(table TableName, id RowID, tup Tuple) pendingRow {
+	if p, ok := c.pending[table][id]; ok {
+		return p
+	}
+	return pendingRow{c.e.parseTupleToRow(tup, c.schema[table]), tup}
+}
+
+// stored rows with the value in the column, that still have it after pending changes.
+// Rows are found by an index of the column when there is one
+func (c *changeSet) referencing(table TableName, column FieldName, v ColumnData) iter.Seq2[RowID, pendingRow] {
+	return func(yield func(RowID, pendingRow) bool) {
+		schema := c.schema[table]
+		for id := range c.e.rowsWithValues(schema, []FieldName{column}, []ColumnData{v}) {
+			tup, ok := c.e.storage.ReadTuple(schema.StartPage, id)
+			debugAssert(ok, "row %d of %v not found", id, table)
+			if p := c.current(table, id, *tup); p.row == nil || !sameValue(p.row[column], v) {
+				continue
+			} else if !yield(id, p) {
+				return
+			}
+		}
+	}
+}
+
+func (c *changeSet) insert(table TableName, r Row) {
+	c.inserted[table] = append(c.inserted[table], r)
+}
+
+// records a change of a row, new row is nil for deletes. Cascade and set null
+// actions of tables referencing it are applied right away, restrict is checked by verify
+func (c *changeSet) change(table TableName, id RowID, old Row, p pendingRow) error {
+	if cur, ok := c.pending[table][id]; ok && cur.row == nil {
+		return nil
+	} else if p.row != nil {
+		if err := checkRow(string(table), c.schema[table], p.row); err != nil {
+			return err
+		}
+	}
+	if c.pending[table] == nil {
+		c.pending[table] = map[RowID]pendingRow{}
+	}
+	c.pending[table][id] = p
+
+	for _, child := range slices.Sorted(maps.Keys(c.schema)) {
+		schema := c.schema[child]
+		for _, fk := range schema.ForeignKeys {
+			if TableName(fk.RefTable) != table {
+				continue
+			}
+
+			action := fk.OnDelete
+			if p.row != nil {
+				action = fk.OnUpdate
+			}
+			oldKey, newKey := old[FieldName(fk.RefColumn)], ColumnData{Null, nil}
+			if p.row != nil {
+				newKey = p.row[FieldName(fk.RefColumn)]
+			}
+			if action == sql.ReferenceRestrict || oldKey.Typ == Null || (p.row != nil && sameValue(oldKey, newKey)) {
+				continue
+			} else if action == sql.ReferenceSetNull {
+				newKey = ColumnData{Null, nil}
+			}
+
+			// collected first, matched rows are changed below
+			type match struct {
+				id RowID
+				p  pendingRow
+			}
+			var matches []match
+			for cid, cp := range c.referencing(child, FieldName(fk.Column), oldKey) {
+				matches = append(matches, match{cid, cp})
+			}
+
+			idx := slices.Index(schema.FieldNames, FieldName(fk.Column))
+			for _, m := range matches {
+				changed := pendingRow{}
+				if p.row != nil || action == sql.ReferenceSetNull {
+					tup, err := setColumn(m.p.tuple, schema, idx, newKey)
+					if err != nil {
+						return fmt.Errorf("column %q for %v: %w", fk.Column, child, err)
+					}
+					changed = pendingRow{maps.Clone(m.p.row), tup}
+					changed.row[FieldName(fk.Column)] = newKey
+				}
+				if err := c.change(child, m.id, m.p.row, changed); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// unique and foreign key constraints of changed tables, checked on their state after the change
+func (c *changeSet) verify() error {
+	changed := map[TableName]bool{}
+	for table := range c.pending {
+		changed[table] = true
+	}
+	for table := range c.inserted {
+		changed[table] = true
+	}
+
+	for _, table := range slices.Sorted(maps.Keys(changed)) {
+		if err := c.checkUnique(table); err != nil {
+			return err
+		}
+	}
+
+	// values of the column in changed rows, collected once per column
+	changedValues := map[FieldName]map[string]bool{}
+	hasValue := func(table TableName, column FieldName, v ColumnData) bool {
+		name := qualifiedName(string(table), column)
+		if changedValues[name] == nil {
+			changedValues[name] = map[string]bool{}
+			for _, r := range c.changedRows(table) {
+				changedValues[name][groupKey([]ColumnData{r[column]})] = true
+			}
+		}
+		if changedValues[name][groupKey([]ColumnData{v})] {
+			return true
+		}
+		for id := range c.e.rowsWithValues(c.schema[table], []FieldName{column}, []ColumnData{v}) {
+			if _, ok := c.pending[table][id]; !ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	// only changed rows are checked: new references need their parent key,
+	// parent keys that are gone can't be referenced by stored rows anymore
+	for _, table := range slices.Sorted(maps.Keys(c.schema)) {
+		for _, fk := range c.schema[table].ForeignKeys {
+			parent := TableName(fk.RefTable)
+			column, refColumn := FieldName(fk.Column), FieldName(fk.RefColumn)
+			violation := &ConstraintError{Kind: ForeignKeyConstraint, Table: string(table), Column: fk.Column}
+
+			for _, r := range c.changedRows(table) {
+				if v := r[column]; v.Typ != Null && !hasValue(parent, refColumn, v) {
+					return violation
+				}
+			}
+			for _, id := range slices.Sorted(maps.Keys(c.pending[parent])) {
+				p := c.pending[parent][id]
+				old := c.e.storedRow(c.schema[parent], id)[refColumn]
+				if old.Typ == Null || (p.row != nil && sameValue(p.row[refColumn], old)) || hasValue(parent, refColumn, old) {
+					continue
+				}
+				for range c.referencing(table, column, old) {
+					return violation
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// new and updated rows of the table
+func (c *changeSet) changedRows(table TableName) []Row {
+	var out []Row
+	for _, id := range slices.Sorted(maps.Keys(c.pending[table])) {
+		if r := c.pending[table][id].row; r != nil {
+			out = append(out, r)
+		}
+	}
+	return append(out, c.inserted[table]...)
+}
+
+// unique keys of changed rows are compared with each other, and looked up in stored rows.
+// Stored rows with pending changes don't count, their new version is one of the changed rows
+func (c *changeSet) checkUnique(table TableName) error {
+	schema := c.schema[table]
+	for _, k := range uniqueKeys(schema) {
+		seen := map[string]bool{}
+		for _, r := range c.changedRows(table) {
+			vals, ok := k.values(r)
+			if !ok {
+				continue
+			} else if key := groupKey(vals); seen[key] {
+				return k.err(string(table))
+			} else {
+				seen[key] = true
+			}
+
+			for id := range c.e.rowsWithValues(schema, k.columns, vals) {
+				if _, ok := c.pending[table][id]; !ok {
+					return k.err(string(table))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writes pending deletes and updates together with their index keys. Inserts are added by the statement itself
+func (c *changeSet) apply() error {
+	for _, table := range slices.Sorted(maps.Keys(c.pending)) {
+		for id, p := range c.pending[table] {
+			if p.row != nil {
+				continue
+			}
+			old := c.e.storedRow(c.schema[table], id)
+			if err := c.e.storage.DeleteTuple(string(table), id); err != nil {
+				return err
+			}
+			c.e.reindexRow(c.schema[table], id, old, nil)
+		}
+		for id, p := range c.pending[table] {
+			if p.row == nil {
+				continue
+			}
+			old := c.e.storedRow(c.schema[table], id)
+			if err := c.e.storage.UpdateTuple(string(table), id, p.tuple); err != nil {
+				return err
+			}
+			c.e.reindexRow(c.schema[table], id, old, p.row)
+		}
+	}
+	return nil
+}
+
+func sameValue(a, b ColumnData) bool {
+	return groupKey([]ColumnData{a}) == groupKey([]ColumnData{b})
+}
+
+// sets serialized value of i-th column. Untouched columns keep their raw bytes,
+// so overflow chains are not rewritten
+func setColumn(tup Tuple, schema TableSchema, i int, v ColumnData) (Tuple, error) {
+	colTyp, data, err := serializeColumn(schema.FieldsTypes[i], v)
+	if err != nil {
+		return tup, err
+	}
+
+	tup.ColumnTypes = slices.Clone(tup.ColumnTypes)
+	tup.ColumnDatas = slices.Clone(tup.ColumnDatas)
+	// tuples written before columns were added are shorter than the schema,
+	// missing columns get the values they were read with
+	for j := len(tup.ColumnTypes); j < len(schema.FieldNames); j++ {
+		padTyp, padData, err := serializeColumn(schema.FieldsTypes[j], addedColumnValue(schema, j))
+		if err != nil {
+			return tup, err
+		}
+		tup.ColumnTypes = append(tup.ColumnTypes, padTyp)
+		tup.ColumnDatas = append(tup.ColumnDatas, padData)
+	}
+	tup.NumberOfFields = int32(len(tup.ColumnTypes))
+	tup.ColumnTypes[i] = colTyp
+	tup.ColumnDatas[i] = data
+	return tup, nil
+}
@@ -0,0 +1,396 @@
+package naive
+
+import (
+	"bytes"
+	"fmt"
+	"iter"
+	"math"
+	"simple-db/sql"
+	"slices"
+	"strings"
+	"time"
+)
+
+// prefix of indexes backing primary key and unique columns, it can't be used by other indexes
+const implicitIndexPrefix = "autoindex_"
+
+func implicitIndexName(table, column string) string {
+	return implicitIndexPrefix + table + "_" + column
+}
+
+func isImplicitIndex(name string) bool {
+	return strings.HasPrefix(name, implicitIndexPrefix)
+}
+
+func (e *ExecutionEngine) CreateIndex(stmt sql.CreateIndexStatement) error {
+	if isImplicitIndex(stmt.Name) {
+		return fmt.Errorf("index name can't start with %q", implicitIndexPrefix)
+	}
+	return e.createIndex(stmt)
+}
+
+func (e *ExecutionEngine) createIndex(stmt sql.CreateIndexStatement) error {
+	if err := e.nameTaken(stmt.Name); err != nil {
+		return err
+	}
+	schema, ok := e.Schema()[TableName(stmt.Table)]
+	if !ok || stmt.Table == schemaName {
+		return fmt.Errorf("table %v not found", stmt.Table)
+	}
+
+	idx := IndexSchema{Name: stmt.Name, Unique: stmt.Unique}
+	for _, col := range stmt.Columns {
+		if !slices.Contains(schema.FieldNames, FieldName(col)) {
+			return fmt.Errorf("unknown column %q for %v", col, stmt.Table)
+		} else if slices.Contains(idx.Columns, FieldName(col)) {
+			return fmt.Errorf("column %q used more than once in index %v", col, stmt.Name)
+		}
+		idx.Columns = append(idx.Columns, FieldName(col))
+	}
+
+	// existing rows are checked before anything is written
+	key := uniqueKey{idx.Columns, UniqueConstraint}
+	seen := map[string]bool{}
+	var keys [][]byte
+	for id, tup := range e.storage.TuplesWithID(schema.StartPage) {
+		row := e.parseTupleToRow(tup, schema)
+		if err := checkIndexKey(stmt.Table, idx, row); err != nil {
+			return err
+		}
+		keys = append(keys, indexKey(idx, row, id))
+
+		if vals, ok := key.values(row); !idx.Unique || !ok {
+			continue
+		} else if k := groupKey(vals); seen[k] {
+			return key.err(stmt.Table)
+		} else {
+			seen[k] = true
+		}
+	}
+
+	rootID, _ := e.storage.AllocatePage(IndexLeafPageType)
+	tree := e.storage.indexTree(rootID)
+	for _, key := range keys {
+		debugAsserErr(tree.put(key, nil), "index key size should be checked")
+	}
+
+	sch := SchemaTuple{
+		PageTyp:        IndexLeafPageType,
+		StartingPageID: rootID,
+		Name:           stmt.Name,
+		SqlStatement:   stmt.String(),
+	}
+	_, err := e.storage.AddTuple(schemaName, sch.ToTuple())
+	return err
+}
+
+func (e *ExecutionEngine) DropIndex(stmt sql.DropIndexStatement) error {
+	_, sch, found := e.storage.findSchemaTuple(stmt.Name)
+	if !found || sch.PageTyp != IndexLeafPageType {
+		if stmt.IfExists {
+			return nil
+		}
+		return fmt.Errorf("index %v not found", stmt.Name)
+	} else if isImplicitIndex(stmt.Name) {
+		return fmt.Errorf("index %v backs a primary key or unique column, it can't be dropped", stmt.Name)
+	}
+	return e.storage.DropIndex(stmt.Name)
+}
+
+// tables and indexes share names, both are entries of the catalog
+func (e *ExecutionEngine) nameTaken(name string) error {
+	_, sch, found := e.storage.findSchemaTuple(name)
+	if !found {
+		return nil
+	} else if sch.PageTyp == IndexLeafPageType {
+		return fmt.Errorf("index %v already present", name)
+	}
+	return fmt.Errorf("table %v already present", name)
+}
+
+// index key of a row: encoded values of index columns followed by the row id,
+// which keeps keys of equal values distinct
+func indexKey(idx IndexSchema, r Row, id RowID) []byte {
+	var out []byte
+	for _, col := range idx.Columns {
+		out = appendIndexValue(out, r[col])
+	}
+	return append(out, rowIDKey(id)...)
+}
+
+func checkIndexKey(table string, idx IndexSchema, r Row) error {
+	if size := len(leafCell(indexKey(idx, r, 0), nil)); size > maxCellSize {
+		return fmt.Errorf("key of %d bytes is too big for index %v of %v, max is %d", size, idx.Name, table, maxCellSize)
+	}
+	return nil
+}
+
+// encodes value so encoded values compare bytewise in the same order as the values.
+// Nulls go before everything else
+func appendIndexValue(out []byte, d ColumnData) []byte {
+	if d.Typ == Null {
+		return append(out, 0)
+	}
+	out = append(out, 1)
+
+	orderedInt := func(i int64) []byte {
+		return endinanness.AppendUint64(out, uint64(i)^1<<63)
+	}
+	switch d.Typ {
+	case Int32:
+		return orderedInt(int64(d.Data.(int32)))
+	case Int64:
+		return orderedInt(d.Data.(int64))
+	case Date, Timestamp:
+		return orderedInt(d.Data.(time.Time).UnixMicro())
+	case Float:
+		f := d.Data.(float64)
+		if f == 0 {
+			f = 0 // negative zero is equal to zero
+		}
+		// negative numbers have all bits flipped, so bigger magnitude goes first
+		bits := math.Float64bits(f)
+		if bits&(1<<63) != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		return endinanness.AppendUint64(out, bits)
+	case Boolean:
+		return append(out, byte(boolToInt(d.Data.(bool))))
+	case String:
+		return appendIndexBytes(out, []byte(d.Data.(string)))
+	case Blob:
+		return appendIndexBytes(out, d.Data.([]byte))
+	}
+
+	debugAssert(false, "unsupported type for index: %v", d.Typ)
+	return out
+}
+
+// zero bytes are escaped and two zeros end the value, so a shorter value goes before the longer one
+func appendIndexBytes(out, b []byte) []byte {
+	for _, c := range b {
+		if c == 0 {
+			out = append(out, 0, 0xff)
+		} else {
+			out = append(out, c)
+		}
+	}
+	return append(out, 0, 0)
+}
+
+// ids of stored rows with given values of the columns, values can't be null.
+// Index starting with the columns is used when there is one, otherwise the table is scanned
+func (e *ExecutionEngine) rowsWithValues(schema TableSchema, columns []FieldName, values []ColumnData) iter.Seq[RowID] {
+	return func(yield func(RowID) bool) {
+		for _, idx := range schema.Indexes {
+			if len(idx.Columns) < len(columns) || !slices.Equal(idx.Columns[:len(columns)], columns) {
+				continue
+			}
+			var prefix []byte
+			for _, v := range values {
+				prefix = appendIndexValue(prefix, v)
+			}
+			for key := range e.storage.indexTree(idx.StartPage).ascend(prefix) {
+				if !bytes.HasPrefix(key, prefix) {
+					return
+				} else if !yield(rowIDFromKey(key[len(key)-rowIDKeySize:])) {
+					return
+				}
+			}
+			return
+		}
+
+		for id, tup := range e.storage.TuplesWithID(schema.StartPage) {
+			row := e.parseColumns(tup, schema, columns)
+			if slices.EqualFunc(columns, values, func(col FieldName, v ColumnData) bool { return sameValue(row[col], v) }) && !yield(id) {
+				return
+			}
+		}
+	}
+}
+
+// adds keys of a new row to indexes of its table
+func (e *ExecutionEngine) indexRow(schema TableSchema, id RowID, r Row) {
+	for _, idx := range schema.Indexes {
+		err := e.storage.indexTree(idx.StartPage).put(indexKey(idx, r, id), nil)
+		debugAsserErr(err, "index key size should be checked")
+	}
+}
+
+// stored version of a row, read before it's changed so its index keys can be removed
+func (e *ExecutionEngine) storedRow(schema TableSchema, id RowID) Row {
+	tup, ok := e.storage.ReadTuple(schema.StartPage, id)
+	debugAssert(ok, "row %d not found", id)
+	return e.parseTupleToRow(*tup, schema)
+}
+
+// replaces index keys of the old version of a row with keys of the new one, nil new row removes them
+func (e *ExecutionEngine) reindexRow(schema TableSchema, id RowID, old, newRow Row) {
+	for _, idx := range schema.Indexes {
+		tree := e.storage.indexTree(idx.StartPage)
+		oldKey := indexKey(idx, old, id)
+		if newRow != nil && bytes.Equal(oldKey, indexKey(idx, newRow, id)) {
+			continue
+		}
+		debugAssert(tree.delete(oldKey), "index %v corruption, key of row %d not found", idx.Name, id)
+		if newRow != nil {
+			debugAsserErr(tree.put(indexKey(idx, newRow, id), nil), "index key size should be checked")
+		}
+	}
+}
+
+// index keys starting with encoded values of equal leading columns,
+// with the next column between optional bounds
+type keyRange struct {
+	prefix       []byte
+	lower, upper *keyBound
+}
+
+type keyBound struct {
+	value     []byte // encoded
+	inclusive bool
+}
+
+// comparisons of a column with constants, taken from the predicate
+type columnBounds struct {
+	eq           []byte
+	lower, upper *keyBound
+}
+
+// operator with sides swapped, only ones that can be answered by an index
+var swappedComparisons = map[string]string{"=": "=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+// bounds of columns of the scanned table, from its conjuncts comparing them with constants
+func scanBounds(t scopedTable, conds []sql.Expression) map[FieldName]*columnBounds {
+	out := map[FieldName]*columnBounds{}
+	for _, cond := range conds {
+		infix, ok := cond.(*sql.InfixExpression)
+		if !ok {
+			continue
+		}
+		op, other := infix.Operator.Lexeme, infix.Right
+		col, ok := infix.Left.(sql.ColumnLiteral)
+		if !ok {
+			col, ok = infix.Right.(sql.ColumnLiteral)
+			op, other = swappedComparisons[op], infix.Left
+		}
+		if _, usable := swappedComparisons[op]; !ok || !usable || usesColumns(other) {
+			continue
+		}
+
+		// conjuncts pushed down to a scan use only columns of its table
+		column := col.Name.Lexeme
+		if table, name, ok := strings.Cut(column, "."); ok {
+			debugAssert(table == t.name, "column %v of other table in scan of %v", column, t.name)
+			column = name
+		}
+		constant, err := evalConstant(other)
+		if err != nil {
+			continue
+		}
+		v, ok := indexValue(constant, t.schema.FieldsTypes[slices.Index(t.schema.FieldNames, FieldName(column))])
+		if !ok {
+			continue
+		}
+
+		b := out[FieldName(column)]
+		if b == nil {
+			b = &columnBounds{}
+			out[FieldName(column)] = b
+		}
+		encoded := appendIndexValue(nil, v)
+		switch {
+		case op == "=" && b.eq == nil:
+			b.eq = encoded
+		case (op == ">" || op == ">=") && b.lower == nil:
+			b.lower = &keyBound{encoded, op == ">="}
+		case (op == "<" || op == "<=") && b.upper == nil:
+			b.upper = &keyBound{encoded, op == "<="}
+		}
+	}
+	return out
+}
+
+func conjuncts(pred sql.Expression) []sql.Expression {
+	if infix, ok := pred.(*sql.InfixExpression); ok && infix.Operator.Lexeme == "and" {
+		return append(conjuncts(infix.Left), conjuncts(infix.Right)...)
+	}
+	return []sql.Expression{pred}
+}
+
+// constant as a value of the column type. It's not possible when comparing them
+// needs a wider type, e.g. int column compared with a float
+func indexValue(d ColumnData, typ FieldType) (ColumnData, bool) {
+	if d.Typ == Null || (d.Typ == Float && typ != Float) || (d.Typ == Timestamp && typ == Date) {
+		return ColumnData{}, false
+	}
+	v, err := convertTo(d, typ)
+	return v, err == nil
+}
+
+// index with the most leading columns compared for equality, then with a range on the next one
+func chooseIndex(indexes []IndexSchema, bounds map[FieldName]*columnBounds) (IndexSchema, keyRange, bool) {
+	var best IndexSchema
+	var bestRange keyRange
+	bestScore := 0
+	for _, idx := range indexes {
+		r, score := keyRange{prefix: []byte{}}, 0
+		for _, col := range idx.Columns {
+			b := bounds[col]
+			if b == nil {
+				break
+			} else if b.eq != nil {
+				r.prefix = append(r.prefix, b.eq...)
+				score += 2
+				continue
+			} else if b.lower != nil || b.upper != nil {
+				r.lower, r.upper = b.lower, b.upper
+				score++
+			}
+			break
+		}
+		if score > bestScore {
+			best, bestRange, bestScore = idx, r, score
+		}
+	}
+	return best, bestRange, bestScore > 0
+}
+
+// rows with index keys in the range, in the index order
+func (e *ExecutionEngine) indexScan(t scopedTable, idx IndexSchema, r keyRange, columns []FieldName) RowIter {
+	withPrefix := func(b *keyBound) []byte {
+		return append(slices.Clone(r.prefix), b.value...)
+	}
+	// keys with null in the ranged column go first, they never match a comparison
+	from := append(slices.Clone(r.prefix), 1)
+	if r.lower != nil {
+		from = withPrefix(r.lower)
+	} else if r.upper == nil {
+		from = r.prefix
+	}
+
+	return func(yield func(Row) bool) {
+		for key := range e.storage.indexTree(idx.StartPage).ascend(from) {
+			if !bytes.HasPrefix(key, r.prefix) {
+				return
+			} else if r.lower != nil && !r.lower.inclusive && bytes.HasPrefix(key, from) {
+				continue
+			} else if r.upper != nil {
+				// keys of values equal to the bound start with it
+				upper := withPrefix(r.upper)
+				if c := bytes.Compare(key, upper); c >= 0 && (!r.upper.inclusive || !bytes.HasPrefix(key, upper)) {
+					return
+				}
+			}
+
+			id := rowIDFromKey(key[len(key)-rowIDKeySize:])
+			tup, ok := e.storage.ReadTuple(t.schema.StartPage, id)
+			debugAssert(ok, "index %v corruption, row %d not found", idx.Name, id)
+			if !yield(qualify(t.name, e.parseColumns(*tup, t.schema, columns))) {
+				return
+			}
+		}
+	}
+}
@@ -1,50 +1,396 @@
 package naive
 
 import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"iter"
+	"slices"
 )
 
 // sequential number to identify log records
 type LSN int32
-type Log struct {
-	p       *GenericPage
-	lastLsn LSN
+
+// transaction that made the change, 0 when there is none
+type TxID int32
+
+type LogKind int32
+
+const (
+	LogUpdate       LogKind = iota // page change, with images to redo and undo it
+	LogCommit                      // transaction finished, its changes have to survive
+	LogAbort                       // transaction finished, all its changes were undone
+	LogCompensation                // undo of an update, redone but never undone itself
+)
+
+// what the change does to the page. Slotted pages are changed cell by cell, other pages,
+// like the root, overflow and free pages, and pages changing between the two get whole images
+type ChangeKind int32
+
+const (
+	ChangeInsert  ChangeKind = iota // After is inserted at the slot
+	ChangeDelete                    // Before is removed from the slot
+	ChangeReplace                   // Before at the slot is replaced by After
+	ChangeHeader                    // type and next page of a slotted page
+	ChangeImage                     // whole page, images end with its last non-zero byte
+)
+
+// single change of a page, images are cells, headers or pages depending on the kind
+type PageChange struct {
+	Kind   ChangeKind
+	Slot   int32
+	Before []byte
+	After  []byte
 }
 
+// change undoing this one
+func (c PageChange) inverse() PageChange {
+	inv := PageChange{Kind: c.Kind, Slot: c.Slot, Before: c.After, After: c.Before}
+	switch c.Kind {
+	case ChangeInsert:
+		inv.Kind = ChangeDelete
+	case ChangeDelete:
+		inv.Kind = ChangeInsert
+	}
+	return inv
+}
+
+// physiological record, changes of a single page. Cells of slotted pages are changed by their slot,
+// so redo and undo don't depend on where the cells are stored within the page
 type LogEntry struct {
-	lsn LSN
-	//... page/slot []change
-	// []table-columns-change
+	LSN     LSN
+	PrevLSN LSN // previous record of the same transaction, 0 for the first one
+	TxID    TxID
+	Kind    LogKind
+	Page    PageID
+	Changes []PageChange // applied in order
+
+	UndoNext LSN // next record of the transaction to undo after compensation, 0 when there is none
 }
 
 func (le LogEntry) Serialize() []byte {
-	// todo: implement log entry and serialization
-	return nil
+	return SerializeStruct(&le,
+		WithInt(func(le *LogEntry) int32 { return int32(le.LSN) }),
+		WithInt(func(le *LogEntry) int32 { return int32(le.PrevLSN) }),
+		WithInt(func(le *LogEntry) int32 { return int32(le.TxID) }),
+		WithInt(func(le *LogEntry) int32 { return int32(le.Kind) }),
+		WithInt(func(le *LogEntry) int32 { return int32(le.Page) }),
+		WithInt(func(le *LogEntry) int32 { return int32(le.UndoNext) }),
+		WithInt(func(le *LogEntry) int32 { return int32(len(le.Changes)) }),
+		func(le *LogEntry, b *bytes.Buffer) {
+			for _, c := range le.Changes {
+				b.Write(SerializeInt(int32(c.Kind)))
+				b.Write(SerializeInt(c.Slot))
+				b.Write(SerializeBytes(c.Before))
+				b.Write(SerializeBytes(c.After))
+			}
+		},
+	)
 }
 
 func DeserializeLogEntry(d []byte) (LogEntry, error) {
-	// todo
-	return LogEntry{}, nil
+	var changes int32
+	le, err := DeserializeStruct(bytes.NewReader(d),
+		DeserWithInt("lsn", func(le *LogEntry, i *int32) { le.LSN = LSN(*i) }),
+		DeserWithInt("prev lsn", func(le *LogEntry, i *int32) { le.PrevLSN = LSN(*i) }),
+		DeserWithInt("transaction", func(le *LogEntry, i *int32) { le.TxID = TxID(*i) }),
+		DeserWithInt("kind", func(le *LogEntry, i *int32) { le.Kind = LogKind(*i) }),
+		DeserWithInt("page", func(le *LogEntry, i *int32) { le.Page = PageID(*i) }),
+		DeserWithInt("undo next", func(le *LogEntry, i *int32) { le.UndoNext = LSN(*i) }),
+		DeserWithInt("changes", func(_ *LogEntry, i *int32) { changes = *i }),
+		func(le *LogEntry, r io.Reader) error {
+			for range changes {
+				var c PageChange
+				kind, err := ReadInt(r)
+				if err != nil {
+					return fmt.Errorf("change kind: %w", err)
+				}
+				c.Kind = ChangeKind(kind)
+				if c.Slot, err = ReadInt(r); err != nil {
+					return fmt.Errorf("change slot: %w", err)
+				} else if c.Before, err = ReadBytes(r); err != nil {
+					return fmt.Errorf("before image: %w", err)
+				} else if c.After, err = ReadBytes(r); err != nil {
+					return fmt.Errorf("after image: %w", err)
+				}
+				le.Changes = append(le.Changes, c)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return LogEntry{}, err
+	}
+	return *le, nil
 }
 
-func NewLog(p *GenericPage) *Log {
-	return &Log{
-		p: p,
+// changes turning the page into the new one. Cells before the first and after the last different one
+// are kept, the ones in between are replaced and the rest is deleted or inserted. LSN of the page isn't compared
+func pageChanges(before, after []byte) []PageChange {
+	old, oldSlotted := slottedPage(before)
+	cur, curSlotted := slottedPage(after)
+	if !oldSlotted || !curSlotted {
+		if bytes.Equal(before, after) {
+			return nil
+		}
+		return []PageChange{{Kind: ChangeImage, Before: pageImageBytes(before), After: pageImageBytes(after)}}
+	}
+
+	var out []PageChange
+	if old.Header.PageTyp != cur.Header.PageTyp || old.Header.NextPage != cur.Header.NextPage {
+		out = append(out, PageChange{Kind: ChangeHeader, Before: headerImage(old.Header), After: headerImage(cur.Header)})
 	}
+
+	n, m := old.cellCount(), cur.cellCount()
+	prefix, suffix := 0, 0
+	for prefix < min(n, m) && bytes.Equal(old.cell(prefix), cur.cell(prefix)) {
+		prefix++
+	}
+	for suffix < min(n, m)-prefix && bytes.Equal(old.cell(n-1-suffix), cur.cell(m-1-suffix)) {
+		suffix++
+	}
+	replaced := min(n, m) - prefix - suffix
+	for i := prefix; i < prefix+replaced; i++ {
+		if b, a := old.cell(i), cur.cell(i); !bytes.Equal(b, a) {
+			out = append(out, PageChange{Kind: ChangeReplace, Slot: int32(i), Before: b, After: a})
+		}
+	}
+	for i := prefix + replaced; i < n-suffix; i++ {
+		out = append(out, PageChange{Kind: ChangeDelete, Slot: int32(prefix + replaced), Before: old.cell(i)})
+	}
+	for i := prefix + replaced; i < m-suffix; i++ {
+		out = append(out, PageChange{Kind: ChangeInsert, Slot: int32(i), After: cur.cell(i)})
+	}
+	return out
+}
+
+// bytes of the page up to its last non-zero one, the rest of the page is zeroed
+func pageImageBytes(data []byte) []byte {
+	return bytes.Clone(bytes.TrimRight(data, "\x00"))
+}
+
+func headerImage(h GenericPageHeader) []byte {
+	return append(SerializeInt(int32(h.PageTyp)), SerializeInt(int32(h.NextPage))...)
 }
 
+// write-ahead log, every page change is appended before the page is written.
+// Log is a stream of bytes kept in log pages chained by NextPage, starting with page 0.
+// Stream starts with the LSN of its first record, records follow with their length and checksum.
+// SlotArraySize of the log page is the number of its used bytes. Only the last written page
+// and records appended after it are kept in memory, older records are read back from the pages
+type Log struct {
+	pages   pager
+	first   LSN    // LSN of the first record since the log was truncated
+	offsets []int  // where records start in the stream, by LSN
+	start   int    // offset of the buffer in the stream, beginning of the last written page
+	stream  []byte // buffer with the end of the stream
+	written int    // bytes of the stream in pages
+	lastLsn LSN
+}
+
+const logPageData = PageSize - genericHeaderSize
+
+// appended records kept in memory at most, bigger buffer is written to the log pages
+const logBufferSize = 16 * PageSize
+
+// reads bytes of the stream from the log pages, keeping the last page it read
+type logReader struct {
+	pages pager
+	id    PageID
+	data  []byte
+}
+
+func (r *logReader) read(off, n int) []byte {
+	out := make([]byte, 0, n)
+	for n > 0 {
+		if id := PageID(off / logPageData); r.data == nil || id != r.id {
+			data, ok := r.pages.read(id)
+			debugAssert(ok, "log page %d not found", id)
+			// pager may reuse the memory it returned
+			r.id, r.data = id, bytes.Clone(data)
+		}
+		within := off % logPageData
+		chunk := r.data[PageSize-logPageData+within:][:min(n, logPageData-within)]
+		out = append(out, chunk...)
+		off, n = off+len(chunk), n-len(chunk)
+	}
+	return out
+}
+
+// reads records back from the pages. Stream ends with the first record that is cut off,
+// doesn't match its checksum or doesn't follow the previous LSN, e.g. after a crash during a flush
+func openLog(p pager) (*Log, error) {
+	l := &Log{pages: p}
+	// every page of the stream is full except the last one
+	size := 0
+	for id := PageID(0); ; id++ {
+		data, ok := p.read(id)
+		if !ok {
+			break
+		}
+		header, err := DeserializeGenericHeader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("log page %d: %w", id, err)
+		} else if header.PageTyp != LogPageType {
+			return nil, fmt.Errorf("page %d is not a log page, got page type %d", id, header.PageTyp)
+		} else if header.SlotArraySize < 0 || header.SlotArraySize > logPageData {
+			return nil, fmt.Errorf("log page %d has %d bytes used", id, header.SlotArraySize)
+		} else if header.NextPage != 0 && header.NextPage != id+1 {
+			return nil, fmt.Errorf("log page %d links to page %d", id, header.NextPage)
+		}
+		size += int(header.SlotArraySize)
+		if header.NextPage == 0 || header.SlotArraySize < logPageData {
+			break
+		}
+	}
+
+	if size < 4 {
+		l.first, l.stream = 1, SerializeInt(1)
+		return l, nil
+	}
+	r := &logReader{pages: p}
+	l.first = LSN(endinanness.Uint32(r.read(0, 4)))
+	l.lastLsn = l.first - 1
+	end := 4
+	for end+8 <= size {
+		n := int(endinanness.Uint32(r.read(end, 4)))
+		if n > size-end-8 {
+			break
+		}
+		payload, sum := r.read(end+4, n), endinanness.Uint32(r.read(end+4+n, 4))
+		if crc32.ChecksumIEEE(payload) != sum {
+			break
+		}
+		e, err := DeserializeLogEntry(payload)
+		if err != nil || e.LSN != l.lastLsn+1 {
+			break
+		}
+
+		l.offsets = append(l.offsets, end)
+		l.lastLsn = e.LSN
+		end += n + 8
+	}
+	// records after the end are overwritten by the next write
+	l.start = (end - 1) / logPageData * logPageData
+	l.stream = r.read(l.start, end-l.start)
+	l.written = end
+	return l, nil
+}
+
+// assigns LSN to the entry, it's durable after the next flush
 func (l *Log) Append(entry LogEntry) LSN {
-	// todo
 	l.lastLsn++
+	entry.LSN = l.lastLsn
+	payload := entry.Serialize()
+	l.offsets = append(l.offsets, l.start+len(l.stream))
+	l.stream = append(l.stream, SerializeBytes(payload)...)
+	l.stream = endinanness.AppendUint32(l.stream, crc32.ChecksumIEEE(payload))
 	return l.lastLsn
 }
 
+// bytes of records appended since the last write
+func (l *Log) buffered() int {
+	return l.start + len(l.stream) - l.written
+}
+
+// record starting at the offset, from the buffer or the pages
+func (l *Log) record(r *logReader, off int) LogEntry {
+	var payload []byte
+	if off >= l.start {
+		data := l.stream[off-l.start:]
+		payload = data[4:][:endinanness.Uint32(data)]
+	} else {
+		payload = r.read(off+4, int(endinanness.Uint32(r.read(off, 4))))
+	}
+	return must(DeserializeLogEntry(payload))
+}
+
+// record with given LSN, if it wasn't truncated yet
+func (l *Log) entry(lsn LSN) (LogEntry, bool) {
+	i := int(lsn - l.first)
+	if i < 0 || i >= len(l.offsets) {
+		return LogEntry{}, false
+	}
+	return l.record(&logReader{pages: l.pages}, l.offsets[i]), true
+}
+
+// records since the log was truncated, oldest first
 func (l *Log) Iterator() iter.Seq[LogEntry] {
 	return func(yield func(LogEntry) bool) {
-		// for range s.iter().NewEntityIterator(LogPageType, "wal_log") {
-		// 	if !yield(LogEntry{}) {
-		// 		return
-		// 	}
-		// }
+		r := &logReader{pages: l.pages}
+		for i := range len(l.offsets) {
+			if !yield(l.record(r, l.offsets[i])) {
+				return
+			}
+		}
+	}
+}
+
+// records since the log was truncated, newest first
+func (l *Log) Backward() iter.Seq[LogEntry] {
+	return func(yield func(LogEntry) bool) {
+		r := &logReader{pages: l.pages}
+		for i := len(l.offsets) - 1; i >= 0; i-- {
+			if !yield(l.record(r, l.offsets[i])) {
+				return
+			}
+		}
+	}
+}
+
+// writes appended records to the pages, they are durable after the pages are flushed
+func (l *Log) write() error {
+	end := l.start + len(l.stream)
+	if l.written == end {
+		return nil
+	}
+
+	// last written page gets new records, or at least the link to the next page
+	first, last := l.start/logPageData, (end-1)/logPageData
+	for i := first; i <= last; i++ {
+		chunk := l.stream[i*logPageData-l.start : min((i+1)*logPageData, end)-l.start]
+		p := OverflowPage{
+			Header: GenericPageHeader{PageTyp: LogPageType, SlotArraySize: int32(len(chunk))},
+			Data:   make([]byte, logPageData),
+		}
+		if i < last {
+			p.Header.NextPage = PageID(i + 1)
+		}
+		copy(p.Data, chunk)
+		if err := l.pages.write(PageID(i), p.Serialize()); err != nil {
+			return fmt.Errorf("writing log page %d: %w", i, err)
+		}
+	}
+	l.written = end
+	l.stream = slices.Clone(l.stream[last*logPageData-l.start:])
+	l.start = last * logPageData
+	return nil
+}
+
+// writes appended records to the pages and makes them durable
+func (l *Log) flush() error {
+	if err := l.write(); err != nil {
+		return err
+	}
+	return l.pages.flush()
+}
+
+// drops all records, once every page they changed is durable. LSNs keep growing
+func (l *Log) truncate() error {
+	if len(l.offsets) == 0 {
+		return nil
+	}
+	l.first, l.offsets = l.lastLsn+1, nil
+	l.start, l.written = 0, 0
+	l.stream = SerializeInt(int32(l.first))
+	return l.flush()
+}
+
+func (l *Log) close() error {
+	err := l.flush()
+	if closeErr := l.pages.close(); err == nil {
+		err = closeErr
 	}
+	return err
 }
@@ -1,9 +1,12 @@
 package naive
 
 import (
+	"encoding/hex"
 	"fmt"
+	"math"
 	"simple-db/sql"
 	"strconv"
+	"time"
 )
 
 // top level utils types
@@ -20,6 +23,10 @@ const (
 	String
 	Boolean
 	Float
+	Int64
+	Blob
+	Date      // time.Time at midnight UTC
+	Timestamp // time.Time in UTC, microsecond precision
 )
 
 func (f FieldType) String() string {
@@ -29,6 +36,10 @@ func (f FieldType) String() string {
 		"String",
 		"Boolean",
 		"Float",
+		"Int64",
+		"Blob",
+		"Date",
+		"Timestamp",
 	}[f]
 }
 
@@ -44,6 +55,14 @@ func FieldTypeFromString(s string) (FieldType, error) {
 		return Boolean, nil
 	case "float":
 		return Float, nil
+	case "bigint":
+		return Int64, nil
+	case "blob":
+		return Blob, nil
+	case "date":
+		return Date, nil
+	case "timestamp":
+		return Timestamp, nil
 	default:
 		return 0, fmt.Errorf("invalid type %v", s)
 	}
@@ -64,14 +83,100 @@ func ParseExpressionValueToType(providedValue sql.Expression, fieldTyp FieldType
 			return strconv.ParseBool(v.Tok.Lexeme)
 		case Float:
 			return strconv.ParseFloat(v.Tok.Lexeme, 64)
+		case Int64:
+			return strconv.ParseInt(v.Tok.Lexeme, 10, 64)
+		case Blob:
+			if v.Tok.Typ != sql.Blob {
+				return nil, fmt.Errorf("expected blob literal, got %v", v)
+			}
+			return hex.DecodeString(v.Tok.Lexeme)
+		case Date:
+			return parseDate(v.Tok.Lexeme)
+		case Timestamp:
+			return parseTimestamp(v.Tok.Lexeme)
 		default:
 			return nil, fmt.Errorf("invalid data type %v", fieldTyp)
 		}
 	case sql.NullLiteral:
 		return nil, nil
 	default:
-		panic(fmt.Sprintf("todo expression type for insert: %T", v))
+		// computed values, like 2 * 3
+		got, err := evalConstant(providedValue)
+		if err != nil {
+			return nil, err
+		}
+		got, err = convertTo(got, fieldTyp)
+		if err != nil {
+			return nil, err
+		}
+		return got.Data, nil
+	}
+}
+
+// converts value to the type of the column. Numbers are widened, or narrowed when they fit,
+// strings are parsed into dates and timestamps
+func convertTo(d ColumnData, fieldTyp FieldType) (ColumnData, error) {
+	if d.Typ == Null || d.Typ == fieldTyp {
+		return d, nil
+	}
+
+	switch {
+	case fieldTyp == Float && (d.Typ == Int32 || d.Typ == Int64):
+		f, _ := toFloat(d)
+		return ColumnData{Float, f}, nil
+	case fieldTyp == Int64 && d.Typ == Int32:
+		return ColumnData{Int64, int64(d.Data.(int32))}, nil
+	case fieldTyp == Int32 && d.Typ == Int64:
+		i := d.Data.(int64)
+		if i > math.MaxInt32 || i < math.MinInt32 {
+			return ColumnData{}, fmt.Errorf("integer %d out of range for %v", i, fieldTyp)
+		}
+		return ColumnData{Int32, int32(i)}, nil
+	case fieldTyp == Date && d.Typ == String:
+		t, err := parseDate(d.Data.(string))
+		return ColumnData{Date, t}, err
+	case fieldTyp == Timestamp && d.Typ == String:
+		t, err := parseTimestamp(d.Data.(string))
+		return ColumnData{Timestamp, t}, err
+	case fieldTyp == Timestamp && d.Typ == Date:
+		return ColumnData{Timestamp, d.Data}, nil
+	}
+	return ColumnData{}, fmt.Errorf("type mismatch, expected %v, got %v", fieldTyp, d.Typ)
+}
+
+const secondsPerDay = 24 * 60 * 60
+const dateLayout = "2006-01-02"
+const timestampLayout = "2006-01-02 15:04:05.999999"
+
+func parseDate(s string) (time.Time, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// accepts "2024-01-31 10:00:00", with optional fraction of a second, RFC 3339 or just a date
+func parseTimestamp(s string) (time.Time, error) {
+	for _, layout := range []string{timestampLayout, time.RFC3339Nano, dateLayout} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC().Truncate(time.Microsecond), nil
+		}
 	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q, expected YYYY-MM-DD HH:MM:SS", s)
+}
+
+// text representation of the value in query results
+func formatValue(d ColumnData) string {
+	switch d.Typ {
+	case Blob:
+		return "x'" + hex.EncodeToString(d.Data.([]byte)) + "'"
+	case Date:
+		return d.Data.(time.Time).Format(dateLayout)
+	case Timestamp:
+		return d.Data.(time.Time).Format(timestampLayout)
+	}
+	return fmt.Sprint(d.Data)
 }
 
 type ColumnData struct {
@@ -87,6 +192,18 @@ type TableSchema struct {
 	FieldNames  []FieldName
 	StartPage   PageID
 	PageTyp     PageType
+	Constraints map[FieldName]sql.ColumnConstraints // only columns that have any
+	ForeignKeys []sql.ForeignKey                    // both column and table level ones, with Column set
+	Indexes     []IndexSchema
+}
+
+// index of a table, stored in its own b+tree
+type IndexSchema struct {
+	Name      string
+	Columns   []FieldName
+	Unique    bool
+	StartPage PageID
+	Implicit  bool // backs a primary key or unique column, it's created and dropped with the column
 }
 type Schema map[TableName]TableSchema
 
@@ -97,6 +214,28 @@ func must[T any](v T, err error) T {
 	return v
 }
 
+// error found while evaluating rows inside operators, or by the buffer pool while reading and writing
+// pages. Iterators can't return errors, so they panic with it and the engine turns it back into an error
+// at the statement boundary
+type evalError struct {
+	err error
+}
+
+func raise(format string, args ...any) {
+	panic(evalError{fmt.Errorf(format, args...)})
+}
+
+func recoverEvalError(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	} else if e, ok := r.(evalError); ok {
+		*err = e.err
+		return
+	}
+	panic(r)
+}
+
 func debugAssert(expectTrue bool, format string, args ...any) {
 	if assertionsEnabled && !expectTrue {
 		panic(fmt.Sprintf(format, args...))
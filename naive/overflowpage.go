@@ -18,7 +18,7 @@ func NewOverflowPage(pageSize int, data []byte) (page *OverflowPage, rest []byte
 			NextPage:      0, // next pageID
 			SlotArraySize: 0, // not used
 		},
-		Data: make([]byte, pageSize-4-4-4), //12 bytes for header
+		Data: make([]byte, pageSize-genericHeaderSize),
 	}
 
 	if len(data) >= len(page.Data) {
@@ -36,6 +36,7 @@ func (o *OverflowPage) Serialize() []byte {
 		WithInt(func(g *OverflowPage) int32 { return int32(g.Header.PageTyp) }),
 		WithInt(func(g *OverflowPage) int32 { return int32(g.Header.NextPage) }),
 		WithInt(func(g *OverflowPage) int32 { return int32(g.Header.SlotArraySize) }),
+		WithInt(func(g *OverflowPage) int32 { return int32(g.Header.PageLSN) }),
 		func(g *OverflowPage, b *bytes.Buffer) {
 			b.Write(g.Data)
 		},
@@ -46,7 +47,7 @@ func (o *OverflowPage) Serialize() []byte {
 }
 
 func DeserializeOverflowPage(header *GenericPageHeader, r io.Reader) (*OverflowPage, error) {
-	buf := make([]byte, PageSize-4-4-4) //12 bytes for header
+	buf := make([]byte, PageSize-genericHeaderSize)
 	got, err := r.Read(buf)
 	if err != nil {
 		return nil, fmt.Errorf("error reading overflow page: %w", err)
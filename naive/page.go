@@ -5,39 +5,48 @@ import (
 	"fmt"
 	"io"
 	"iter"
+	"slices"
 )
 
 type PageType int32
 
 const (
 	RootPageType PageType = iota
-	DataPageType
+	_                     // heap pages of tables before they were stored in b+trees, kept so other values don't change
 	OverflowPageType
 	LogPageType
+	FreePageType
+	TableInteriorPageType
+	TableLeafPageType
+	IndexInteriorPageType
+	IndexLeafPageType
+	BTreeInteriorPageType // nodes of btree.BTree, they are not read by naive
+	BTreeLeafPageType
 )
 
 type PageID int32
 type PageOffset int32
 
-type SlotIdx int
-
 type GenericPageHeader struct {
 	PageTyp       PageType
 	NextPage      PageID
 	SlotArraySize int32 // int32 might be too big, leave for now
+	PageLSN       LSN   // last log record that changed the page, set when the page is persisted
 }
 
+const genericHeaderSize = 4 * 4
+
+// slotted page of cells. Cells are kept ordered in the slot array, their content is opaque to the page
 type GenericPage struct {
 	Header GenericPageHeader
 
-	// slots for tuples
-	Indexes    []PageOffset // RowId -> offset within page
+	Indexes    []PageOffset // slot -> offset of the cell within page
 	CellData   []byte
 	lastOffset PageOffset
 }
 
 func NewPage(pageType PageType, pageSize int) *GenericPage {
-	slotsSize := pageSize - 4 - 4 - 4 // generic size header
+	slotsSize := pageSize - genericHeaderSize
 
 	return &GenericPage{
 		Header: GenericPageHeader{
@@ -53,67 +62,81 @@ var errNoSpace = fmt.Errorf("no space in slot array")
 
 const rowIdSize = 4
 
-func (g *GenericPage) Add(t Tuple) (SlotIdx, error) {
-	buf := t.Serialize()
-	bytesWithHeader := SerializeBytes(buf)
-	ln := len(bytesWithHeader)
+// moves cells to the end of the page, so space left by removed and replaced cells can be used again
+func (g *GenericPage) compact() {
+	newCells := make([]byte, len(g.CellData))
+	offset := len(newCells)
 
-	if !g.hasSpace(ln) {
-		return 0, errNoSpace
+	for i, cellOffset := range g.Indexes {
+		raw := must(DeserializeBytes(BytesWithHeader(g.CellData[cellOffset:])))
+		offset -= len(raw) + 4
+		copy(newCells[offset:], SerializeBytes(raw))
+		g.Indexes[i] = PageOffset(offset)
 	}
-	copy(g.CellData[int(g.lastOffset)-ln:], bytesWithHeader)
-	g.lastOffset -= PageOffset(ln)
 
-	g.Indexes = append(g.Indexes, g.lastOffset)
+	g.CellData = newCells
+	g.lastOffset = PageOffset(offset)
+}
 
-	idx := SlotIdx(len(g.Indexes) - 1)
+func (g *GenericPage) cellCount() int {
+	return len(g.Indexes)
+}
 
-	g.Header.SlotArraySize = int32(len(g.Indexes))
-	return idx, nil
+func (g *GenericPage) cell(i int) []byte {
+	return must(DeserializeBytes(BytesWithHeader(g.CellData[g.Indexes[i]:])))
 }
 
-func (g *GenericPage) Read(idx SlotIdx) (*Tuple, error) {
-	if int(idx) >= len(g.Indexes) {
-		return nil, fmt.Errorf("invalid idx %d, got only %d", idx, len(g.Indexes))
+func (g *GenericPage) insertCell(i int, cell []byte) error {
+	bytesWithHeader := SerializeBytes(cell)
+	needed := len(bytesWithHeader) + rowIdSize
+	if !g.hasSpace(needed) {
+		g.compact()
+		if !g.hasSpace(needed) {
+			return errNoSpace
+		}
 	}
 
-	offset := g.Indexes[idx]
-	rawBytes, err := DeserializeBytes(BytesWithHeader(g.CellData[offset:]))
-	if err != nil {
-		return nil, err
-	}
-	return DeserializeTuple(rawBytes)
+	copy(g.CellData[int(g.lastOffset)-len(bytesWithHeader):], bytesWithHeader)
+	g.lastOffset -= PageOffset(len(bytesWithHeader))
+	g.Indexes = slices.Insert(g.Indexes, i, g.lastOffset)
+	g.Header.SlotArraySize = int32(len(g.Indexes))
+	return nil
 }
 
-func (g *GenericPage) Put(id SlotIdx, t Tuple) error {
-	if int(id) >= len(g.Indexes) {
-		return fmt.Errorf("invalid idx %d, got only %d", id, len(g.Indexes))
-	}
+// space of the cell is reclaimed by the next compaction
+func (g *GenericPage) removeCell(i int) {
+	g.Indexes = slices.Delete(g.Indexes, i, i+1)
+	g.Header.SlotArraySize = int32(len(g.Indexes))
+}
 
-	offset := g.Indexes[id]
-	existing, err := DeserializeBytes(BytesWithHeader(g.CellData[offset:]))
-	if err != nil {
-		return err
-	}
-	buf := t.Serialize()
-	if len(buf) <= len(existing) {
-		bytesWithHeader := SerializeBytes(buf)
-		offset := g.Indexes[id]
-		copy(g.CellData[offset:], bytesWithHeader)
+func (g *GenericPage) replaceCell(i int, cell []byte) error {
+	g.removeCell(i)
+	return g.insertCell(i, cell)
+}
 
-		return nil
-	}
+// adds the cell after the last one, for content stored outside of naive
+func (g *GenericPage) AppendCell(cell []byte) error {
+	return g.insertCell(g.cellCount(), cell)
+}
 
-	newRowId, err := g.Add(t)
-	if err != nil {
-		return err
+// cells in slot order
+func (g *GenericPage) Cells() iter.Seq[[]byte] {
+	return func(yield func([]byte) bool) {
+		for i := range g.cellCount() {
+			if !yield(g.cell(i)) {
+				return
+			}
+		}
 	}
-	g.Indexes[id] = g.Indexes[newRowId]
-	g.Indexes[newRowId] = -1 // tombstone value
+}
 
-	g.Header.SlotArraySize = int32(len(g.Indexes))
-	return nil
-	// todo: reclaim page space
+// bytes taken by live cells and their slots
+func (g *GenericPage) usedSpace() int {
+	used := 0
+	for i := range g.Indexes {
+		used += len(g.cell(i)) + 4 + rowIdSize
+	}
+	return used
 }
 
 func DeserializeGenericHeader(r io.Reader) (*GenericPageHeader, error) {
@@ -121,6 +144,7 @@ func DeserializeGenericHeader(r io.Reader) (*GenericPageHeader, error) {
 		DeserWithInt("page type", func(t *GenericPageHeader, i *int32) { t.PageTyp = PageType(*i) }),
 		DeserWithInt("next page", func(t *GenericPageHeader, i *int32) { t.NextPage = PageID(*i) }),
 		DeserWithInt("slot array size", func(t *GenericPageHeader, i *int32) { t.SlotArraySize = *i }),
+		DeserWithInt("page lsn", func(t *GenericPageHeader, i *int32) { t.PageLSN = LSN(*i) }),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error deserializing page header: %w", err)
@@ -133,6 +157,7 @@ func (g *GenericPage) Serialize() []byte {
 		WithInt(func(g *GenericPage) int32 { return int32(g.Header.PageTyp) }),
 		WithInt(func(g *GenericPage) int32 { return int32(g.Header.NextPage) }),
 		WithInt(func(g *GenericPage) int32 { return int32(g.Header.SlotArraySize) }),
+		WithInt(func(g *GenericPage) int32 { return int32(g.Header.PageLSN) }),
 		func(g *GenericPage, b *bytes.Buffer) {
 			for _, id := range g.Indexes {
 				b.Write(SerializeInt(int32(id)))
@@ -161,7 +186,6 @@ func DeserializeGenericPage(header *GenericPageHeader, r io.Reader) (*GenericPag
 		}
 		ithPageOffset := PageOffset(i)
 		p.Indexes = append(p.Indexes, ithPageOffset)
-
 		lastOffset = min(lastOffset, int(ithPageOffset))
 	}
 	p.lastOffset = PageOffset(lastOffset)
@@ -173,19 +197,25 @@ func DeserializeGenericPage(header *GenericPageHeader, r io.Reader) (*GenericPag
 	return p, nil
 }
 
-func (g *GenericPage) hasSpace(newData int) bool {
-	return int(g.lastOffset)-newData-(len(g.Indexes)*rowIdSize) > 0
+// same as the page deserialized from its bytes, space freed by removed cells is zeroed
+func (g *GenericPage) clone() *GenericPage {
+	out := *g
+	out.Indexes = slices.Clone(g.Indexes)
+	out.CellData = make([]byte, len(g.CellData))
+	copy(out.CellData[g.lastOffset:], g.CellData[g.lastOffset:])
+	return &out
 }
 
-type TupleIterator iter.Seq[Tuple]
-
-func (g *GenericPage) Iterator() TupleIterator {
-	return func(yield func(Tuple) bool) {
-		for slotId := 0; slotId < len(g.Indexes); slotId++ {
-			d := must(g.Read(SlotIdx(slotId)))
-			if !yield(*d) {
-				return
-			}
-		}
+// page of a table or index b+tree deserialized from its bytes. Other pages aren't made of cells
+func slottedPage(data []byte) (*GenericPage, bool) {
+	header := must(DeserializeGenericHeader(bytes.NewReader(data)))
+	switch header.PageTyp {
+	case TableInteriorPageType, TableLeafPageType, IndexInteriorPageType, IndexLeafPageType:
+		return must(DeserializeGenericPage(header, bytes.NewReader(data[genericHeaderSize:]))), true
 	}
+	return nil, false
+}
+
+func (g *GenericPage) hasSpace(newData int) bool {
+	return int(g.lastOffset)-newData-(len(g.Indexes)*rowIdSize) >= 0
 }
@@ -0,0 +1,195 @@
+package naive
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// medium the pages are stored in. Page with id N starts at byte N*PageSize
+type pager interface {
+	read(id PageID) ([]byte, bool)
+	write(id PageID, data []byte) error
+	// drops pages from the given number on
+	truncate(pages int) error
+	// makes pages written so far durable
+	flush() error
+	close() error
+}
+
+// pages kept in a single byte slice, nothing is durable
+type memoryPager struct {
+	pages []byte
+}
+
+func (m *memoryPager) read(id PageID) ([]byte, bool) {
+	offset := byteOffsetFromPageID(id)
+	if offset >= len(m.pages) {
+		return nil, false
+	}
+	return m.pages[offset : offset+PageSize], true
+}
+
+func (m *memoryPager) write(id PageID, data []byte) error {
+	offset := byteOffsetFromPageID(id)
+	// realloc if needed
+	if offset+len(data) >= len(m.pages) {
+		newBytes := make([]byte, max(2*len(m.pages), offset+2*PageSize))
+		copy(newBytes, m.pages)
+		m.pages = newBytes
+	}
+	copy(m.pages[offset:offset+len(data)], data)
+	return nil
+}
+
+func (m *memoryPager) truncate(pages int) error {
+	m.pages = m.pages[:min(len(m.pages), byteOffsetFromPageID(PageID(pages)))]
+	return nil
+}
+
+func (m *memoryPager) flush() error { return nil }
+func (m *memoryPager) close() error { return nil }
+
+// file the pager reads from and writes to, *os.File in practice
+type pageFile interface {
+	ReadAt(b []byte, off int64) (int, error)
+	WriteAt(b []byte, off int64) (int, error)
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// pages of a database file, read on demand. Written pages go to the file right away,
+// so they don't take memory, and are durable after flush
+type filePager struct {
+	f      pageFile
+	size   int // pages in the file
+	synced bool
+}
+
+func (p *filePager) read(id PageID) ([]byte, bool) {
+	if int(id) >= p.size {
+		return nil, false
+	}
+
+	data := make([]byte, PageSize)
+	_, err := p.f.ReadAt(data, int64(byteOffsetFromPageID(id)))
+	debugAsserErr(err, "reading page %d", id)
+	return data, true
+}
+
+func (p *filePager) write(id PageID, data []byte) error {
+	p.synced = false
+	if _, err := p.f.WriteAt(data, int64(byteOffsetFromPageID(id))); err != nil {
+		return err
+	}
+	p.size = max(p.size, int(id)+1)
+	return nil
+}
+
+func (p *filePager) truncate(pages int) error {
+	if pages >= p.size {
+		return nil
+	}
+	p.synced = false
+	if err := p.f.Truncate(int64(byteOffsetFromPageID(PageID(pages)))); err != nil {
+		return fmt.Errorf("truncating to %d pages: %w", pages, err)
+	}
+	p.size = pages
+	return nil
+}
+
+// pages are overwritten in place, so a crash before the sync can leave any of them changed.
+// Only the log makes the flush atomic, recovery redoes or undoes the changes it has
+// and the log is truncated once the flush finished
+func (p *filePager) flush() error {
+	if p.synced {
+		return nil
+	} else if err := p.f.Sync(); err != nil {
+		return fmt.Errorf("syncing pages: %w", err)
+	}
+	p.synced = true
+	return nil
+}
+
+func (p *filePager) close() error {
+	err := p.flush()
+	if closeErr := p.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// database stored in the file, which is created when it doesn't exist. Changes of every
+// statement are in the file once Execute returns. Log is kept next to it, in the file with -wal suffix
+func Open(path string) (*Database, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening database file: %w", err)
+	}
+	wal, err := os.OpenFile(path+"-wal", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("opening log file: %w", err)
+	}
+	storage, err := openStorage(f, wal)
+	if err != nil {
+		f.Close()
+		wal.Close()
+		return nil, fmt.Errorf("database file %v: %w", path, err)
+	}
+	return NewDatabaseWithStorage(storage), nil
+}
+
+func openFilePager(f *os.File) (*filePager, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	} else if info.Size()%PageSize != 0 {
+		return nil, fmt.Errorf("size %d is not a multiple of page size %d", info.Size(), PageSize)
+	}
+	return &filePager{f: f, size: int(info.Size() / PageSize), synced: true}, nil
+}
+
+func openStorage(f, wal *os.File) (*StorageEngine, error) {
+	p, err := openFilePager(f)
+	if err != nil {
+		return nil, err
+	}
+	walPages, err := openFilePager(wal)
+	if err != nil {
+		return nil, fmt.Errorf("log: %w", err)
+	}
+	log, err := openLog(walPages)
+	if err != nil {
+		return nil, fmt.Errorf("log: %w", err)
+	}
+
+	// changes of committed transactions missing in the file are written, uncommitted ones are undone
+	s := &StorageEngine{pool: newBufferPool(p, defaultPoolFrames), log: log}
+	s.pool.flushLog = log.flush
+	if err := s.recover(); err != nil {
+		return nil, fmt.Errorf("recovery: %w", err)
+	}
+	if data, ok := s.pool.peek(0); ok {
+		root, err := DeserializeRootPage(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		} else if root.PageSize != PageSize {
+			return nil, fmt.Errorf("page size %d is not supported, expected %d", root.PageSize, PageSize)
+		}
+		s.root = *root
+	}
+	// flush drops pages allocated by undone transactions
+	if err := s.Flush(); err != nil {
+		return nil, fmt.Errorf("recovery: %w", err)
+	}
+
+	if p.size == 0 {
+		s := newStorageEngine(s.pool, log)
+		return s, s.Flush()
+	} else if int(s.root.NumberOfPages) > p.size {
+		return nil, fmt.Errorf("file has %d pages, root page expects %d", p.size, s.root.NumberOfPages)
+	}
+	return s, nil
+}
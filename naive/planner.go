@@ -0,0 +1,681 @@
+package naive
+
+import (
+	"fmt"
+	"math"
+	"simple-db/sql"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// logical plan of a query, relational algebra operators built from the statement.
+// It's rewritten by the planner before physical operators are chosen for it
+type logicalNode interface {
+	// pointers to inputs of the node, so rewrites can replace them
+	inputs() []*logicalNode
+}
+
+// rows of a table. Filter holds conjuncts pushed down to the scan,
+// only the listed columns are read from tuples
+type scanNode struct {
+	table   scopedTable
+	filter  []sql.Expression
+	columns []FieldName
+}
+
+// rows for which all conditions are true
+type filterNode struct {
+	input logicalNode
+	conds []sql.Expression
+}
+
+type joinNode struct {
+	left, right logicalNode
+	kind        sql.JoinKind
+	on          []sql.Expression // and-ed, without the hash keys
+	// equalities of on used as keys of a hash join, nested loop is used without them
+	leftKeys, rightKeys []sql.Expression
+}
+
+type aggregateNode struct {
+	input   logicalNode
+	groupBy []sql.Expression
+	aggs    []Aggregation
+}
+
+type sortNode struct {
+	input   logicalNode
+	orderBy []sql.OrderByClause
+}
+
+// evaluates outputs, rows are keyed by the header afterwards
+type projectNode struct {
+	input   logicalNode
+	header  []FieldName
+	outputs []sql.Expression
+}
+
+type distinctNode struct {
+	input  logicalNode
+	header []FieldName
+}
+
+type limitNode struct {
+	input logicalNode
+	limit sql.LimitClause
+}
+
+// rows of the right input are renamed to the header of the left one
+type setOpNode struct {
+	left, right         logicalNode
+	op                  sql.SetOperation
+	header, rightHeader []FieldName
+}
+
+func (*scanNode) inputs() []*logicalNode        { return nil }
+func (n *filterNode) inputs() []*logicalNode    { return []*logicalNode{&n.input} }
+func (n *joinNode) inputs() []*logicalNode      { return []*logicalNode{&n.left, &n.right} }
+func (n *aggregateNode) inputs() []*logicalNode { return []*logicalNode{&n.input} }
+func (n *sortNode) inputs() []*logicalNode      { return []*logicalNode{&n.input} }
+func (n *projectNode) inputs() []*logicalNode   { return []*logicalNode{&n.input} }
+func (n *distinctNode) inputs() []*logicalNode  { return []*logicalNode{&n.input} }
+func (n *limitNode) inputs() []*logicalNode     { return []*logicalNode{&n.input} }
+func (n *setOpNode) inputs() []*logicalNode     { return []*logicalNode{&n.left, &n.right} }
+
+var setOperations = map[sql.SetOperation]string{
+	sql.SetUnion:     "union",
+	sql.SetUnionAll:  "union all",
+	sql.SetIntersect: "intersect",
+	sql.SetExcept:    "except",
+}
+
+// builds and rewrites logical plan of a single select
+type planner struct {
+	scope *queryScope
+}
+
+// plan as the statement reads: joined tables, where, aggregation, having, order by,
+// outputs, distinct and limit
+func (p *planner) selectNode(stmt sql.SelectStatement, header []FieldName, outputs []sql.Expression, aggs []Aggregation) logicalNode {
+	var node logicalNode = &scanNode{table: p.scope.tables[0]}
+	for i, join := range stmt.Joins {
+		j := &joinNode{left: node, right: &scanNode{table: p.scope.tables[i+1]}, kind: join.Kind}
+		if join.On != nil {
+			j.on = conjuncts(join.On)
+		}
+		node = j
+	}
+	if stmt.Where != nil {
+		node = &filterNode{node, conjuncts(stmt.Where.Predicate)}
+	}
+	if isAggregateQuery(stmt) {
+		node = &aggregateNode{node, stmt.GroupBy, aggs}
+		if stmt.Having != nil {
+			node = &filterNode{node, conjuncts(stmt.Having)}
+		}
+	}
+	if len(stmt.OrderBy) > 0 {
+		node = &sortNode{node, stmt.OrderBy}
+	}
+	node = &projectNode{node, header, outputs}
+	if stmt.Distinct {
+		node = &distinctNode{node, header}
+	}
+	if stmt.Limit != nil {
+		node = &limitNode{node, *stmt.Limit}
+	}
+	return node
+}
+
+// rewrites the plan and picks join algorithms. Used columns are canonical names
+// of all columns the query reads
+func (p *planner) optimize(node logicalNode, used []FieldName) logicalNode {
+	foldNode(node)
+	node = p.pushDown(node)
+	pruneColumns(node, used)
+	p.chooseJoins(node)
+	return node
+}
+
+// replaces constant parts of filters, join conditions and outputs with their values
+func foldNode(node logicalNode) {
+	fold := func(exprs []sql.Expression) {
+		for i, expr := range exprs {
+			exprs[i] = foldConstants(expr)
+		}
+	}
+	switch v := node.(type) {
+	case *scanNode:
+		fold(v.filter)
+	case *filterNode:
+		fold(v.conds)
+	case *joinNode:
+		fold(v.on)
+	case *projectNode:
+		v.outputs = slices.Clone(v.outputs)
+		fold(v.outputs)
+	}
+	for _, in := range node.inputs() {
+		foldNode(*in)
+	}
+}
+
+// subexpressions without columns are evaluated once. Ones that fail are kept,
+// so the error is raised only when there are rows to evaluate them for
+func foldConstants(expr sql.Expression) sql.Expression {
+	switch expr.(type) {
+	case sql.ValueLiteral, sql.NullLiteral, sql.ConstantLiteral, sql.ColumnLiteral:
+		return expr
+	}
+	if !usesColumns(expr) {
+		if v, err := evalConstant(expr); err == nil {
+			return constantLiteral(v)
+		}
+		return expr
+	}
+
+	switch v := expr.(type) {
+	case *sql.InfixExpression:
+		return &sql.InfixExpression{Operator: v.Operator, Left: foldConstants(v.Left), Right: foldConstants(v.Right)}
+	case *sql.PrefixExpression:
+		return &sql.PrefixExpression{Operator: v.Operator, Right: foldConstants(v.Right)}
+	case *sql.IsNullExpression:
+		return &sql.IsNullExpression{Expr: foldConstants(v.Expr), Not: v.Not}
+	case *sql.FunctionCall:
+		// aggregates are looked up by their name, they have to stay as they are
+		if _, ok := scalarFunctions[v.Name]; !ok {
+			return v
+		}
+		args := make([]sql.Expression, 0, len(v.Args))
+		for _, arg := range v.Args {
+			args = append(args, foldConstants(arg))
+		}
+		return &sql.FunctionCall{Name: v.Name, Args: args, Wildcard: v.Wildcard}
+	}
+	return expr
+}
+
+// value printed the same way as a literal of its type
+func constantLiteral(d ColumnData) sql.ConstantLiteral {
+	text := formatValue(d)
+	switch d.Typ {
+	case Null:
+		text = "null"
+	case String:
+		text = strconv.Quote(d.Data.(string))
+	case Float:
+		if f := d.Data.(float64); !math.IsInf(f, 0) && !math.IsNaN(f) && !strings.Contains(text, ".") {
+			text = strconv.FormatFloat(f, 'f', 1, 64)
+		}
+	case Date:
+		text = "date '" + text + "'"
+	case Timestamp:
+		text = "timestamp '" + text + "'"
+	}
+	return sql.ConstantLiteral{Value: d, Text: text}
+}
+
+func isConstant(expr sql.Expression, value bool) bool {
+	c, ok := expr.(sql.ConstantLiteral)
+	if !ok {
+		return false
+	}
+	v := c.Value.(ColumnData)
+	return v.Typ == Boolean && v.Data.(bool) == value
+}
+
+// condition that can never be true, so rows don't need to be read at all
+func neverTrue(expr sql.Expression) bool {
+	c, ok := expr.(sql.ConstantLiteral)
+	return ok && (isConstant(expr, false) || c.Value.(ColumnData).Typ == Null)
+}
+
+// moves filter conditions and join conditions towards the scans
+func (p *planner) pushDown(node logicalNode) logicalNode {
+	for _, in := range node.inputs() {
+		*in = p.pushDown(*in)
+	}
+	switch v := node.(type) {
+	case *filterNode:
+		return p.pushFilter(v.input, v.conds)
+	case *joinNode:
+		return p.pushFilter(v, nil)
+	}
+	return node
+}
+
+// applies conditions to the node, as close to the scans as possible. Conditions that
+// can't go any further end up in a filter above the node
+func (p *planner) pushFilter(node logicalNode, conds []sql.Expression) logicalNode {
+	conds = slices.DeleteFunc(slices.Clone(conds), func(c sql.Expression) bool { return isConstant(c, true) })
+
+	switch v := node.(type) {
+	case *scanNode:
+		v.filter = append(v.filter, conds...)
+		return v
+	case *filterNode:
+		v.conds = append(v.conds, conds...)
+		return v
+	case *joinNode:
+		left, right := tablesOf(v.left), tablesOf(v.right)
+		var toLeft, toRight, on, rest []sql.Expression
+		if v.kind == sql.LeftJoin {
+			// left rows are kept whatever the join condition says,
+			// only its conditions on the right table can filter that table
+			for _, c := range v.on {
+				if p.usesOnly(c, right) {
+					toRight = append(toRight, c)
+				} else {
+					on = append(on, c)
+				}
+			}
+			for _, c := range conds {
+				if p.usesOnly(c, left) {
+					toLeft = append(toLeft, c)
+				} else {
+					rest = append(rest, c)
+				}
+			}
+		} else {
+			for _, c := range append(v.on, conds...) {
+				if p.usesOnly(c, left) {
+					toLeft = append(toLeft, c)
+				} else if p.usesOnly(c, right) {
+					toRight = append(toRight, c)
+				} else {
+					on = append(on, c)
+				}
+			}
+			if len(on) > 0 {
+				v.kind = sql.InnerJoin
+			}
+		}
+
+		v.on = on
+		v.left, v.right = p.pushFilter(v.left, toLeft), p.pushFilter(v.right, toRight)
+		if len(rest) > 0 {
+			return &filterNode{v, rest}
+		}
+		return v
+	}
+
+	if len(conds) == 0 {
+		return node
+	}
+	return &filterNode{node, conds}
+}
+
+// tables scanned by the node and its inputs
+func tablesOf(node logicalNode) []string {
+	var out []string
+	for _, s := range scansOf(node) {
+		out = append(out, s.table.name)
+	}
+	return out
+}
+
+func scansOf(node logicalNode) []*scanNode {
+	if s, ok := node.(*scanNode); ok {
+		return []*scanNode{s}
+	}
+	var out []*scanNode
+	for _, in := range node.inputs() {
+		out = append(out, scansOf(*in)...)
+	}
+	return out
+}
+
+// true when expression uses no columns of other tables, constants use none at all
+func (p *planner) usesOnly(expr sql.Expression, tables []string) bool {
+	for _, col := range columnsOf(expr) {
+		name, err := p.scope.canonical(col.Name.Lexeme)
+		debugAsserErr(err, "column should be validated")
+		table, _, _ := strings.Cut(string(name), ".")
+		if !slices.Contains(tables, table) {
+			return false
+		}
+	}
+	return true
+}
+
+// all column references of the expression, also the ones in aggregate arguments
+func columnsOf(expr sql.Expression) []sql.ColumnLiteral {
+	switch v := expr.(type) {
+	case *sql.InfixExpression:
+		return append(columnsOf(v.Left), columnsOf(v.Right)...)
+	case *sql.PrefixExpression:
+		return columnsOf(v.Right)
+	case *sql.IsNullExpression:
+		return columnsOf(v.Expr)
+	case *sql.FunctionCall:
+		var out []sql.ColumnLiteral
+		for _, arg := range v.Args {
+			out = append(out, columnsOf(arg)...)
+		}
+		return out
+	case sql.ColumnLiteral:
+		return []sql.ColumnLiteral{v}
+	}
+	return nil
+}
+
+// canonical names of columns read anywhere in the statement
+func (p *planner) usedColumns(stmt sql.SelectStatement, outputs []sql.Expression) []FieldName {
+	exprs := slices.Clone(outputs)
+	for _, j := range stmt.Joins {
+		if j.On != nil {
+			exprs = append(exprs, j.On)
+		}
+	}
+	if stmt.Where != nil {
+		exprs = append(exprs, stmt.Where.Predicate)
+	}
+	exprs = append(exprs, stmt.GroupBy...)
+	if stmt.Having != nil {
+		exprs = append(exprs, stmt.Having)
+	}
+	for _, o := range stmt.OrderBy {
+		exprs = append(exprs, o.Expr)
+	}
+
+	var out []FieldName
+	for _, expr := range exprs {
+		for _, col := range columnsOf(expr) {
+			name, err := p.scope.canonical(col.Name.Lexeme)
+			debugAsserErr(err, "column should be validated")
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// scans parse only columns the query uses
+func pruneColumns(node logicalNode, used []FieldName) {
+	for _, s := range scansOf(node) {
+		s.columns = []FieldName{}
+		for _, col := range s.table.schema.FieldNames {
+			if slices.Contains(used, qualifiedName(s.table.name, col)) {
+				s.columns = append(s.columns, col)
+			}
+		}
+	}
+}
+
+// joins on equal columns of both inputs use a hash join. Columns have to be of the same
+// type, so values equal for the comparison are also equal as hash keys. Floats are left
+// out, as zero and negative zero are equal
+func (p *planner) chooseJoins(node logicalNode) {
+	for _, in := range node.inputs() {
+		p.chooseJoins(*in)
+	}
+	j, ok := node.(*joinNode)
+	if !ok || j.kind == sql.CrossJoin {
+		return
+	}
+
+	left, right := tablesOf(j.left), tablesOf(j.right)
+	var on []sql.Expression
+	for _, c := range j.on {
+		infix, ok := c.(*sql.InfixExpression)
+		if !ok || infix.Operator.Lexeme != "=" {
+			on = append(on, c)
+			continue
+		}
+		l, lok := infix.Left.(sql.ColumnLiteral)
+		r, rok := infix.Right.(sql.ColumnLiteral)
+		if lok && rok && p.usesOnly(l, right) && p.usesOnly(r, left) {
+			l, r = r, l
+		}
+		typ := p.scope.typeOf(l)
+		if !lok || !rok || !p.usesOnly(l, left) || !p.usesOnly(r, right) || typ != p.scope.typeOf(r) || typ == Float || typ == Null {
+			on = append(on, c)
+			continue
+		}
+		j.leftKeys, j.rightKeys = append(j.leftKeys, l), append(j.rightKeys, r)
+	}
+	j.on = on
+}
+
+// physical operator, a node of the plan that is executed
+type operator struct {
+	name   string
+	detail string
+	inputs []*operator
+	rows   func(inputs []RowIter) RowIter
+}
+
+func (o *operator) iter() RowIter {
+	inputs := make([]RowIter, 0, len(o.inputs))
+	for _, in := range o.inputs {
+		inputs = append(inputs, in.iter())
+	}
+	return o.rows(inputs)
+}
+
+// one operator per line, inputs are indented under it
+func (o *operator) String() string {
+	var lines []string
+	o.walk(0, func(o *operator, depth int) {
+		lines = append(lines, strings.Repeat("\t", depth)+o.describe())
+	})
+	return strings.Join(lines, "\n")
+}
+
+// visits the operator and then its inputs
+func (o *operator) walk(depth int, fn func(o *operator, depth int)) {
+	fn(o, depth)
+	for _, in := range o.inputs {
+		in.walk(depth+1, fn)
+	}
+}
+
+func (o *operator) describe() string {
+	if o.detail == "" {
+		return o.name
+	}
+	return o.name + " " + o.detail
+}
+
+func (e *ExecutionEngine) physical(node logicalNode) *operator {
+	switch v := node.(type) {
+	case *scanNode:
+		return e.scanOperator(v)
+	case *filterNode:
+		return filterOperator(e.physical(v.input), v.conds)
+	case *joinNode:
+		return e.joinOperator(v)
+	case *aggregateNode:
+		var keys []func(Row) ColumnData
+		for _, expr := range v.groupBy {
+			keys = append(keys, func(r Row) ColumnData { return predBuilder(expr, r) })
+		}
+		var names []string
+		for _, agg := range v.aggs {
+			names = append(names, string(agg.Name))
+		}
+		detail := strings.Join(names, ", ")
+		if len(v.groupBy) > 0 {
+			detail = strings.TrimSpace(detail + " by " + joinExprs(v.groupBy, ", "))
+		}
+		return &operator{"hash aggregate", detail, []*operator{e.physical(v.input)}, func(in []RowIter) RowIter {
+			return HashAggregate(in[0], keys, v.aggs)
+		}}
+	case *sortNode:
+		var clauses []string
+		for _, c := range v.orderBy {
+			clauses = append(clauses, orderByString(c))
+		}
+		return &operator{"sort", strings.Join(clauses, ", "), []*operator{e.physical(v.input)}, func(in []RowIter) RowIter {
+			return Sort(in[0], orderByComparator(v.orderBy), e.SortMemoryBudget, e.storage)
+		}}
+	case *projectNode:
+		var outputs []string
+		for i, expr := range v.outputs {
+			if out := expr.String(); out != string(v.header[i]) {
+				outputs = append(outputs, out+" as "+string(v.header[i]))
+			} else {
+				outputs = append(outputs, out)
+			}
+		}
+		return &operator{"project", strings.Join(outputs, ", "), []*operator{e.physical(v.input)}, func(in []RowIter) RowIter {
+			return evalOutputs(in[0], v.header, v.outputs)
+		}}
+	case *distinctNode:
+		return &operator{"distinct", "", []*operator{e.physical(v.input)}, func(in []RowIter) RowIter {
+			return Distinct(in[0], v.header)
+		}}
+	case *limitNode:
+		detail := fmt.Sprint(v.limit.Count)
+		if v.limit.Offset > 0 {
+			detail += fmt.Sprintf(" offset %d", v.limit.Offset)
+		}
+		return &operator{"limit", detail, []*operator{e.physical(v.input)}, func(in []RowIter) RowIter {
+			return Limit(in[0], v.limit.Count, v.limit.Offset)
+		}}
+	case *setOpNode:
+		inputs := []*operator{e.physical(v.left), e.physical(v.right)}
+		return &operator{setOperations[v.op], "", inputs, func(in []RowIter) RowIter {
+			left, right := in[0], Rename(in[1], v.rightHeader, v.header)
+			switch v.op {
+			case sql.SetUnion:
+				return Distinct(Concat(left, right), v.header)
+			case sql.SetUnionAll:
+				return Concat(left, right)
+			case sql.SetIntersect:
+				return Intersect(left, right, v.header)
+			}
+			return Except(left, right, v.header)
+		}}
+	}
+
+	debugAssert(false, "unknown logical node %T", node)
+	return nil
+}
+
+// index scan when some index can answer comparisons of the filter,
+// the filter is still applied to rows found by it
+func (e *ExecutionEngine) scanOperator(s *scanNode) *operator {
+	var columns []string
+	for _, col := range s.columns {
+		columns = append(columns, string(col))
+	}
+	table := s.table.name + "(" + strings.Join(columns, ", ") + ")"
+
+	op := &operator{"seq scan", table, nil, func([]RowIter) RowIter {
+		return e.tableScan(s.table, s.columns)
+	}}
+	if idx, r, ok := chooseIndex(s.table.schema.Indexes, scanBounds(s.table, s.filter)); ok {
+		op = &operator{"index scan", table + " using " + idx.Name, nil, func([]RowIter) RowIter {
+			return e.indexScan(s.table, idx, r, s.columns)
+		}}
+	}
+	return filterOperator(op, s.filter)
+}
+
+// filter that is never true produces no rows without reading its input
+func filterOperator(input *operator, conds []sql.Expression) *operator {
+	if len(conds) == 0 {
+		return input
+	} else if slices.ContainsFunc(conds, neverTrue) {
+		return &operator{"empty", joinExprs(conds, " and "), nil, func([]RowIter) RowIter {
+			return func(func(Row) bool) {}
+		}}
+	}
+
+	pred := conjunction(conds)
+	return &operator{"filter", joinExprs(conds, " and "), []*operator{input}, func(in []RowIter) RowIter {
+		return Select(in[0], pred)
+	}}
+}
+
+func (e *ExecutionEngine) joinOperator(j *joinNode) *operator {
+	inputs := []*operator{e.physical(j.left), e.physical(j.right)}
+	kind := map[sql.JoinKind]string{sql.InnerJoin: "inner join", sql.LeftJoin: "left join", sql.CrossJoin: "cross join"}[j.kind]
+	var nulls Row
+	if j.kind == sql.LeftJoin {
+		nulls = Row{}
+		for _, s := range scansOf(j.right) {
+			nulls = mergeRows(nulls, nullRow(s.table.name, TableSchema{FieldNames: s.columns}))
+		}
+	}
+
+	var conds []string
+	for i := range j.leftKeys {
+		conds = append(conds, j.leftKeys[i].String()+" = "+j.rightKeys[i].String())
+	}
+	if len(j.on) > 0 {
+		conds = append(conds, joinExprs(j.on, " and "))
+	}
+	if len(conds) > 0 {
+		kind += " on " + strings.Join(conds, " and ")
+	}
+	pred := conjunction(j.on)
+
+	if len(j.leftKeys) > 0 {
+		return &operator{"hash join", kind, inputs, func(in []RowIter) RowIter {
+			return HashJoin(in[0], in[1], hashKey(j.leftKeys), hashKey(j.rightKeys), pred, nulls)
+		}}
+	}
+	return &operator{"nested loop", kind, inputs, func(in []RowIter) RowIter {
+		if j.kind == sql.LeftJoin {
+			return LeftJoin(in[0], in[1], pred, nulls)
+		} else if len(j.on) == 0 {
+			return Product(in[0], in[1])
+		}
+		return Join(in[0], in[1], pred)
+	}}
+}
+
+// encoded values of the expressions, false when any of them is null
+func hashKey(exprs []sql.Expression) func(Row) (string, bool) {
+	return func(r Row) (string, bool) {
+		var out []byte
+		for _, expr := range exprs {
+			v := predBuilder(expr, r)
+			if v.Typ == Null {
+				return "", false
+			}
+			out = appendIndexValue(out, v)
+		}
+		return string(out), true
+	}
+}
+
+// true for rows all conditions are true for. Every condition is evaluated,
+// same as when they are and-ed, so a non boolean one always fails the query
+func conjunction(conds []sql.Expression) func(Row) bool {
+	return func(r Row) bool {
+		out := true
+		for _, c := range conds {
+			v := predBuilder(c, r)
+			if v.Typ != Null && v.Typ != Boolean {
+				raise("boolean predicate required, got %v", v.Typ)
+			}
+			out = out && v.Typ == Boolean && v.Data.(bool)
+		}
+		return out
+	}
+}
+
+func joinExprs(exprs []sql.Expression, sep string) string {
+	var out []string
+	for _, expr := range exprs {
+		out = append(out, expr.String())
+	}
+	return strings.Join(out, sep)
+}
+
+func orderByString(c sql.OrderByClause) string {
+	out := c.Expr.String()
+	if c.Desc {
+		out += " desc"
+	}
+	switch c.Nulls {
+	case sql.NullsFirst:
+		out += " nulls first"
+	case sql.NullsLast:
+		out += " nulls last"
+	}
+	return out
+}
@@ -0,0 +1,164 @@
+package naive
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// LSN of the last record applied to the page, stored in its header
+func pageLSNOffset(id PageID) int {
+	if id == 0 {
+		return rootPageLSNOffset
+	}
+	return genericHeaderSize - 4
+}
+
+func pageLSN(id PageID, data []byte) LSN {
+	return LSN(endinanness.Uint32(data[pageLSNOffset(id):]))
+}
+
+func setPageLSN(id PageID, data []byte, lsn LSN) {
+	endinanness.PutUint32(data[pageLSNOffset(id):], uint32(lsn))
+}
+
+// copy of the page bytes, empty page when it doesn't exist yet
+func (s *StorageEngine) pageImage(id PageID) []byte {
+	data, ok := s.pool.peek(id)
+	if !ok {
+		return make([]byte, PageSize)
+	}
+	return bytes.Clone(data)
+}
+
+// applies changes of the record to the page without logging them, page gets the LSN of the record
+func (s *StorageEngine) applyChanges(e LogEntry) {
+	data := applyPageChanges(s.pageImage(e.Page), e.Changes)
+	setPageLSN(e.Page, data, e.LSN)
+	if err := s.pool.write(e.Page, data); err != nil {
+		raise("%w", err)
+	}
+}
+
+// page with the changes applied. Cells are changed through the slotted page,
+// it's deserialized once for all changes following each other
+func applyPageChanges(data []byte, changes []PageChange) []byte {
+	var p *GenericPage
+	for _, c := range changes {
+		if c.Kind == ChangeImage {
+			data, p = make([]byte, PageSize), nil
+			copy(data, c.After)
+			continue
+		} else if p == nil {
+			var ok bool
+			p, ok = slottedPage(data)
+			debugAssert(ok, "cells of a page that is not slotted are changed")
+		}
+
+		slot := int(c.Slot)
+		var err error
+		switch c.Kind {
+		case ChangeInsert:
+			err = p.insertCell(slot, c.After)
+		case ChangeDelete:
+			debugAssert(bytes.Equal(p.cell(slot), c.Before), "deleted cell %d doesn't match its before image", slot)
+			p.removeCell(slot)
+		case ChangeReplace:
+			debugAssert(bytes.Equal(p.cell(slot), c.Before), "replaced cell %d doesn't match its before image", slot)
+			err = p.replaceCell(slot, c.After)
+		case ChangeHeader:
+			debugAssert(bytes.Equal(headerImage(p.Header), c.Before), "page header doesn't match its before image")
+			p.Header.PageTyp = PageType(endinanness.Uint32(c.After))
+			p.Header.NextPage = PageID(endinanness.Uint32(c.After[4:]))
+		default:
+			debugAssert(false, "unknown change kind %d", c.Kind)
+		}
+		debugAsserErr(err, "applying change of slot %d", slot)
+	}
+	if p != nil {
+		return p.Serialize()
+	}
+	return data
+}
+
+// transaction being rolled back
+type undoState struct {
+	last LSN // newest record of the transaction, compensations are chained to it
+	next LSN // next record to undo, 0 when everything was undone
+}
+
+// ARIES restart from the log. Log is truncated once all pages are durable, so there is no checkpoint record,
+// records since then are all that's needed:
+//   - analysis finds transactions that didn't finish
+//   - redo repeats history, every change missing on its page is applied again, compensations included
+//   - undo rolls back the unfinished transactions from their newest record, logging compensations,
+//     so a crash during the undo continues where it stopped
+func (s *StorageEngine) recover() (err error) {
+	defer recoverEvalError(&err)
+	active := map[TxID]*undoState{}
+	for e := range s.log.Iterator() {
+		s.lastTx = max(s.lastTx, e.TxID)
+		switch e.Kind {
+		case LogCommit, LogAbort:
+			delete(active, e.TxID)
+		case LogUpdate:
+			active[e.TxID] = &undoState{last: e.LSN, next: e.LSN}
+		case LogCompensation:
+			active[e.TxID] = &undoState{last: e.LSN, next: e.UndoNext}
+		default:
+			return fmt.Errorf("unknown kind %d of log record %d", e.Kind, e.LSN)
+		}
+	}
+
+	for e := range s.log.Iterator() {
+		if e.Kind != LogUpdate && e.Kind != LogCompensation {
+			continue
+		} else if pageLSN(e.Page, s.pageImage(e.Page)) >= e.LSN {
+			continue // page was written after the change
+		}
+		s.applyChanges(e)
+	}
+
+	// newest record of all transactions is undone first
+	for len(active) > 0 {
+		tx := slices.MaxFunc(slices.Collect(maps.Keys(active)), func(a, b TxID) int {
+			return int(active[a].next - active[b].next)
+		})
+		u := active[tx]
+		if u.next == 0 {
+			s.log.Append(LogEntry{PrevLSN: u.last, TxID: tx, Kind: LogAbort})
+			delete(active, tx)
+		} else if err := s.undo(tx, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoes the next update of the transaction, compensations are skipped
+// as the records they point to are undone already
+func (s *StorageEngine) undo(tx TxID, u *undoState) error {
+	e, ok := s.log.entry(u.next)
+	if !ok {
+		return fmt.Errorf("log record %d of transaction %d not found", u.next, tx)
+	} else if e.TxID != tx {
+		return fmt.Errorf("log record %d belongs to transaction %d, expected %d", e.LSN, e.TxID, tx)
+	}
+
+	switch e.Kind {
+	case LogCompensation:
+		u.next = e.UndoNext
+	case LogUpdate:
+		clr := LogEntry{PrevLSN: u.last, TxID: tx, Kind: LogCompensation, Page: e.Page, UndoNext: e.PrevLSN}
+		for _, c := range slices.Backward(e.Changes) {
+			clr.Changes = append(clr.Changes, c.inverse())
+		}
+		clr.LSN = s.appendLog(clr)
+		s.applyChanges(clr)
+		u.last, u.next = clr.LSN, e.PrevLSN
+	default:
+		return fmt.Errorf("log record %d of kind %d can't be undone", e.LSN, e.Kind)
+	}
+	return nil
+}
@@ -13,10 +13,14 @@ type RootPage struct {
 	MagicNumber     int32
 	PageSize        int32
 	SchemaPageStart PageID
-	LogPageStart    PageID
 	NumberOfPages   int32
+	FreePageStart   PageID // head of the linked list of reclaimed pages, 0 if empty
+	PageLSN         LSN    // last log record that changed the root page
 }
 
+// root page has its own layout, LSN of the page follows its 6 other fields
+const rootPageLSNOffset = 4 * 6
+
 func NewRootPage() RootPage {
 	return RootPage{
 		PageTyp:       RootPageType,
@@ -33,7 +37,9 @@ func (r *RootPage) Serialize() []byte {
 		WithInt(func(r *RootPage) int32 { return r.PageSize }),
 		WithInt(func(r *RootPage) int32 { return int32(r.SchemaPageStart) }),
 		WithInt(func(r *RootPage) int32 { return int32(r.NumberOfPages) }),
-		func(_ *RootPage, b *bytes.Buffer) { b.Write(make([]byte, PageSize-4*5)) }, // 5 fields, each has 4 bytes
+		WithInt(func(r *RootPage) int32 { return int32(r.FreePageStart) }),
+		WithInt(func(r *RootPage) int32 { return int32(r.PageLSN) }),
+		func(_ *RootPage, b *bytes.Buffer) { b.Write(make([]byte, PageSize-4*7)) }, // 7 fields, each has 4 bytes
 	)
 	debugAssert(len(got) == PageSize, "root page should also be size of a page")
 	return got
@@ -46,8 +52,10 @@ func DeserializeRootPage(r io.Reader) (*RootPage, error) {
 		DeserWithInt("page size", func(rp *RootPage, i *int32) { rp.PageSize = *i }),
 		DeserWithInt("schema page start", func(rp *RootPage, i *int32) { rp.SchemaPageStart = PageID(*i) }),
 		DeserWithInt("number of pages", func(rp *RootPage, i *int32) { rp.NumberOfPages = *i }),
+		DeserWithInt("free page start", func(rp *RootPage, i *int32) { rp.FreePageStart = PageID(*i) }),
+		DeserWithInt("page lsn", func(rp *RootPage, i *int32) { rp.PageLSN = LSN(*i) }),
 		func(_ *RootPage, r io.Reader) error {
-			_, err := r.Read(make([]byte, PageSize-4*5)) // discard rest of the page
+			_, err := r.Read(make([]byte, PageSize-4*7)) // discard rest of the page
 			return err
 		},
 	)
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 )
 
 var endinanness = binary.BigEndian
@@ -20,6 +21,14 @@ func SerializeInt(i int32) []byte {
 	return endinanness.AppendUint32([]byte{}, uint32(i))
 }
 
+func SerializeInt64(i int64) []byte {
+	return endinanness.AppendUint64([]byte{}, uint64(i))
+}
+
+func SerializeFloat(f float64) []byte {
+	return endinanness.AppendUint64([]byte{}, math.Float64bits(f))
+}
+
 func SerializeString(s string) []byte {
 	return SerializeBytes([]byte(s))
 }
@@ -141,6 +150,30 @@ func ReadInt(r io.Reader) (int32, error) {
 	return int32(endinanness.Uint32(buf)), nil
 }
 
+func ReadInt64(r io.Reader) (int64, error) {
+	buf := make([]byte, 8)
+	got, err := r.Read(buf)
+	if err != nil {
+		return 0, err
+	} else if got != 8 {
+		return 0, fmt.Errorf("failed to read int64, expected 8 bytes, got %d", got)
+	}
+
+	return int64(endinanness.Uint64(buf)), nil
+}
+
+func ReadFloat(r io.Reader) (float64, error) {
+	buf := make([]byte, 8)
+	got, err := r.Read(buf)
+	if err != nil {
+		return 0, err
+	} else if got != 8 {
+		return 0, fmt.Errorf("failed to read float, expected 8 bytes, got %d", got)
+	}
+
+	return math.Float64frombits(endinanness.Uint64(buf)), nil
+}
+
 func ReadString(r io.Reader) (string, error) {
 	i, err := ReadInt(r)
 	if err != nil {
@@ -162,11 +195,10 @@ func ReadBytes(r io.Reader) ([]byte, error) {
 		return nil, fmt.Errorf("error deserializing lenght of byte array: %w", err)
 	}
 	buf := make([]byte, i)
-	got, err := r.Read(buf)
+	// empty array at the end of the reader is read without EOF
+	got, err := io.ReadFull(r, buf)
 	if err != nil {
-		return nil, fmt.Errorf("error deserializing byte array: %w", err)
-	} else if got != int(i) {
-		return nil, fmt.Errorf("error deserializing byte array, expected %d bytes, got %d", i, got)
+		return nil, fmt.Errorf("error deserializing byte array, expected %d bytes, got %d: %w", i, got, err)
 	}
 	return buf, nil
 }
@@ -36,6 +36,54 @@ func TestSerialize(t *testing.T) {
 		assert.Equal(t, int32(0xff1234), got)
 	})
 
+	t.Run("float", func(t *testing.T) {
+		bytez := []byte{0xc0, 0x09, 0x21, 0xf9, 0xf0, 0x1b, 0x86, 0x6e}
+		assert.Equal(t, bytez, SerializeFloat(-3.14159))
+
+		got, err := ReadFloat(bytes.NewReader(bytez))
+		assert.NoError(t, err)
+		assert.Equal(t, -3.14159, got)
+	})
+
+	t.Run("tuple with float", func(t *testing.T) {
+		tuple := Tuple{
+			NumberOfFields: 3,
+			ColumnTypes:    []ColumnType{IntField, FloatField, StringField},
+			ColumnDatas:    [][]byte{SerializeInt(1), SerializeFloat(2.5), SerializeString("x")},
+		}
+
+		got, err := DeserializeTuple(tuple.Serialize())
+		assert.NoError(t, err)
+		assert.Equal(t, tuple, *got)
+	})
+
+	t.Run("int64", func(t *testing.T) {
+		bytez := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}
+		assert.Equal(t, bytez, SerializeInt64(-2))
+
+		got, err := ReadInt64(bytes.NewReader(bytez))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(-2), got)
+	})
+
+	t.Run("tuple with bigint, date, timestamp and blobs", func(t *testing.T) {
+		tuple := Tuple{
+			NumberOfFields: 5,
+			ColumnTypes:    []ColumnType{BigIntField, DateField, TimestampField, BlobField, OverflowBlobField},
+			ColumnDatas: [][]byte{
+				SerializeInt64(1 << 40),
+				SerializeInt(19753),
+				SerializeInt64(1706695200000000),
+				SerializeBytes([]byte{0xca, 0xfe}),
+				append(SerializeInt(5000), SerializeInt(7)...),
+			},
+		}
+
+		got, err := DeserializeTuple(tuple.Serialize())
+		assert.NoError(t, err)
+		assert.Equal(t, tuple, *got)
+	})
+
 	t.Run("string", func(t *testing.T) {
 		bytez := []byte{0, 0, 0, 11, 'h', 'e', 'l', 'l', 'o', ' ', 'w', 'o', 'r', 'l', 'd'}
 		assert.Equal(t, bytez, SerializeString("hello world"))
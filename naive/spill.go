@@ -0,0 +1,133 @@
+package naive
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"time"
+)
+
+// spilled rows are stored one after another in a temporary file. It's outside of the database,
+// so it's not logged or synced, and it's removed once the operator is done
+func (s *StorageEngine) Spill(rows []Row) (RowIter, func()) {
+	if len(rows) == 0 {
+		return func(yield func(Row) bool) {}, func() {}
+	}
+
+	f, err := os.CreateTemp(s.tempDir, "naive-spill-*")
+	if err != nil {
+		raise("spilling rows: %w", err)
+	}
+	release := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	w := bufio.NewWriter(f)
+	size := 0
+	for _, r := range rows {
+		n, _ := w.Write(serializeRow(r))
+		size += n
+	}
+	if err := w.Flush(); err != nil {
+		release()
+		raise("spilling rows: %w", err)
+	}
+
+	numOfRows := len(rows)
+	spilled := func(yield func(Row) bool) {
+		r := bufio.NewReader(io.NewSectionReader(f, 0, int64(size)))
+		for range numOfRows {
+			row, err := deserializeRow(r)
+			if err != nil {
+				raise("reading spilled rows: %w", err)
+			}
+			if !yield(row) {
+				return
+			}
+		}
+	}
+	return spilled, release
+}
+
+func serializeRow(r Row) []byte {
+	var buf bytes.Buffer
+	buf.Write(SerializeInt(int32(len(r))))
+	for _, name := range slices.Sorted(maps.Keys(r)) {
+		col := r[name]
+		buf.Write(SerializeString(string(name)))
+		buf.Write(SerializeInt(int32(col.Typ)))
+
+		switch col.Typ {
+		case Null:
+		case Int32:
+			buf.Write(SerializeInt(col.Data.(int32)))
+		case String:
+			buf.Write(SerializeString(col.Data.(string)))
+		case Boolean:
+			buf.Write(SerializeBool(col.Data.(bool)))
+		case Float:
+			buf.Write(SerializeFloat(col.Data.(float64)))
+		case Int64:
+			buf.Write(SerializeInt64(col.Data.(int64)))
+		case Blob:
+			buf.Write(SerializeBytes(col.Data.([]byte)))
+		case Date, Timestamp:
+			buf.Write(SerializeInt64(col.Data.(time.Time).UnixMicro()))
+		default:
+			debugAssert(false, "unsupported type for spilling: %v", col.Typ)
+		}
+	}
+	return buf.Bytes()
+}
+
+func deserializeRow(r io.Reader) (Row, error) {
+	numOfFields, err := ReadInt(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading number of fields: %w", err)
+	}
+
+	out := Row{}
+	for range numOfFields {
+		name, err := ReadString(r)
+		if err != nil {
+			return nil, fmt.Errorf("error reading field name: %w", err)
+		}
+		typ, err := ReadInt(r)
+		if err != nil {
+			return nil, fmt.Errorf("error reading type of %q: %w", name, err)
+		}
+
+		col := ColumnData{Typ: FieldType(typ)}
+		switch col.Typ {
+		case Null:
+		case Int32:
+			col.Data, err = ReadInt(r)
+		case String:
+			col.Data, err = ReadString(r)
+		case Boolean:
+			col.Data, err = ReadBool(r)
+		case Float:
+			col.Data, err = ReadFloat(r)
+		case Int64:
+			col.Data, err = ReadInt64(r)
+		case Blob:
+			col.Data, err = ReadBytes(r)
+		case Date, Timestamp:
+			var micros int64
+			micros, err = ReadInt64(r)
+			col.Data = time.UnixMicro(micros).UTC()
+		default:
+			err = fmt.Errorf("unsupported type %v", col.Typ)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading value of %q: %w", name, err)
+		}
+		out[FieldName(name)] = col
+	}
+	return out, nil
+}
@@ -2,15 +2,23 @@ package naive
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"iter"
 	"simple-db/sql"
 )
 
 type StorageEngine struct {
-	root     RootPage
-	allPages []byte
+	root RootPage
+	pool *BufferPool
+	log  *Log
+
+	tx        TxID // transaction of the changes, started by the first change after a commit
+	lastTx    TxID
+	txLastLSN LSN // last record of the transaction
+	// number of page reads so far, including overflow pages. Used by explain analyze
+	pagesRead int
+	// directory of temporary files, like runs spilled by sorts. Default one of the OS when empty
+	tempDir string
 }
 
 // to support generic pages and overflows
@@ -24,59 +32,102 @@ func byteOffsetFromPageID(p PageID) int {
 	return int(p) * PageSize
 }
 
+// in memory storage, lost when the process ends
 func NewStorageEngine() *StorageEngine {
-	s := &StorageEngine{
-		allPages: make([]byte, 20*PageSize),
-	}
+	return newStorageEngine(newBufferPool(&memoryPager{make([]byte, 20*PageSize)}, defaultPoolFrames), newMemoryLog())
+}
 
+// empty database with just the schema table
+func newStorageEngine(pool *BufferPool, log *Log) *StorageEngine {
+	s := &StorageEngine{pool: pool, log: log}
 	s.root = NewRootPage()
-	schemaID, schemaPage := s.AllocatePage(DataPageType, schemaName)
-
+	schemaID, _ := s.AllocatePage(TableLeafPageType)
 	s.root.SchemaPageStart = schemaID
-	// todo: this is a bad workaround, that I need a schema for schema tuple. can we do better?
-	schemaPage.Add(SchemaTuple{
-		PageTyp:        DataPageType,
+	s.persistPage(0, s.root.Serialize())
+
+	_, err := s.AddTuple(schemaName, SchemaTuple{
+		PageTyp:        TableLeafPageType,
 		StartingPageID: schemaID,
 		Name:           schemaName,
 		SqlStatement:   SchemaTypleSql,
 	}.ToTuple())
-
-	// todo: optimise this, root persist is done also in dir and schema allocations, but misses setting dir and schema ids
-	s.persistPage(0, s.root.Serialize())
-	s.persistPage(schemaID, schemaPage.Serialize())
+	debugAsserErr(err, "schema table should be created")
+	s.commit()
 
 	return s
 }
 
+func newMemoryLog() *Log {
+	return must(openLog(&memoryPager{}))
+}
+
 func NewStorageEngineWithData(root *RootPage, allPages []byte) *StorageEngine {
-	return &StorageEngine{*root, allPages}
+	return &StorageEngine{root: *root, pool: newBufferPool(&memoryPager{allPages}, defaultPoolFrames), log: newMemoryLog()}
 }
 
 func (s *StorageEngine) GetSchema() Schema {
 	out := Schema{}
 
+	var indexes []SchemaTuple
 	for sch := range s.SchemaTuples() {
-		got, err := sql.Parse(sql.Lex(sch.SqlStatement))
-		debugAsserErr(err, "schema corruption, invalid sql statement for table: %s", sch.Name)
-		createStmt, ok := got.(*sql.CreateStatement)
-		debugAssert(ok, "schema corruption, invalid sql statement for table: %s, should be create statement, got %T", sch.Name, got)
+		if sch.PageTyp == IndexLeafPageType {
+			indexes = append(indexes, sch)
+			continue
+		}
 
-		res := TableSchema{}
-		for _, data := range createStmt.Columns {
-			f, err := FieldTypeFromString(data.Typ)
-			debugAsserErr(err, "schema corruption, invalid type for table %s: ", sch.Name)
+		createStmt, err := sch.CreateStatement()
+		debugAsserErr(err, "schema corruption, invalid sql statement for table: %s", sch.Name)
 
-			res.FieldNames = append(res.FieldNames, FieldName(data.Name))
-			res.FieldsTypes = append(res.FieldsTypes, f)
-		}
+		res, err := tableSchemaFromCreate(*createStmt)
+		debugAsserErr(err, "schema corruption, invalid column for table %s", sch.Name)
 		res.StartPage = sch.StartingPageID
 		res.PageTyp = sch.PageTyp
 		out[TableName(sch.Name)] = res
 	}
 
+	for _, sch := range indexes {
+		createStmt, err := sch.CreateIndexStatement()
+		debugAsserErr(err, "schema corruption, invalid sql statement for index: %s", sch.Name)
+
+		table, ok := out[TableName(createStmt.Table)]
+		debugAssert(ok, "schema corruption, table %s of index %s not found", createStmt.Table, sch.Name)
+		idx := IndexSchema{Name: sch.Name, Unique: createStmt.Unique, StartPage: sch.StartingPageID, Implicit: isImplicitIndex(sch.Name)}
+		for _, col := range createStmt.Columns {
+			idx.Columns = append(idx.Columns, FieldName(col))
+		}
+		table.Indexes = append(table.Indexes, idx)
+		out[TableName(createStmt.Table)] = table
+	}
+
 	return out
 }
 
+func tableSchemaFromCreate(stmt sql.CreateStatement) (TableSchema, error) {
+	res := TableSchema{}
+	for _, col := range stmt.Columns {
+		f, err := FieldTypeFromString(col.Typ)
+		if err != nil {
+			return res, fmt.Errorf("column %q: %w", col.Name, err)
+		}
+
+		res.FieldNames = append(res.FieldNames, FieldName(col.Name))
+		res.FieldsTypes = append(res.FieldsTypes, f)
+		if col.Constraints != (sql.ColumnConstraints{}) {
+			if res.Constraints == nil {
+				res.Constraints = map[FieldName]sql.ColumnConstraints{}
+			}
+			res.Constraints[FieldName(col.Name)] = col.Constraints
+		}
+		if col.Constraints.References != nil {
+			fk := *col.Constraints.References
+			fk.Column = col.Name
+			res.ForeignKeys = append(res.ForeignKeys, fk)
+		}
+	}
+	res.ForeignKeys = append(res.ForeignKeys, stmt.ForeignKeys...)
+	return res, nil
+}
+
 func (s *StorageEngine) SchemaTuples() iter.Seq[SchemaTuple] {
 	return func(yield func(SchemaTuple) bool) {
 		for tup := range s.Tuples(s.root.SchemaPageStart) {
@@ -90,125 +141,303 @@ func (s *StorageEngine) SchemaTuples() iter.Seq[SchemaTuple] {
 
 func (s *StorageEngine) Tuples(startingPageId PageID) iter.Seq[Tuple] {
 	return func(yield func(Tuple) bool) {
-		for _, page := range s.ReadPages(startingPageId) {
-			if page.PageTyp != DataPageType {
-				debugAssert(false, "page type %v != dataPageType", page.PageTyp)
-				continue
+		for _, tup := range s.TuplesWithID(startingPageId) {
+			if !yield(tup) {
+				return
 			}
+		}
+	}
+}
+
+// key of a tuple in its table b+tree, assigned on insert and never changed
+type RowID int64
+
+const rowIDKeySize = 8
 
-			p := must(DeserializeGenericPage(&page.GenericPageHeader, bytes.NewBuffer(page.data)))
-			for tup := range p.Iterator() {
-				if !yield(tup) {
-					return
-				}
+// big endian with flipped sign bit, so keys compare bytewise like the numbers
+func rowIDKey(id RowID) []byte {
+	return endinanness.AppendUint64(nil, uint64(id)^1<<63)
+}
+
+func rowIDFromKey(key []byte) RowID {
+	return RowID(endinanness.Uint64(key) ^ 1<<63)
+}
+
+// tuples ordered by their row id, walking leaves of the table tree
+func (s *StorageEngine) TuplesWithID(startingPageId PageID) iter.Seq2[RowID, Tuple] {
+	return func(yield func(RowID, Tuple) bool) {
+		for key, value := range s.tableTree(startingPageId).ascend(nil) {
+			if !yield(rowIDFromKey(key), *must(DeserializeTuple(value))) {
+				return
 			}
 		}
 	}
 }
 
-func (s *StorageEngine) AllocatePage(pageTyp PageType, name string) (PageID, *GenericPage) {
-	// find last page of the type
-	// connect to previous page
-	// or allocate complete new page, mark as start
-	// count number of pages
+// point lookup of a tuple by its row id
+func (s *StorageEngine) ReadTuple(startingPageId PageID, id RowID) (*Tuple, bool) {
+	value, ok := s.tableTree(startingPageId).get(rowIDKey(id))
+	if !ok {
+		return nil, false
+	}
+	return must(DeserializeTuple(value)), true
+}
 
-	p := NewPage(pageTyp, PageSize)
-	newPageID := PageID(s.root.NumberOfPages)
+// tree of the table with given name. Schema table is found from the root page,
+// so it can be used before its own tuple is written
+func (s *StorageEngine) treeOf(name string) (*bplusTree, error) {
+	if name == schemaName {
+		return s.tableTree(s.root.SchemaPageStart), nil
+	}
+	_, sch, ok := s.findSchemaTuple(name)
+	if !ok {
+		return nil, fmt.Errorf("table %v not found", name)
+	}
+	return s.tableTree(sch.StartingPageID), nil
+}
 
-	// link last page to the new one
-	if startPage, ok := FindStartingPage(s.GetSchema(), name); ok {
-		var lastPageID PageID
-		for id := range s.ReadPages(startPage) {
-			lastPageID = id
-		}
-		lastPage, _ := s.ReadGenericPage(lastPageID)
-		lastPage.Header.NextPage = newPageID
-		s.persistPage(lastPageID, lastPage.Serialize())
+// rewrites tuple under given id, overflow pages it no longer uses are freed
+func (s *StorageEngine) UpdateTuple(name string, id RowID, t Tuple) error {
+	tree, err := s.treeOf(name)
+	if err != nil {
+		return err
 	}
+	value, ok := tree.get(rowIDKey(id))
+	if !ok {
+		return fmt.Errorf("tuple %d for %s not found", id, name)
+	}
+	old := must(DeserializeTuple(value))
+
+	t, err = s.repackTupleForOverflows(t)
+	if err != nil {
+		return fmt.Errorf("failed to update tuple %d for %s: %w", id, name, err)
+	}
+	stale := s.staleOverflowPages(*old, &t)
+	if err := tree.put(rowIDKey(id), t.Serialize()); err != nil {
+		return fmt.Errorf("failed to update tuple %d for %s: %w", id, name, err)
+	}
+
+	s.freePages(stale)
+	return nil
+}
+
+// empty page, not linked to any other one
+func (s *StorageEngine) AllocatePage(pageTyp PageType) (PageID, *GenericPage) {
+	p := NewPage(pageTyp, PageSize)
+	newPageID := s.nextFreePageID()
 
-	s.root.NumberOfPages++
 	s.persistPage(0, s.root.Serialize())
 	s.persistPage(newPageID, p.Serialize())
 
 	return newPageID, p
 }
 
-func (s *StorageEngine) AddTuple(name string, t Tuple) (PageID, *GenericPage, error) {
-	schema := s.GetSchema()
+// takes a page from the free list, or grows the db when the list is empty.
+// Root page has to be persisted by the caller
+func (s *StorageEngine) nextFreePageID() PageID {
+	if s.root.FreePageStart != 0 {
+		id := s.root.FreePageStart
+		header, _, ok := s.ReadPage(id)
+		debugAssert(ok && header.PageTyp == FreePageType, "free list corruption, page %d is not free", id)
+		s.ReleasePage(id)
+		s.root.FreePageStart = header.NextPage
+		return id
+	}
+
+	id := PageID(s.root.NumberOfPages)
+	s.root.NumberOfPages++
+	return id
+}
 
-	pid, ok := s.FindLastPage(schema, name)
-	if !ok {
-		return 0, nil, fmt.Errorf("page for %v not found", name)
+// puts pages on the free list, so they can be allocated again
+func (s *StorageEngine) freePages(ids []PageID) {
+	if len(ids) == 0 {
+		return
+	}
+	for _, id := range ids {
+		p := NewPage(FreePageType, PageSize)
+		p.Header.NextPage = s.root.FreePageStart
+		s.persistPage(id, p.Serialize())
+		s.root.FreePageStart = id
 	}
-	page, ok := s.ReadGenericPage(pid)
-	debugAssert(ok, "data corruption, can't find page %d", pid)
+	s.persistPage(0, s.root.Serialize())
+}
 
-	t = s.repackTupleForOverflows(t)
+func (s *StorageEngine) overflowChainPages(firstPage PageID) []PageID {
+	var out []PageID
+	for id := range s.ReadPages(firstPage) {
+		out = append(out, id)
+	}
+	return out
+}
 
-	_, err := page.Add(t)
-	if errors.Is(err, errNoSpace) {
-		// realloc
-		newPageID, newPage := s.AllocatePage(page.Header.PageTyp, name)
-		_, err = newPage.Add(t)
-		if err != nil {
-			return 0, nil, fmt.Errorf("failed to realloc page for %s: %w", name, err)
+// overflow pages referenced by columns of old tuple, that new one does not point to anymore
+func (s *StorageEngine) staleOverflowPages(old Tuple, new *Tuple) []PageID {
+	stillUsed := map[string]bool{}
+	if new != nil {
+		for i, typ := range new.ColumnTypes {
+			if typ.isOverflow() {
+				stillUsed[string(new.ColumnDatas[i])] = true
+			}
 		}
-		s.persistPage(newPageID, newPage.Serialize())
-		return newPageID, newPage, nil
-	} else if err != nil {
-		return 0, nil, fmt.Errorf("failed to add tuple to page %d for %s: %w", pid, name, err)
 	}
 
-	s.persistPage(pid, page.Serialize())
-	return pid, page, nil
-}
+	var out []PageID
+	for i, typ := range old.ColumnTypes {
+		if !typ.isOverflow() || stillUsed[string(old.ColumnDatas[i])] {
+			continue
+		}
 
-func (s *StorageEngine) repackTupleForOverflows(t Tuple) Tuple {
-	for i := 0; i < int(t.NumberOfFields); i++ {
-		typ := t.ColumnTypes[i]
-		val := t.ColumnDatas[i]
+		buf := bytes.NewBuffer(old.ColumnDatas[i])
+		must(ReadInt(buf)) // length
+		firstPage := PageID(must(ReadInt(buf)))
+		out = append(out, s.overflowChainPages(firstPage)...)
+	}
+	return out
+}
 
-		if typ == StringField && len(val) >= PageSize/2 {
-			overFlowPageStartID := s.AllocateOverflowPage(val)
-			first := SerializeInt(int32(len(val)))
-			second := SerializeInt(int32(overFlowPageStartID))
-			serializedData := make([]byte, 0, 4+4)
-			serializedData = append(serializedData, first...)
-			serializedData = append(serializedData, second...)
-			t.ColumnTypes[i] = OverflowField
-			t.ColumnDatas[i] = serializedData
+func (s *StorageEngine) findSchemaTuple(name string) (RowID, *SchemaTuple, bool) {
+	for id, tup := range s.TuplesWithID(s.root.SchemaPageStart) {
+		if got := must(SchemaTupleFromTuple(tup)); got.Name == name {
+			return id, got, true
 		}
 	}
-	return t
+	return 0, nil, false
 }
 
-func FindStartingPage(s Schema, name string) (PageID, bool) {
-	got, ok := s[TableName(name)]
+func (s *StorageEngine) UpdateSchemaTuple(name string, sch SchemaTuple) error {
+	id, _, ok := s.findSchemaTuple(name)
 	if !ok {
-		return 0, false
+		return fmt.Errorf("table %v not found", name)
 	}
-	return got.StartPage, true
+	return s.UpdateTuple(schemaName, id, sch.ToTuple())
 }
 
-func (s *StorageEngine) FindLastPage(sch Schema, name string) (PageID, bool) {
-	pid, ok := FindStartingPage(sch, name)
+func (s *StorageEngine) DropTable(name string) error {
+	schemaRowID, sch, ok := s.findSchemaTuple(name)
 	if !ok {
-		return 0, false
+		return fmt.Errorf("table %v not found", name)
+	}
+
+	var toFree []PageID
+	for tup := range s.Tuples(sch.StartingPageID) {
+		toFree = append(toFree, s.staleOverflowPages(tup, nil)...)
 	}
+	toFree = append(toFree, s.tableTree(sch.StartingPageID).pages()...)
 
-	var lastPageID PageID
-	for id := range s.ReadPages(pid) {
-		lastPageID = id
+	if err := s.DeleteTuple(schemaName, schemaRowID); err != nil {
+		return fmt.Errorf("failed to remove %v from schema: %w", name, err)
 	}
-	return lastPageID, true
+	s.freePages(toFree)
+	return nil
+}
+
+func (s *StorageEngine) DropIndex(name string) error {
+	schemaRowID, sch, ok := s.findSchemaTuple(name)
+	if !ok || sch.PageTyp != IndexLeafPageType {
+		return fmt.Errorf("index %v not found", name)
+	}
+
+	toFree := s.indexTree(sch.StartingPageID).pages()
+	if err := s.DeleteTuple(schemaName, schemaRowID); err != nil {
+		return fmt.Errorf("failed to remove %v from schema: %w", name, err)
+	}
+	s.freePages(toFree)
+	return nil
+}
+
+// appends tuple to the table under the next row id, one bigger than the biggest used
+func (s *StorageEngine) AddTuple(name string, t Tuple) (RowID, error) {
+	tree, err := s.treeOf(name)
+	if err != nil {
+		return 0, err
+	}
+
+	id := RowID(1)
+	if last, ok := tree.last(); ok {
+		id = rowIDFromKey(last) + 1
+	}
+
+	t, err = s.repackTupleForOverflows(t)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add tuple to %s: %w", name, err)
+	} else if err := tree.put(rowIDKey(id), t.Serialize()); err != nil {
+		return 0, fmt.Errorf("failed to add tuple to %s: %w", name, err)
+	}
+	return id, nil
+}
+
+func (s *StorageEngine) DeleteTuple(name string, id RowID) error {
+	tree, err := s.treeOf(name)
+	if err != nil {
+		return err
+	}
+	value, ok := tree.get(rowIDKey(id))
+	if !ok {
+		return fmt.Errorf("tuple %d for %s not found", id, name)
+	}
+
+	old := must(DeserializeTuple(value))
+	tree.delete(rowIDKey(id))
+	s.freePages(s.staleOverflowPages(*old, nil))
+	return nil
+}
+
+// biggest tuple that fits in a table leaf, next to its row id key
+const maxTupleSize = maxCellSize - 4 - 8
+
+// big strings and blobs go to overflow pages. When the tuple is still too big
+// for a leaf, its biggest inline columns follow them
+func (s *StorageEngine) repackTupleForOverflows(t Tuple) (Tuple, error) {
+	overflowTypes := map[ColumnType]ColumnType{
+		StringField: OverflowField,
+		BlobField:   OverflowBlobField,
+	}
+	moveToOverflow := func(i int) {
+		val := t.ColumnDatas[i]
+		overFlowPageStartID := s.AllocateOverflowPage(val)
+		first := SerializeInt(int32(len(val)))
+		second := SerializeInt(int32(overFlowPageStartID))
+		serializedData := make([]byte, 0, 4+4)
+		serializedData = append(serializedData, first...)
+		serializedData = append(serializedData, second...)
+		t.ColumnTypes[i] = overflowTypes[t.ColumnTypes[i]]
+		t.ColumnDatas[i] = serializedData
+	}
+
+	for i := 0; i < int(t.NumberOfFields); i++ {
+		if _, ok := overflowTypes[t.ColumnTypes[i]]; ok && len(t.ColumnDatas[i]) >= PageSize/2 {
+			moveToOverflow(i)
+		}
+	}
+
+	for size := len(t.Serialize()); size > maxTupleSize; size = len(t.Serialize()) {
+		biggest := -1
+		for i, typ := range t.ColumnTypes {
+			if _, ok := overflowTypes[typ]; ok && (biggest == -1 || len(t.ColumnDatas[i]) > len(t.ColumnDatas[biggest])) {
+				biggest = i
+			}
+		}
+		if biggest == -1 {
+			return t, fmt.Errorf("tuple of %d bytes is too big, max is %d", size, maxTupleSize)
+		}
+		moveToOverflow(biggest)
+	}
+	return t, nil
+}
+
+func FindStartingPage(s Schema, name string) (PageID, bool) {
+	got, ok := s[TableName(name)]
+	if !ok {
+		return 0, false
+	}
+	return got.StartPage, true
 }
 
 func (s *StorageEngine) AllocateOverflowPage(data []byte) PageID {
 	// allocate pages to fit all data
 	// count pages
 	// return first page ID
-	firstPageID := PageID(s.root.NumberOfPages)
-
 	type pair struct {
 		pid  PageID
 		page *OverflowPage
@@ -218,7 +447,7 @@ func (s *StorageEngine) AllocateOverflowPage(data []byte) PageID {
 	idx := 0
 	for {
 		newPage, rest := NewOverflowPage(PageSize, data)
-		newPageID := PageID(s.root.NumberOfPages)
+		newPageID := s.nextFreePageID()
 
 		overFlowPages = append(overFlowPages, &pair{newPageID, newPage})
 
@@ -226,13 +455,13 @@ func (s *StorageEngine) AllocateOverflowPage(data []byte) PageID {
 			overFlowPages[idx-1].page.Header.NextPage = newPageID
 		}
 
-		s.root.NumberOfPages++
-
 		if len(rest) == 0 {
 			break
 		}
+		data = rest
 		idx++
 	}
+	firstPageID := overFlowPages[0].pid
 
 	for _, p := range overFlowPages {
 		s.persistPage(p.pid, p.page.Serialize())
@@ -242,40 +471,164 @@ func (s *StorageEngine) AllocateOverflowPage(data []byte) PageID {
 	return firstPageID
 }
 
+// header and the rest of the page, pinned in the pool until it's released.
+// Returned bytes are never modified, writing the page replaces them
 func (s *StorageEngine) ReadPage(id PageID) (*GenericPageHeader, []byte, bool) {
-	offset := byteOffsetFromPageID(id)
-	if offset >= len(s.allPages) {
+	f, ok := s.pin(id)
+	if !ok {
 		return nil, nil, false
 	}
 
-	pageBytes := s.allPages[offset : offset+PageSize]
-	buf := bytes.NewBuffer(pageBytes)
+	s.pagesRead++
+	buf := bytes.NewBuffer(f.data)
 	header := must(DeserializeGenericHeader(buf))
 	return header, buf.Bytes(), true
 }
 
-// convenience method to read and deserialize page
+// convenience method to read and deserialize page, pinned in the pool until it's released. Page is
+// deserialized once and shared by all readers until it's written again, it has to be cloned before modifying
 func (s *StorageEngine) ReadGenericPage(id PageID) (*GenericPage, bool) {
-	header, rest, ok := s.ReadPage(id)
+	f, ok := s.pin(id)
 	if !ok {
 		return nil, false
 	}
-	p := must(DeserializeGenericPage(header, bytes.NewBuffer(rest)))
-	return p, true
+
+	s.pagesRead++
+	if f.page == nil {
+		buf := bytes.NewBuffer(f.data)
+		f.page = must(DeserializeGenericPage(must(DeserializeGenericHeader(buf)), buf))
+	}
+	return f.page, true
+}
+
+// page read by ReadPage or ReadGenericPage is no longer used, it can be evicted
+func (s *StorageEngine) ReleasePage(id PageID) {
+	s.pool.unpin(id)
 }
 
-// store in persistance medium (in mem now)
+// pool errors are raised, so they surface from iterators at the statement boundary
+func (s *StorageEngine) pin(id PageID) (*frame, bool) {
+	f, ok, err := s.pool.pin(id)
+	if err != nil {
+		raise("%w", err)
+	}
+	return f, ok
+}
+
+// page is changed only after the change is in the log, LSN of the record is stored in the page
 func (s *StorageEngine) persistPage(id PageID, pageData []byte) {
 	debugAssert(len(pageData) == PageSize, "enforcing page size")
-	offset := byteOffsetFromPageID(id)
 
-	// realloc if needed
-	if offset+len(pageData) >= len(s.allPages) {
-		newBytes := make([]byte, PageSize*2*s.root.NumberOfPages)
-		copy(newBytes, s.allPages)
-		s.allPages = newBytes
+	before := make([]byte, PageSize) // pages past the end are empty
+	if data, ok := s.pool.peek(id); ok {
+		before = data
+	}
+	setPageLSN(id, pageData, pageLSN(id, before)) // not part of the change
+	changes := pageChanges(before, pageData)
+	if len(changes) == 0 {
+		return
+	}
+
+	if s.tx == 0 {
+		s.lastTx++
+		s.tx, s.txLastLSN = s.lastTx, 0
+	}
+	s.txLastLSN = s.appendLog(LogEntry{PrevLSN: s.txLastLSN, TxID: s.tx, Kind: LogUpdate, Page: id, Changes: changes})
+	setPageLSN(id, pageData, s.txLastLSN)
+	if id == 0 {
+		s.root.PageLSN = s.txLastLSN
+	}
+	if err := s.pool.write(id, pageData); err != nil {
+		raise("%w", err)
+	}
+}
+
+// log buffer is written to the log pages once it's full, so long transactions don't keep their records in memory
+func (s *StorageEngine) appendLog(e LogEntry) LSN {
+	lsn := s.log.Append(e)
+	if s.log.buffered() > logBufferSize {
+		if err := s.log.write(); err != nil {
+			raise("%w", err)
+		}
+	}
+	return lsn
+}
+
+// marks changes made since the last commit as committed
+func (s *StorageEngine) commit() {
+	if s.tx == 0 {
+		return
 	}
-	copy(s.allPages[offset:offset+len(pageData)], pageData)
+	s.log.Append(LogEntry{PrevLSN: s.txLastLSN, TxID: s.tx, Kind: LogCommit})
+	s.tx = 0
+}
+
+// last change of the transaction, rolling back to it undoes only changes made afterwards
+func (s *StorageEngine) savepoint() LSN {
+	if s.tx == 0 {
+		return 0
+	}
+	return s.txLastLSN
+}
+
+// undoes changes of the transaction made after the savepoint, logging compensations like recovery does.
+// Rolling back to 0 aborts the transaction
+func (s *StorageEngine) rollback(to LSN) (err error) {
+	defer recoverEvalError(&err)
+	if s.tx == 0 {
+		return nil
+	}
+	u := &undoState{last: s.txLastLSN, next: s.txLastLSN}
+	for u.next > to {
+		if err := s.undo(s.tx, u); err != nil {
+			return err
+		}
+	}
+	s.txLastLSN = u.last
+	if to == 0 {
+		s.log.Append(LogEntry{PrevLSN: u.last, TxID: s.tx, Kind: LogAbort})
+		s.tx = 0
+	}
+
+	// undo may have restored the root page
+	root, err := DeserializeRootPage(bytes.NewReader(s.pageImage(0)))
+	if err != nil {
+		return fmt.Errorf("reading root page: %w", err)
+	}
+	s.root = *root
+	return nil
+}
+
+// makes all changes durable. Log goes first, then pages are written to the file of the database.
+// Log is truncated afterwards when there is no transaction that could still need it,
+// pages past the end of the database, allocated by undone transactions, are dropped with it
+func (s *StorageEngine) Flush() error {
+	if err := s.log.flush(); err != nil {
+		return fmt.Errorf("writing log: %w", err)
+	} else if err := s.pool.flush(); err != nil {
+		return err
+	} else if s.tx != 0 {
+		return nil
+	} else if err := s.log.truncate(); err != nil {
+		return fmt.Errorf("truncating log: %w", err)
+	} else if err := s.pool.truncate(int(s.root.NumberOfPages)); err != nil {
+		return fmt.Errorf("dropping pages past the end: %w", err)
+	}
+	return nil
+}
+
+func (s *StorageEngine) Close() error {
+	err := s.Flush()
+	for _, closeErr := range []error{s.pool.close(), s.log.close()} {
+		if err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (s *StorageEngine) BufferPoolStats() BufferPoolStats {
+	return s.pool.Stats()
 }
 
 func (s *StorageEngine) ReadPages(startingPageID PageID) PageIteratorCombined {
@@ -285,7 +638,11 @@ func (s *StorageEngine) ReadPages(startingPageID PageID) PageIteratorCombined {
 			header, bytes, ok := s.ReadPage(pageID)
 			debugAssert(ok, "invalid pageID stored in the chain, page not found: %d", pageID)
 
-			if !yield(pageID, CombinedPageIteratorEntry{*header, bytes}) {
+			more := func() bool {
+				defer s.ReleasePage(pageID)
+				return yield(pageID, CombinedPageIteratorEntry{*header, bytes})
+			}()
+			if !more {
 				return
 			}
 			pageID = header.NextPage
@@ -2,8 +2,18 @@ package naive
 
 import (
 	"bytes"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"os"
+	"path/filepath"
+	"simple-db/sql"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -19,13 +29,13 @@ func TestNaiveStorage(t *testing.T) {
 				FieldsTypes: []FieldType{Int32, Boolean, String},
 				FieldNames:  []FieldName{"abc", "asdf", "xxx"},
 				StartPage:   2,
-				PageTyp:     DataPageType,
+				PageTyp:     TableLeafPageType,
 			},
 			schemaName: TableSchema{
 				FieldsTypes: []FieldType{Int32, Int32, String, String},
 				FieldNames:  []FieldName{"page_type", "starting_page_id", "name", "sql_statement"},
 				StartPage:   1,
-				PageTyp:     DataPageType,
+				PageTyp:     TableLeafPageType,
 			},
 		})
 	})
@@ -286,6 +296,7 @@ func TestSerializeStorage(t *testing.T) {
 		readPage := func(s *Database, id PageID) *GenericPage {
 			t.Helper()
 			got, _ := s.storage.ReadGenericPage(id)
+			s.storage.ReleasePage(id)
 			return got
 		}
 
@@ -332,3 +343,3060 @@ func testSelect(t *testing.T, prep []string, queryStr string, exp QueryResult) {
 	assert.Len(t, res.Values, len(res.Values))
 	assert.ElementsMatch(t, exp.Values, res.Values)
 }
+
+func TestUpdate(t *testing.T) {
+	prep := []string{
+		`create table foobar(id int, name string, age int)`,
+		`insert into foobar(id, name, age) VALUES (1, "asdf", 20)`,
+		`insert into foobar(id, name, age) VALUES (2, "baz", 30)`,
+		`insert into foobar(id, name, age) VALUES (3, "baz", 20)`,
+	}
+
+	t.Run("update with filter", func(t *testing.T) {
+		s := prepareDb(t, prep)
+
+		assertUpdated(t, s, `update foobar set name = "changed", age = 21 where name = "baz"`, 2)
+
+		res, err := query(t, s, "select * from foobar")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{
+			{"1", "asdf", "20"},
+			{"2", "changed", "21"},
+			{"3", "changed", "21"},
+		}, res.Values)
+	})
+
+	t.Run("update all rows using column values", func(t *testing.T) {
+		s := prepareDb(t, prep)
+
+		assertUpdated(t, s, `update foobar set age = id, id = age`, 3)
+
+		res, err := query(t, s, "select id, age from foobar")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"20", "1"}, {"30", "2"}, {"20", "3"}}, res.Values)
+	})
+
+	t.Run("update to null", func(t *testing.T) {
+		s := prepareDb(t, prep)
+
+		assertUpdated(t, s, `update foobar set name = null where id = 1`, 1)
+
+		res, err := query(t, s, "select name from foobar where id = 1")
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"<nil>"}}, res.Values)
+	})
+
+	t.Run("nothing matched", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertUpdated(t, s, `update foobar set name = "x" where id = 10`, 0)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		s := prepareDb(t, prep)
+
+		_, err := s.Execute(`update nope set name = "x"`)
+		assert.Error(t, err)
+
+		_, err = s.Execute(`update foobar set oops = "x"`)
+		assert.Error(t, err)
+
+		_, err = s.Execute(`update foobar set id = "x"`)
+		assert.Error(t, err)
+
+		for _, stmt := range []string{
+			`update foobar set name = nme`,
+			`update foobar set name = coalesce(nme, "x")`,
+			`update foobar set name = "x" where nope = 1`,
+			`update foobar set name = "x" where other.id = 1`,
+		} {
+			_, err = s.Execute(stmt)
+			assert.ErrorContains(t, err, "unknown column", stmt)
+		}
+		res, err := query(t, s, "select name from foobar")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"asdf"}, {"baz"}, {"baz"}}, res.Values, "rows are not changed")
+	})
+
+	t.Run("qualified columns", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertUpdated(t, s, `update foobar set age = foobar.age + 1 where foobar.id = 2`, 1)
+
+		res, err := query(t, s, "select age from foobar where id = 2")
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"31"}}, res.Values)
+	})
+
+	t.Run("growing tuples split their leaf", func(t *testing.T) {
+		s := prepareDb(t, []string{`create table foobar(id int, name string)`})
+		for i := range 60 {
+			assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into foobar(id, name) VALUES (%d, "%s")`, i, generateBigStr(50))))
+		}
+		pages := s.storage.root.NumberOfPages
+
+		bigger := generateBigStr(1000)
+		assertUpdated(t, s, fmt.Sprintf(`update foobar set name = "%s" where id < 4`, bigger), 4)
+		assert.Greater(t, s.storage.root.NumberOfPages, pages)
+
+		res, err := query(t, s, "select * from foobar")
+		assert.NoError(t, err)
+		assert.Len(t, res.Values, 60)
+
+		res, err = query(t, s, "select name from foobar where id = 1")
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{bigger}}, res.Values)
+	})
+
+	t.Run("overflow column grows and shrinks", func(t *testing.T) {
+		s := prepareDb(t, prep)
+
+		bigString := generateBigStr(3000)
+		assertUpdated(t, s, fmt.Sprintf(`update foobar set name = "%s" where id = 2`, bigString), 1)
+
+		res, err := query(t, s, "select name, age from foobar where id = 2")
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{bigString, "30"}}, res.Values)
+
+		// other column changes, overflow data is kept
+		assertUpdated(t, s, `update foobar set age = 31 where id = 2`, 1)
+		res, err = query(t, s, "select name, age from foobar where id = 2")
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{bigString, "31"}}, res.Values)
+
+		assertUpdated(t, s, `update foobar set name = "small" where id = 2`, 1)
+		res, err = query(t, s, "select name, age from foobar where id = 2")
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"small", "31"}}, res.Values)
+	})
+
+	t.Run("updated db survives serialization", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertUpdated(t, s, `update foobar set name = "much longer name than before" where id = 1`, 1)
+
+		recoveredDb, err := NewDatabaseFromBytes(bytes.NewReader(s.Serialize()))
+		assert.NoError(t, err)
+
+		res, err := query(t, recoveredDb, "select * from foobar")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{
+			{"1", "much longer name than before", "20"},
+			{"2", "baz", "30"},
+			{"3", "baz", "20"},
+		}, res.Values)
+	})
+}
+
+func prepareDb(t *testing.T, prep []string) *Database {
+	t.Helper()
+
+	s := NewDatabase()
+	for _, v := range prep {
+		assert.NoError(t, execute(t, s, v))
+	}
+	return s
+}
+
+func assertUpdated(t *testing.T, s *Database, statement string, expected int) {
+	t.Helper()
+
+	got, err := s.Execute(statement)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, got)
+}
+
+func TestDelete(t *testing.T) {
+	prep := []string{
+		`create table foobar(id int, name string, age int)`,
+		`insert into foobar(id, name, age) VALUES (1, "asdf", 20)`,
+		`insert into foobar(id, name, age) VALUES (2, "baz", 30)`,
+		`insert into foobar(id, name, age) VALUES (3, "baz", 20)`,
+	}
+
+	t.Run("delete with filter", func(t *testing.T) {
+		s := prepareDb(t, prep)
+
+		assertUpdated(t, s, `delete from foobar where name = "baz"`, 2)
+
+		res, err := query(t, s, "select * from foobar")
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"1", "asdf", "20"}}, res.Values)
+	})
+
+	t.Run("delete everything", func(t *testing.T) {
+		s := prepareDb(t, prep)
+
+		assertUpdated(t, s, `delete from foobar`, 3)
+		assertUpdated(t, s, `delete from foobar`, 0)
+
+		res, err := query(t, s, "select * from foobar")
+		assert.NoError(t, err)
+		assert.Empty(t, res.Values)
+	})
+
+	t.Run("unknown table", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		_, err := s.Execute(`delete from nope`)
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown column", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		for _, stmt := range []string{
+			`delete from foobar where nmae is null`,
+			`delete from foobar where id = 1 or nope = 2`,
+			`delete from foobar where other.id is null`,
+		} {
+			_, err := s.Execute(stmt)
+			assert.ErrorContains(t, err, "unknown column", stmt)
+		}
+		res, err := query(t, s, "select id from foobar")
+		assert.NoError(t, err)
+		assert.Len(t, res.Values, 3, "nothing is deleted")
+	})
+
+	t.Run("qualified column", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertUpdated(t, s, `delete from foobar where foobar.name = "baz"`, 2)
+	})
+
+	t.Run("deleted rows survive serialization", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertUpdated(t, s, `delete from foobar where id = 2`, 1)
+
+		recoveredDb, err := NewDatabaseFromBytes(bytes.NewReader(s.Serialize()))
+		assert.NoError(t, err)
+
+		res, err := query(t, recoveredDb, "select id from foobar")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"1"}, {"3"}}, res.Values)
+	})
+
+	t.Run("freed space is reused", func(t *testing.T) {
+		s := prepareDb(t, []string{`create table foobar(id int, name string)`})
+		insertAll := func() {
+			for i := range 150 {
+				assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into foobar(id, name) VALUES (%d, "%s")`, i, generateBigStr(50))))
+			}
+		}
+
+		insertAll()
+		pages := s.storage.root.NumberOfPages
+
+		for range 3 {
+			assertUpdated(t, s, `delete from foobar`, 150)
+			insertAll()
+		}
+		assert.Equal(t, pages, s.storage.root.NumberOfPages)
+
+		res, err := query(t, s, "select id from foobar")
+		assert.NoError(t, err)
+		assert.Len(t, res.Values, 150)
+	})
+
+	t.Run("deleting every other row makes space for bigger tuples", func(t *testing.T) {
+		s := prepareDb(t, []string{`create table foobar(id int, name string)`})
+		for i := range 100 {
+			assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into foobar(id, name) VALUES (%d, "%s")`, i, generateBigStr(50))))
+		}
+		pages := s.storage.root.NumberOfPages
+
+		for i := 0; i < 100; i += 2 {
+			assertUpdated(t, s, fmt.Sprintf(`delete from foobar where id = %d`, i), 1)
+		}
+		for i := range 20 {
+			assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into foobar(id, name) VALUES (%d, "%s")`, 1000+i, generateBigStr(100))))
+		}
+		assert.Equal(t, pages, s.storage.root.NumberOfPages)
+
+		res, err := query(t, s, "select id from foobar")
+		assert.NoError(t, err)
+		assert.Len(t, res.Values, 70)
+	})
+}
+
+func TestGenericPageCells(t *testing.T) {
+	p := NewPage(TableLeafPageType, PageSize)
+	for _, c := range []string{"a", "c", "d"} {
+		assert.NoError(t, p.AppendCell([]byte(c)))
+	}
+	assert.NoError(t, p.insertCell(1, []byte("b")))
+	p.removeCell(3)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, slices.Collect(p.Cells()))
+
+	// removed and replaced cells leave space, compaction reclaims it
+	big := bytes.Repeat([]byte("x"), PageSize/3)
+	for range 10 {
+		assert.NoError(t, p.replaceCell(2, big))
+	}
+	assert.ErrorIs(t, p.AppendCell(bytes.Repeat([]byte("y"), PageSize)), errNoSpace)
+
+	recovered, err := DeserializeGenericPage(&p.Header, bytes.NewBuffer(p.Serialize()[genericHeaderSize:]))
+	assert.NoError(t, err)
+	assert.Equal(t, slices.Collect(p.Cells()), slices.Collect(recovered.Cells()))
+}
+
+func TestTableTree(t *testing.T) {
+	tup := func(id int, size int) Tuple {
+		return Tuple{
+			NumberOfFields: 2,
+			ColumnTypes:    []ColumnType{IntField, StringField},
+			ColumnDatas:    [][]byte{SerializeInt(int32(id)), SerializeString(generateBigStr(size))},
+		}
+	}
+	idOf := func(t Tuple) int32 {
+		return must(ReadInt(bytes.NewBuffer(t.ColumnDatas[0])))
+	}
+	fill := func(t *testing.T, n int) (*StorageEngine, PageID) {
+		t.Helper()
+		s := NewStorageEngine()
+		root, _ := s.AllocatePage(TableLeafPageType)
+		_, err := s.AddTuple(schemaName, SchemaTuple{
+			PageTyp:        TableLeafPageType,
+			StartingPageID: root,
+			Name:           "foobar",
+			SqlStatement:   `create table foobar(id int, name string)`,
+		}.ToTuple())
+		assert.NoError(t, err)
+		for i := range n {
+			id, err := s.AddTuple("foobar", tup(i, 10+i%200))
+			assert.NoError(t, err)
+			assert.EqualValues(t, i+1, id)
+		}
+		return s, root
+	}
+
+	t.Run("rows are ordered by row id across leaves", func(t *testing.T) {
+		s, root := fill(t, 2000)
+		rootPage, _ := s.ReadGenericPage(root)
+		s.ReleasePage(root)
+		assert.Equal(t, TableInteriorPageType, rootPage.Header.PageTyp)
+
+		var ids []RowID
+		for id, tup := range s.TuplesWithID(root) {
+			assert.EqualValues(t, id-1, idOf(tup))
+			ids = append(ids, id)
+		}
+		assert.Len(t, ids, 2000)
+		assert.True(t, slices.IsSorted(ids))
+
+		got, ok := s.ReadTuple(root, 1234)
+		assert.True(t, ok)
+		assert.EqualValues(t, 1233, idOf(*got))
+		_, ok = s.ReadTuple(root, 2001)
+		assert.False(t, ok)
+
+		var fromMiddle []RowID
+		for key := range s.tableTree(root).ascend(rowIDKey(1990)) {
+			fromMiddle = append(fromMiddle, rowIDFromKey(key))
+		}
+		assert.Equal(t, []RowID{1990, 1991, 1992, 1993, 1994, 1995, 1996, 1997, 1998, 1999, 2000}, fromMiddle)
+	})
+
+	t.Run("deletes merge pages back to a single leaf", func(t *testing.T) {
+		s, root := fill(t, 2000)
+		pages := s.root.NumberOfPages
+
+		for i := range 2000 {
+			// every other row first, so merges happen in the middle of the tree
+			id := RowID(i*2%2000 + 1 + i*2/2000)
+			assert.NoError(t, s.DeleteTuple("foobar", id))
+		}
+		assert.Error(t, s.DeleteTuple("foobar", 1))
+
+		rootPage, _ := s.ReadGenericPage(root)
+		s.ReleasePage(root)
+		assert.Equal(t, TableLeafPageType, rootPage.Header.PageTyp)
+		assert.Zero(t, rootPage.cellCount())
+		assert.Len(t, s.tableTree(root).pages(), 1)
+
+		for i := range 2000 {
+			_, err := s.AddTuple("foobar", tup(i, 10+i%200))
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, pages, s.root.NumberOfPages, "freed pages should be reused")
+	})
+
+	t.Run("update keeps row id", func(t *testing.T) {
+		s, root := fill(t, 300)
+		for id := RowID(1); id <= 300; id += 3 {
+			assert.NoError(t, s.UpdateTuple("foobar", id, tup(int(id-1), 1000)))
+		}
+		assert.Error(t, s.UpdateTuple("foobar", 301, tup(0, 10)))
+
+		count := 0
+		for id, tup := range s.TuplesWithID(root) {
+			assert.EqualValues(t, id-1, idOf(tup))
+			count++
+		}
+		assert.Equal(t, 300, count)
+	})
+
+	t.Run("too big tuples are moved to overflow pages", func(t *testing.T) {
+		s, root := fill(t, 0)
+		big := Tuple{
+			NumberOfFields: 3,
+			ColumnTypes:    []ColumnType{StringField, StringField, StringField},
+			ColumnDatas:    [][]byte{SerializeString(generateBigStr(1500)), SerializeString(generateBigStr(1000)), SerializeString(generateBigStr(1000))},
+		}
+		id, err := s.AddTuple("foobar", big)
+		assert.NoError(t, err)
+
+		got, ok := s.ReadTuple(root, id)
+		assert.True(t, ok)
+		assert.Equal(t, []ColumnType{OverflowField, OverflowField, StringField}, got.ColumnTypes)
+
+		tooWide := Tuple{NumberOfFields: 200}
+		for range 200 {
+			tooWide.ColumnTypes = append(tooWide.ColumnTypes, BigIntField)
+			tooWide.ColumnDatas = append(tooWide.ColumnDatas, SerializeInt64(1))
+		}
+		_, err = s.AddTuple("foobar", tooWide)
+		assert.Error(t, err)
+	})
+
+	t.Run("tree survives serialization", func(t *testing.T) {
+		s := prepareDb(t, []string{`create table foobar(id int, name string)`})
+		for i := range 300 {
+			assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into foobar(id, name) VALUES (%d, "%s")`, i, generateBigStr(50))))
+		}
+
+		recovered, err := NewDatabaseFromBytes(bytes.NewReader(s.Serialize()))
+		assert.NoError(t, err)
+		res, err := query(t, recovered, `select id from foobar where id >= 298`)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"298"}, {"299"}}, res.Values)
+	})
+}
+
+func TestDropTable(t *testing.T) {
+	fillTable := func(t *testing.T, s *Database, name string) {
+		t.Helper()
+		assert.NoError(t, execute(t, s, fmt.Sprintf(`create table %s(id int, name string)`, name)))
+		for i := range 120 {
+			assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into %s(id, name) VALUES (%d, "%s")`, name, i, generateBigStr(50))))
+		}
+		assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into %s(id, name) VALUES (1000, "%s")`, name, generateBigStr(3*PageSize))))
+	}
+
+	t.Run("drop table", func(t *testing.T) {
+		s := prepareDb(t, []string{
+			`create table foobar(id int, name string)`,
+			`create table other(id int)`,
+			`insert into foobar(id, name) VALUES (1, "asdf")`,
+		})
+
+		assert.NoError(t, execute(t, s, `drop table foobar`))
+
+		_, ok := s.Schema()["foobar"]
+		assert.False(t, ok)
+		_, ok = s.Schema()["other"]
+		assert.True(t, ok)
+
+		_, err := s.Execute("select * from foobar")
+		assert.Error(t, err)
+
+		assert.NoError(t, execute(t, s, `create table foobar(id int)`))
+		res, err := query(t, s, "select * from foobar")
+		assert.NoError(t, err)
+		assert.Empty(t, res.Values)
+	})
+
+	t.Run("drop missing table", func(t *testing.T) {
+		s := NewDatabase()
+		assert.Error(t, execute(t, s, `drop table foobar`))
+		assert.NoError(t, execute(t, s, `drop table if exists foobar`))
+		assert.Error(t, execute(t, s, `drop table `+schemaName))
+	})
+
+	t.Run("dropped pages are reused", func(t *testing.T) {
+		s := NewDatabase()
+		fillTable(t, s, "foobar")
+		pages := s.storage.root.NumberOfPages
+
+		assert.NoError(t, execute(t, s, `drop table foobar`))
+		assert.NotZero(t, s.storage.root.FreePageStart)
+
+		fillTable(t, s, "other")
+		assert.Equal(t, pages, s.storage.root.NumberOfPages)
+
+		res, err := query(t, s, "select id from other")
+		assert.NoError(t, err)
+		assert.Len(t, res.Values, 121)
+	})
+
+	t.Run("free list survives serialization", func(t *testing.T) {
+		s := NewDatabase()
+		fillTable(t, s, "foobar")
+		assert.NoError(t, execute(t, s, `drop table foobar`))
+
+		recoveredDb, err := NewDatabaseFromBytes(bytes.NewReader(s.Serialize()))
+		assert.NoError(t, err)
+		assert.Equal(t, s.storage.root, recoveredDb.storage.root)
+
+		pages := recoveredDb.storage.root.NumberOfPages
+		fillTable(t, recoveredDb, "other")
+		assert.Equal(t, pages, recoveredDb.storage.root.NumberOfPages)
+	})
+
+	t.Run("overflow pages of updated and deleted rows are reused", func(t *testing.T) {
+		s := prepareDb(t, []string{`create table foobar(id int, name string)`})
+		bigString := generateBigStr(2 * PageSize)
+		assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into foobar(id, name) VALUES (1, "%s")`, bigString)))
+		assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into foobar(id, name) VALUES (2, "%s")`, bigString)))
+		pages := s.storage.root.NumberOfPages
+
+		assertUpdated(t, s, `update foobar set name = "small" where id = 1`, 1)
+		assertUpdated(t, s, `delete from foobar where id = 2`, 1)
+		assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into foobar(id, name) VALUES (3, "%s")`, bigString)))
+		assertUpdated(t, s, fmt.Sprintf(`update foobar set name = "%s" where id = 1`, bigString), 1)
+		assert.Equal(t, pages, s.storage.root.NumberOfPages)
+
+		res, err := query(t, s, "select * from foobar")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"1", bigString}, {"3", bigString}}, res.Values)
+	})
+}
+
+func TestAlterTable(t *testing.T) {
+	prep := []string{
+		`create table foobar(id int, name string)`,
+		`insert into foobar(id, name) VALUES (1, "asdf")`,
+		`insert into foobar(id, name) VALUES (2, "baz")`,
+	}
+
+	t.Run("add column reads old tuples as null", func(t *testing.T) {
+		s := prepareDb(t, prep)
+
+		assert.NoError(t, execute(t, s, `alter table foobar add column age int`))
+		assert.NoError(t, execute(t, s, `insert into foobar(id, name, age) VALUES (3, "new", 30)`))
+
+		assert.Equal(t, []FieldName{"id", "name", "age"}, s.Schema()["foobar"].FieldNames)
+		res, err := query(t, s, "select * from foobar")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{
+			{"1", "asdf", "<nil>"},
+			{"2", "baz", "<nil>"},
+			{"3", "new", "30"},
+		}, res.Values)
+
+		assertUpdated(t, s, `update foobar set age = 10 where id = 1`, 1)
+		res, err = query(t, s, "select age from foobar where id = 1")
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"10"}}, res.Values)
+	})
+
+	t.Run("add column reads old tuples as default", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assert.NoError(t, execute(t, s, `alter table foobar add column age int default 7`))
+		assert.NoError(t, execute(t, s, `alter table foobar add column nick string`))
+		for _, tup := range s.storage.TuplesWithID(s.Schema()["foobar"].StartPage) {
+			assert.Equal(t, int32(2), tup.NumberOfFields, "tuples are not rewritten")
+		}
+
+		assertUpdated(t, s, `update foobar set nick = "b" where id = 2`, 1)
+		assert.NoError(t, execute(t, s, `create index foobar_age on foobar(age)`))
+		res, err := query(t, s, "select id, age, nick from foobar where age = 7")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"1", "7", "<nil>"}, {"2", "7", "b"}}, res.Values)
+	})
+
+	t.Run("drop column", func(t *testing.T) {
+		s := prepareDb(t, append(prep, `alter table foobar add column age int`))
+		assert.NoError(t, execute(t, s, `insert into foobar(id, name, age) VALUES (3, "new", 30)`))
+
+		assert.NoError(t, execute(t, s, `alter table foobar drop column name`))
+
+		assert.Equal(t, []FieldName{"id", "age"}, s.Schema()["foobar"].FieldNames)
+		res, err := query(t, s, "select * from foobar")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"1", "<nil>"}, {"2", "<nil>"}, {"3", "30"}}, res.Values)
+	})
+
+	t.Run("drop overflow column frees its pages", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into foobar(id, name) VALUES (3, "%s")`, generateBigStr(2*PageSize))))
+
+		assert.NoError(t, execute(t, s, `alter table foobar drop name`))
+		assert.NotZero(t, s.storage.root.FreePageStart)
+
+		res, err := query(t, s, "select * from foobar")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"1"}, {"2"}, {"3"}}, res.Values)
+	})
+
+	t.Run("rename column", func(t *testing.T) {
+		s := prepareDb(t, prep)
+
+		assert.NoError(t, execute(t, s, `alter table foobar rename column name to title`))
+
+		res, err := query(t, s, `select title from foobar where title = "baz"`)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"baz"}}, res.Values)
+
+		_, err = s.Execute(`select name from foobar`)
+		assert.Error(t, err)
+	})
+
+	t.Run("rename table", func(t *testing.T) {
+		s := prepareDb(t, prep)
+
+		assert.NoError(t, execute(t, s, `alter table foobar rename to barfoo`))
+		assert.NoError(t, execute(t, s, `insert into barfoo(id, name) VALUES (3, "new")`))
+
+		_, err := s.Execute(`select * from foobar`)
+		assert.Error(t, err)
+
+		res, err := query(t, s, `select id from barfoo`)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"1"}, {"2"}, {"3"}}, res.Values)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		s := prepareDb(t, append(prep, `create table other(id int)`))
+
+		assert.Error(t, execute(t, s, `alter table nope add column age int`))
+		assert.Error(t, execute(t, s, `alter table foobar add column name string`))
+		assert.Error(t, execute(t, s, `alter table foobar add column age unknowntype`))
+		assert.Error(t, execute(t, s, `alter table foobar drop column nope`))
+		assert.Error(t, execute(t, s, `alter table other drop column id`))
+		assert.Error(t, execute(t, s, `alter table foobar rename column nope to other`))
+		assert.Error(t, execute(t, s, `alter table foobar rename column id to name`))
+		assert.Error(t, execute(t, s, `alter table foobar rename to other`))
+		assert.Error(t, execute(t, s, `alter table `+schemaName+` add column foo int`))
+	})
+
+	t.Run("altered schema survives serialization", func(t *testing.T) {
+		s := prepareDb(t, append(prep, `alter table foobar add column age int`))
+
+		recoveredDb, err := NewDatabaseFromBytes(bytes.NewReader(s.Serialize()))
+		assert.NoError(t, err)
+		assert.Equal(t, s.Schema(), recoveredDb.Schema())
+	})
+}
+
+func TestJoin(t *testing.T) {
+	prep := []string{
+		`create table users(id int, name string)`,
+		`create table orders(id int, user_id int, item string)`,
+		`create table colors(color string)`,
+		`insert into users(id, name) VALUES (1, "alice")`,
+		`insert into users(id, name) VALUES (2, "bob")`,
+		`insert into users(id, name) VALUES (3, "carol")`,
+		`insert into orders(id, user_id, item) VALUES (10, 1, "book")`,
+		`insert into orders(id, user_id, item) VALUES (11, 1, "pen")`,
+		`insert into orders(id, user_id, item) VALUES (12, 3, "cup")`,
+		`insert into colors(color) VALUES ("red")`,
+		`insert into colors(color) VALUES ("blue")`,
+	}
+
+	t.Run("inner join", func(t *testing.T) {
+		testSelect(t, prep, `select name, item from users join orders on users.id = orders.user_id`, QueryResult{
+			[]FieldName{"name", "item"},
+			[][]string{{"alice", "book"}, {"alice", "pen"}, {"carol", "cup"}},
+		})
+	})
+
+	t.Run("inner join with where and qualified columns", func(t *testing.T) {
+		testSelect(t, prep, `select users.id, orders.id from users inner join orders on users.id = user_id where item = "pen"`, QueryResult{
+			[]FieldName{"users.id", "orders.id"},
+			[][]string{{"1", "11"}},
+		})
+	})
+
+	t.Run("left join", func(t *testing.T) {
+		testSelect(t, prep, `select name, item from users left outer join orders on users.id = orders.user_id`, QueryResult{
+			[]FieldName{"name", "item"},
+			[][]string{{"alice", "book"}, {"alice", "pen"}, {"bob", "<nil>"}, {"carol", "cup"}},
+		})
+	})
+
+	t.Run("cross join", func(t *testing.T) {
+		testSelect(t, prep, `select name, color from users, colors`, QueryResult{
+			[]FieldName{"name", "color"},
+			[][]string{
+				{"alice", "red"}, {"alice", "blue"},
+				{"bob", "red"}, {"bob", "blue"},
+				{"carol", "red"}, {"carol", "blue"},
+			},
+		})
+	})
+
+	t.Run("wildcard uses qualified names", func(t *testing.T) {
+		testSelect(t, prep, `select * from users join orders on users.id = orders.user_id where orders.id = 12`, QueryResult{
+			[]FieldName{"users.id", "users.name", "orders.id", "orders.user_id", "orders.item"},
+			[][]string{{"3", "carol", "12", "3", "cup"}},
+		})
+	})
+
+	t.Run("three tables", func(t *testing.T) {
+		testSelect(t, prep, `select name, item, color from users join orders on users.id = user_id, colors where color = "red"`, QueryResult{
+			[]FieldName{"name", "item", "color"},
+			[][]string{{"alice", "book", "red"}, {"alice", "pen", "red"}, {"carol", "cup", "red"}},
+		})
+	})
+
+	t.Run("qualified column in single table select", func(t *testing.T) {
+		testSelect(t, prep, `select users.name from users where users.id = 2`, QueryResult{
+			[]FieldName{"users.name"},
+			[][]string{{"bob"}},
+		})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		for _, q := range []string{
+			`select id from users join orders on users.id = orders.user_id`,
+			`select name from users join orders on id = user_id`,
+			`select name from users join nope on users.id = nope.id`,
+			`select name from users join users on users.id = users.id`,
+			`select users.nope from users`,
+			`select name from users where orders.id = 1`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+	})
+}
+
+func TestOrderBy(t *testing.T) {
+	prep := []string{
+		`create table users(id int, name string, age int)`,
+		`insert into users(id, name, age) VALUES (1, "carol", 30)`,
+		`insert into users(id, name, age) VALUES (2, "alice", null)`,
+		`insert into users(id, name, age) VALUES (3, "bob", 25)`,
+		`insert into users(id, name, age) VALUES (4, "dave", 30)`,
+	}
+
+	testOrdered := func(t *testing.T, s *Database, q string, exp [][]string) {
+		t.Helper()
+		res, err := query(t, s, q)
+		assert.NoError(t, err)
+		assert.Equal(t, exp, res.Values)
+	}
+
+	t.Run("ascending", func(t *testing.T) {
+		testOrdered(t, prepareDb(t, prep), `select name from users order by name`,
+			[][]string{{"alice"}, {"bob"}, {"carol"}, {"dave"}})
+	})
+
+	t.Run("descending", func(t *testing.T) {
+		testOrdered(t, prepareDb(t, prep), `select name from users order by name desc`,
+			[][]string{{"dave"}, {"carol"}, {"bob"}, {"alice"}})
+	})
+
+	t.Run("multiple keys", func(t *testing.T) {
+		testOrdered(t, prepareDb(t, prep), `select id from users order by age desc nulls last, name asc`,
+			[][]string{{"1"}, {"4"}, {"3"}, {"2"}})
+	})
+
+	t.Run("nulls are last by default", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		testOrdered(t, s, `select id from users order by age, id`,
+			[][]string{{"3"}, {"1"}, {"4"}, {"2"}})
+		testOrdered(t, s, `select id from users order by age desc, id`,
+			[][]string{{"2"}, {"1"}, {"4"}, {"3"}})
+	})
+
+	t.Run("explicit nulls order", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		testOrdered(t, s, `select id from users order by age nulls first, id`,
+			[][]string{{"2"}, {"3"}, {"1"}, {"4"}})
+		testOrdered(t, s, `select id from users order by age desc nulls last, id`,
+			[][]string{{"1"}, {"4"}, {"3"}, {"2"}})
+	})
+
+	t.Run("by column not in projection", func(t *testing.T) {
+		testOrdered(t, prepareDb(t, prep), `select name from users order by id desc`,
+			[][]string{{"dave"}, {"bob"}, {"alice"}, {"carol"}})
+	})
+
+	t.Run("with join", func(t *testing.T) {
+		s := prepareDb(t, append(prep,
+			`create table orders(user_id int, item string)`,
+			`insert into orders(user_id, item) VALUES (3, "pen")`,
+			`insert into orders(user_id, item) VALUES (1, "book")`,
+			`insert into orders(user_id, item) VALUES (3, "cup")`,
+		))
+		testOrdered(t, s, `select name, item from users join orders on users.id = orders.user_id order by users.name, orders.item desc`,
+			[][]string{{"bob", "pen"}, {"bob", "cup"}, {"carol", "book"}})
+	})
+
+	t.Run("spills to temporary files", func(t *testing.T) {
+		s := prepareDb(t, []string{`create table nums(id int, label string)`})
+		exp := [][]string{}
+		for i := range 200 {
+			id := (i * 37) % 200
+			assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into nums(id, label) VALUES (%d, "%s")`, id, generateBigStr(50))))
+		}
+		for i := range 200 {
+			exp = append(exp, []string{fmt.Sprint(i)})
+		}
+		s.storage.tempDir = t.TempDir()
+
+		rows := []Row{{"id": {Typ: Int32, Data: int32(1)}}, {"id": {Typ: Null}, "label": {Typ: String, Data: "x"}}}
+		run, release := s.storage.Spill(rows)
+		assert.Len(t, must(os.ReadDir(s.storage.tempDir)), 1)
+		assert.Equal(t, rows, slices.Collect(iter.Seq[Row](run)))
+		assert.Equal(t, rows, slices.Collect(iter.Seq[Row](run)), "run can be read again")
+		release()
+		assert.Empty(t, must(os.ReadDir(s.storage.tempDir)))
+
+		// runs don't touch the database and are removed when the query ends
+		pagesBefore, lsnBefore := s.storage.root.NumberOfPages, s.storage.log.lastLsn
+		s.SortMemoryBudget = 1024
+		testOrdered(t, s, `select id from nums order by id`, exp)
+		assert.Equal(t, pagesBefore, s.storage.root.NumberOfPages)
+		assert.Equal(t, lsnBefore, s.storage.log.lastLsn)
+		assert.Empty(t, must(os.ReadDir(s.storage.tempDir)))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		for _, q := range []string{
+			`select name from users order by nope`,
+			`select name from users order by orders.id`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+	})
+}
+
+func TestGroupBy(t *testing.T) {
+	prep := []string{
+		`create table emp(id int, dept string, salary int)`,
+		`insert into emp(id, dept, salary) VALUES (1, "eng", 100)`,
+		`insert into emp(id, dept, salary) VALUES (2, "eng", 200)`,
+		`insert into emp(id, dept, salary) VALUES (3, "ops", 50)`,
+		`insert into emp(id, dept, salary) VALUES (4, "ops", null)`,
+		`insert into emp(id, dept, salary) VALUES (5, "hr", null)`,
+	}
+
+	t.Run("aggregates without group by", func(t *testing.T) {
+		testSelect(t, prep, `select count(*), count(salary), sum(salary), min(salary), max(salary), avg(salary) from emp`, QueryResult{
+			[]FieldName{"count(*)", "count(salary)", "sum(salary)", "min(salary)", "max(salary)", "avg(salary)"},
+			[][]string{{"5", "3", "350", "50", "200", fmt.Sprint(350.0 / 3)}},
+		})
+	})
+
+	t.Run("group by", func(t *testing.T) {
+		testSelect(t, prep, `select dept, count(*), sum(salary), avg(salary) from emp group by dept`, QueryResult{
+			[]FieldName{"dept", "count(*)", "sum(salary)", "avg(salary)"},
+			[][]string{{"eng", "2", "300", "150"}, {"ops", "2", "50", "50"}, {"hr", "1", "<nil>", "<nil>"}},
+		})
+	})
+
+	t.Run("having", func(t *testing.T) {
+		testSelect(t, prep, `select dept from emp group by dept having count(*) > 1 and min(id) > 1`, QueryResult{
+			[]FieldName{"dept"},
+			[][]string{{"ops"}},
+		})
+	})
+
+	t.Run("empty table", func(t *testing.T) {
+		testSelect(t, []string{`create table empty(a int)`}, `select count(*), max(a) from empty`, QueryResult{
+			[]FieldName{"count(*)", "max(a)"},
+			[][]string{{"0", "<nil>"}},
+		})
+		testSelect(t, []string{`create table empty(a int)`}, `select a, count(*) from empty group by a`, QueryResult{
+			[]FieldName{"a", "count(*)"},
+			nil,
+		})
+	})
+
+	t.Run("order by aggregate", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		res, err := query(t, s, `select dept, sum(salary) from emp where id < 5 group by dept order by sum(salary) desc`)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"eng", "300"}, {"ops", "50"}}, res.Values)
+	})
+
+	t.Run("group by qualified column with join", func(t *testing.T) {
+		testSelect(t, append(prep,
+			`create table depts(name string, floor int)`,
+			`insert into depts(name, floor) VALUES ("eng", 1)`,
+			`insert into depts(name, floor) VALUES ("ops", 2)`,
+		), `select floor, count(emp.id) from emp join depts on dept = depts.name group by depts.floor`, QueryResult{
+			[]FieldName{"floor", "count(emp.id)"},
+			[][]string{{"1", "2"}, {"2", "2"}},
+		})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		for _, q := range []string{
+			`select id, count(*) from emp group by dept`,
+			`select * from emp group by dept`,
+			`select dept from emp where count(*) > 1 group by dept`,
+			`select dept from emp group by count(*)`,
+			`select sum(*) from emp`,
+			`select sum(id, salary) from emp`,
+			`select sum(max(id)) from emp`,
+			`select foo(id) from emp`,
+			`select sum(nope) from emp`,
+			`select dept from emp order by count(*)`,
+			`select sum(dept) from emp`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+	})
+}
+
+func TestLimit(t *testing.T) {
+	prep := []string{`create table nums(id int, label string)`}
+	for _, id := range []int{5, 3, 8, 1, 9, 2} {
+		prep = append(prep, fmt.Sprintf(`insert into nums(id, label) VALUES (%d, "%s")`, id, generateBigStr(3000)))
+	}
+
+	testCases := []struct {
+		desc     string
+		query    string
+		expected [][]string
+	}{
+		{"limit", `select id from nums limit 2`, [][]string{{"5"}, {"3"}}},
+		{"limit with offset", `select id from nums limit 2 offset 3`, [][]string{{"1"}, {"9"}}},
+		{"order by with limit", `select id from nums order by id desc limit 3`, [][]string{{"9"}, {"8"}, {"5"}}},
+		{"offset past the end", `select id from nums limit 5 offset 10`, nil},
+		{"zero limit", `select id from nums limit 0`, nil},
+		{"where with limit", `select id from nums where id > 4 limit 2 offset 1`, [][]string{{"8"}, {"9"}}},
+		{"aggregate with limit", `select count(*) from nums limit 1`, [][]string{{"6"}}},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := prepareDb(t, prep)
+			res, err := query(t, s, tC.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expected, res.Values)
+		})
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	prep := []string{
+		`create table a(id int, name string)`,
+		`create table b(num int, label string, flag boolean)`,
+		`insert into a(id, name) VALUES (1, "one")`,
+		`insert into a(id, name) VALUES (2, "two")`,
+		`insert into a(id, name) VALUES (2, "two")`,
+		`insert into a(id, name) VALUES (3, "three")`,
+		`insert into b(num, label, flag) VALUES (2, "two", true)`,
+		`insert into b(num, label, flag) VALUES (4, "four", false)`,
+	}
+
+	testCases := []struct {
+		desc     string
+		query    string
+		expected QueryResult
+	}{
+		{
+			"distinct",
+			`select distinct id, name from a`,
+			QueryResult{[]FieldName{"id", "name"}, [][]string{{"1", "one"}, {"2", "two"}, {"3", "three"}}},
+		},
+		{
+			"distinct keeps order",
+			`select distinct name from a order by id desc`,
+			QueryResult{[]FieldName{"name"}, [][]string{{"three"}, {"two"}, {"one"}}},
+		},
+		{
+			"distinct with limit",
+			`select distinct id from a limit 2`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"1"}, {"2"}}},
+		},
+		{
+			"union",
+			`select id, name from a union select num, label from b`,
+			QueryResult{[]FieldName{"id", "name"}, [][]string{{"1", "one"}, {"2", "two"}, {"3", "three"}, {"4", "four"}}},
+		},
+		{
+			"union all",
+			`select id from a union all select num from b`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"1"}, {"2"}, {"2"}, {"3"}, {"2"}, {"4"}}},
+		},
+		{
+			"intersect",
+			`select id, name from a intersect select num, label from b`,
+			QueryResult{[]FieldName{"id", "name"}, [][]string{{"2", "two"}}},
+		},
+		{
+			"except",
+			`select id from a except select num from b`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"1"}, {"3"}}},
+		},
+		{
+			"chained with order by and limit",
+			`select id from a except select num from b union select num from b order by id desc limit 3`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"4"}, {"3"}, {"2"}}},
+		},
+		{
+			"null is compatible with any type",
+			`select id, null from a where id = 1 union select num, label from b where num = 4`,
+			QueryResult{[]FieldName{"id", "null"}, [][]string{{"1", "<nil>"}, {"4", "four"}}},
+		},
+		{
+			"aggregates",
+			`select count(*) from a union all select count(*) from b`,
+			QueryResult{[]FieldName{"count(*)"}, [][]string{{"4"}, {"2"}}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s := prepareDb(t, prep)
+			res, err := query(t, s, tC.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expected, res)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		for _, q := range []string{
+			`select id from a union select num, label from b`,
+			`select id from a union select label from b`,
+			`select name from a except select flag from b`,
+			`select id from a union select num from b order by num`,
+			`select id from a union select nope from b`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+	})
+}
+
+func TestArithmetic(t *testing.T) {
+	prep := []string{
+		`create table items(id int, price int, qty int, name string)`,
+		`insert into items(id, price, qty, name) VALUES (1, 10, 3, "pen")`,
+		`insert into items(id, price, qty, name) VALUES (2, 25, -2 + 4, "cup")`,
+		`insert into items(id, price, qty, name) VALUES (-3, 7, 0, "box")`,
+	}
+
+	testCases := []struct {
+		desc     string
+		query    string
+		expected QueryResult
+	}{
+		{
+			"expressions in select list",
+			`select name, price * qty, -price, (price + 1) / 2 from items`,
+			QueryResult{
+				[]FieldName{"name", "price * qty", "-price", "(price + 1) / 2"},
+				[][]string{{"pen", "30", "-10", "5"}, {"cup", "50", "-25", "13"}, {"box", "0", "-7", "4"}},
+			},
+		},
+		{
+			"int and float promotion",
+			`select price / 4, price / 4.0, price % 4 from items where id = 2`,
+			QueryResult{
+				[]FieldName{"price / 4", "price / 4.0", "price % 4"},
+				[][]string{{"6", "6.25", "1"}},
+			},
+		},
+		{
+			"expressions in where",
+			`select id from items where price * qty > 20 and not id = 2`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"1"}}},
+		},
+		{
+			"negative literals and comparison with float",
+			`select id from items where id < -1 or price > 24.5`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"2"}, {"-3"}}},
+		},
+		{
+			"aggregate of expression",
+			`select sum(price * qty), avg(price) * 3, sum(price * 0.5) from items`,
+			QueryResult{
+				[]FieldName{"sum(price * qty)", "avg(price) * 3", "sum(price * 0.5)"},
+				[][]string{{"80", "42", "21"}},
+			},
+		},
+		{
+			"grouped expression",
+			`select qty % 2, count(*) from items group by qty % 2`,
+			QueryResult{[]FieldName{"qty % 2", "count(*)"}, [][]string{{"1", "1"}, {"0", "2"}}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			testSelect(t, prep, tC.query, tC.expected)
+		})
+	}
+
+	t.Run("update with expression", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertUpdated(t, s, `update items set price = price * 2 + 1 where qty > 0`, 2)
+
+		res, err := query(t, s, `select id, price from items`)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"1", "21"}, {"2", "51"}, {"-3", "7"}}, res.Values)
+	})
+
+	t.Run("errors instead of panics", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		for _, q := range []string{
+			`select price / qty from items`,
+			`select id from items where price % qty = 0`,
+			`select price * 1000000000 from items`,
+			`select name + 1 from items`,
+			`select 9223372036854775808 from items`,
+			`select -name from items`,
+			`update items set price = price / 0`,
+			`delete from items where 1 / (qty - 3) = 0`,
+			`insert into items(id, price, qty, name) VALUES (4, 1 / 0, 1, "x")`,
+			`insert into items(id, price, qty, name) VALUES (4, price, 1, "x")`,
+			`insert into items(id, price, qty, name) VALUES (4, 1.5 * 2, 1, "x")`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+
+		res, err := query(t, s, `select id, price from items`)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"1", "10"}, {"2", "25"}, {"-3", "7"}}, res.Values, "failed statements should not change data")
+	})
+}
+
+func TestFloatColumns(t *testing.T) {
+	prep := []string{
+		`create table measurements(id int, value float)`,
+		`insert into measurements(id, value) VALUES (1, 1.5)`,
+		`insert into measurements(id, value) VALUES (2, -2.25)`,
+		`insert into measurements(id, value) VALUES (3, 4)`,
+		`insert into measurements(id, value) VALUES (4, null)`,
+		`insert into measurements(id, value) VALUES (5, 1 / 4.0)`,
+	}
+
+	testCases := []struct {
+		desc     string
+		query    string
+		expected QueryResult
+	}{
+		{
+			"select",
+			`select id, value from measurements`,
+			QueryResult{[]FieldName{"id", "value"}, [][]string{{"1", "1.5"}, {"2", "-2.25"}, {"3", "4"}, {"4", "<nil>"}, {"5", "0.25"}}},
+		},
+		{
+			"aggregates",
+			`select sum(value), min(value), max(value), count(value) from measurements`,
+			QueryResult{[]FieldName{"sum(value)", "min(value)", "max(value)", "count(value)"}, [][]string{{"3.5", "-2.25", "4", "4"}}},
+		},
+		{
+			"arithmetic",
+			`select value * 2 from measurements where id = 1`,
+			QueryResult{[]FieldName{"value * 2"}, [][]string{{"3"}}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			testSelect(t, prep, tC.query, tC.expected)
+		})
+	}
+
+	t.Run("compare with int and float", func(t *testing.T) {
+		withoutNulls := slices.DeleteFunc(slices.Clone(prep), func(q string) bool { return strings.Contains(q, "null") })
+		testSelect(t, withoutNulls, `select id from measurements where value > 1 and value < 4.5 and value != 1.5`, QueryResult{
+			[]FieldName{"id"},
+			[][]string{{"3"}},
+		})
+	})
+
+	t.Run("order by", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		res, err := query(t, s, `select id from measurements order by value desc`)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"4"}, {"3"}, {"1"}, {"5"}, {"2"}}, res.Values)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertUpdated(t, s, `update measurements set value = value * 2 where id < 3`, 2)
+		assertUpdated(t, s, `update measurements set value = 7 where id = 4`, 1)
+
+		res, err := query(t, s, `select id, value from measurements`)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"1", "3"}, {"2", "-4.5"}, {"3", "4"}, {"4", "7"}, {"5", "0.25"}}, res.Values)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		for _, q := range []string{
+			`insert into measurements(id, value) VALUES (6, "abc")`,
+			`insert into measurements(id, value) VALUES (6, true)`,
+			`insert into measurements(id, value) VALUES (1.5, 1)`,
+			`update measurements set value = "abc"`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+	})
+
+	t.Run("dump and load", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		recovered, err := NewDatabaseFromBytes(bytes.NewReader(s.Serialize()))
+		assert.NoError(t, err)
+
+		res, err := query(t, recovered, `select id, value from measurements`)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"1", "1.5"}, {"2", "-2.25"}, {"3", "4"}, {"4", "<nil>"}, {"5", "0.25"}}, res.Values)
+	})
+}
+
+func TestBigIntBlobAndDateColumns(t *testing.T) {
+	prep := []string{
+		`create table events(id bigint, payload blob, day date, at timestamp)`,
+		`insert into events(id, payload, day, at) VALUES (5000000000, x'cafe', date '2024-01-31', timestamp '2024-01-31 10:00:00')`,
+		`insert into events(id, payload, day, at) VALUES (2, x'00FF', "2023-12-24", "2023-12-24 18:30:00.25")`,
+		`insert into events(id, payload, day, at) VALUES (-7, x'', date '2024-02-29', timestamp '2024-02-29')`,
+	}
+	withNulls := append(slices.Clone(prep), `insert into events(id, payload, day, at) VALUES (3, null, null, null)`)
+
+	testCases := []struct {
+		desc     string
+		query    string
+		expected QueryResult
+	}{
+		{
+			"select",
+			`select id, payload, day, at from events`,
+			QueryResult{[]FieldName{"id", "payload", "day", "at"}, [][]string{
+				{"5000000000", "x'cafe'", "2024-01-31", "2024-01-31 10:00:00"},
+				{"2", "x'00ff'", "2023-12-24", "2023-12-24 18:30:00.25"},
+				{"-7", "x''", "2024-02-29", "2024-02-29 00:00:00"},
+			}},
+		},
+		{
+			"bigint arithmetic",
+			`select id * 2, id + 2147483647 from events where id = 2`,
+			QueryResult{[]FieldName{"id * 2", "id + 2147483647"}, [][]string{{"4", "2147483649"}}},
+		},
+		{
+			"bigint literals",
+			`select id from events where id > 3000000000 or id < -2147483648 + 2147483645`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"5000000000"}, {"-7"}}},
+		},
+		{
+			"compare blobs",
+			`select id from events where payload = x'CAFE' or payload < x'01'`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"5000000000"}, {"2"}, {"-7"}}},
+		},
+		{
+			"compare dates",
+			`select id from events where day >= date '2024-01-01' and day != "2024-02-29"`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"5000000000"}}},
+		},
+		{
+			"compare timestamps with dates",
+			`select id from events where at > date '2024-01-31' and at < timestamp '2024-02-01T00:00:00Z'`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"5000000000"}}},
+		},
+		{
+			"aggregates",
+			`select sum(id), min(day), max(at), max(payload) from events`,
+			QueryResult{[]FieldName{"sum(id)", "min(day)", "max(at)", "max(payload)"}, [][]string{
+				{"4999999995", "2023-12-24", "2024-02-29 00:00:00", "x'cafe'"},
+			}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			testSelect(t, prep, tC.query, tC.expected)
+		})
+	}
+
+	t.Run("order by", func(t *testing.T) {
+		s := prepareDb(t, withNulls)
+		for q, expected := range map[string][][]string{
+			`select id from events order by day`:                 {{"2"}, {"5000000000"}, {"-7"}, {"3"}},
+			`select id from events order by id desc`:             {{"5000000000"}, {"3"}, {"2"}, {"-7"}},
+			`select id from events order by payload nulls first`: {{"3"}, {"-7"}, {"2"}, {"5000000000"}},
+		} {
+			res, err := query(t, s, q)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, res.Values, q)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertUpdated(t, s, `update events set id = id * 1000000, at = day where id = 2`, 1)
+
+		res, err := query(t, s, `select id, at from events where id > 1000000`)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"5000000000", "2024-01-31 10:00:00"}, {"2000000", "2023-12-24 00:00:00"}}, res.Values)
+	})
+
+	t.Run("big blobs use overflow pages", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		big := strings.Repeat("0123456789abcdef", 300)
+		execute(t, s, fmt.Sprintf(`insert into events(id, payload, day, at) VALUES (10, x'%s', null, null)`, big))
+
+		res, err := query(t, s, `select payload from events where id = 10`)
+		assert.NoError(t, err)
+		assert.True(t, len(res.Values) == 1 && res.Values[0][0] == "x'"+big+"'", "blob should be read back from overflow pages")
+
+		recovered, err := NewDatabaseFromBytes(bytes.NewReader(s.Serialize()))
+		assert.NoError(t, err)
+		res, err = query(t, recovered, `select id from events where payload = x'`+big+`'`)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"10"}}, res.Values)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		for _, q := range []string{
+			`insert into events(id, payload, day, at) VALUES (9223372036854775808, null, null, null)`,
+			`insert into events(id, payload, day, at) VALUES (1, "cafe", null, null)`,
+			`insert into events(id, payload, day, at) VALUES (1, x'abc', null, null)`,
+			`insert into events(id, payload, day, at) VALUES (1, null, "2024-02-30", null)`,
+			`insert into events(id, payload, day, at) VALUES (1, null, null, date '31.01.2024')`,
+			`select id from events where day > 5`,
+			`select id * 9223372036854775807 from events`,
+			`update events set day = at`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+	})
+
+	t.Run("dump and load", func(t *testing.T) {
+		s := prepareDb(t, withNulls)
+		recovered, err := NewDatabaseFromBytes(bytes.NewReader(s.Serialize()))
+		assert.NoError(t, err)
+
+		res, err := query(t, recovered, `select id, payload, day, at from events where id < 5`)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"2", "x'00ff'", "2023-12-24", "2023-12-24 18:30:00.25"},
+			{"-7", "x''", "2024-02-29", "2024-02-29 00:00:00"},
+			{"3", "<nil>", "<nil>", "<nil>"},
+		}, res.Values)
+	})
+}
+
+func TestNulls(t *testing.T) {
+	prep := []string{
+		`create table items(id int, price int, name string)`,
+		`insert into items(id, price, name) VALUES (1, 10, "apple")`,
+		`insert into items(id, price, name) VALUES (2, null, "pear")`,
+		`insert into items(id, price, name) VALUES (3, 30, null)`,
+		`insert into items(id, price, name) VALUES (4, null, null)`,
+		`create table labels(price int, label string)`,
+		`insert into labels(price, label) VALUES (10, "cheap")`,
+		`insert into labels(price, label) VALUES (null, "unknown")`,
+	}
+
+	testCases := []struct {
+		desc     string
+		query    string
+		expected QueryResult
+	}{
+		{
+			"comparison with null is unknown",
+			`select id from items where price = null or price != 10`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"3"}}},
+		},
+		{
+			"not of unknown is unknown",
+			`select id from items where not price > 20`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"1"}}},
+		},
+		{
+			"or with true is true",
+			`select id from items where price > 20 or name = "pear"`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"2"}, {"3"}}},
+		},
+		{
+			"and with false is false",
+			`select id from items where not (price > 20 and name = "apple")`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"1"}, {"2"}}},
+		},
+		{
+			"is null",
+			`select id from items where price is null`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"2"}, {"4"}}},
+		},
+		{
+			"is not null",
+			`select id from items where price is not null and name is not null`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"1"}}},
+		},
+		{
+			"unknown in select list",
+			`select id, price > 15, name is null from items`,
+			QueryResult{[]FieldName{"id", "price > 15", "name is null"}, [][]string{
+				{"1", "false", "false"}, {"2", "<nil>", "false"}, {"3", "true", "true"}, {"4", "<nil>", "true"},
+			}},
+		},
+		{
+			"coalesce and ifnull",
+			`select coalesce(name, price * 2, "none"), ifnull(price, -1) from items`,
+			QueryResult{[]FieldName{"coalesce(name, price * 2, \"none\")", "ifnull(price, -1)"}, [][]string{
+				{"apple", "10"}, {"pear", "-1"}, {"60", "30"}, {"none", "-1"},
+			}},
+		},
+		{
+			"coalesce skips remaining arguments",
+			`select id from items where coalesce(id, 1 / 0) > 2`,
+			QueryResult{[]FieldName{"id"}, [][]string{{"3"}, {"4"}}},
+		},
+		{
+			"coalesce with aggregates",
+			`select name is null, coalesce(sum(price), 0) from items group by name is null`,
+			QueryResult{[]FieldName{"name is null", "coalesce(sum(price), 0)"}, [][]string{{"false", "10"}, {"true", "30"}}},
+		},
+		{
+			"join on null never matches",
+			`select id, label from items join labels on items.price = labels.price`,
+			QueryResult{[]FieldName{"id", "label"}, [][]string{{"1", "cheap"}}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			testSelect(t, prep, tC.query, tC.expected)
+		})
+	}
+
+	t.Run("update and delete", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertUpdated(t, s, `update items set price = coalesce(price, 0) + 1 where price < 20 or price is null`, 3)
+
+		deleted, err := s.Execute(`delete from items where name != "apple"`)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+
+		res, err := query(t, s, `select id, price from items`)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"1", "11"}, {"3", "30"}, {"4", "1"}}, res.Values)
+	})
+
+	t.Run("insert", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		execute(t, s, `insert into items(id, price, name) VALUES (5, ifnull(null, 7), coalesce(null, null))`)
+
+		res, err := query(t, s, `select price, name from items where id = 5`)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"7", "<nil>"}}, res.Values)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		for _, q := range []string{
+			`select coalesce() from items`,
+			`select ifnull(price) from items`,
+			`select coalesce(*) from items`,
+			`select id from items where price`,
+			`select id from items where name = "pear" and price`,
+			`select foo(price) from items`,
+			`update items set price = sum(price)`,
+			`delete from items where foo(price) = 1`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+	})
+}
+
+func TestConstraints(t *testing.T) {
+	prep := []string{
+		`create table users(id int primary key, email string unique default null, name string not null default "anon", age int default null check (age >= 0 and age < 200))`,
+		`insert into users(id, email, name, age) VALUES (1, "a@x.com", "alice", 30)`,
+		`insert into users(id, email, age) VALUES (2, null, null)`,
+	}
+	assertViolation := func(t *testing.T, err error, kind ConstraintKind, column string) {
+		t.Helper()
+		var cErr *ConstraintError
+		if assert.ErrorAs(t, err, &cErr) {
+			assert.Equal(t, kind, cErr.Kind)
+			assert.Equal(t, "users", cErr.Table)
+			assert.Equal(t, column, cErr.Column)
+		}
+	}
+
+	t.Run("default and null check", func(t *testing.T) {
+		testSelect(t, prep, `select id, email, name, age from users`, QueryResult{
+			[]FieldName{"id", "email", "name", "age"},
+			[][]string{{"1", "a@x.com", "alice", "30"}, {"2", "<nil>", "anon", "<nil>"}},
+		})
+	})
+
+	t.Run("insert violations", func(t *testing.T) {
+		testCases := []struct {
+			desc   string
+			query  string
+			kind   ConstraintKind
+			column string
+		}{
+			{"not null", `insert into users(id, name) VALUES (3, null)`, NotNullConstraint, "name"},
+			{"null primary key", `insert into users(id) VALUES (null)`, NotNullConstraint, "id"},
+			{"check", `insert into users(id, age) VALUES (3, -1)`, CheckConstraint, "age"},
+			{"unique", `insert into users(id, email) VALUES (3, "a@x.com")`, UniqueConstraint, "email"},
+			{"primary key", `insert into users(id) VALUES (1)`, PrimaryKeyConstraint, "id"},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				s := prepareDb(t, prep)
+				_, err := s.Execute(tC.query)
+				assertViolation(t, err, tC.kind, tC.column)
+
+				res, err := query(t, s, `select id from users`)
+				assert.NoError(t, err)
+				assert.Len(t, res.Values, 2)
+			})
+		}
+	})
+
+	t.Run("nulls are unique", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assert.NoError(t, execute(t, s, `insert into users(id, email) VALUES (3, null)`))
+	})
+
+	t.Run("column without default is required", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		_, err := s.Execute(`insert into users(email) VALUES ("b@x.com")`)
+		assert.ErrorContains(t, err, `column "id" not provided`)
+	})
+
+	t.Run("update violations leave data unchanged", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		_, err := s.Execute(`update users set age = age * 10`)
+		assertViolation(t, err, CheckConstraint, "age")
+		_, err = s.Execute(`update users set name = null where id = 2`)
+		assertViolation(t, err, NotNullConstraint, "name")
+		_, err = s.Execute(`update users set id = 5`)
+		assertViolation(t, err, PrimaryKeyConstraint, "id")
+
+		res, err := query(t, s, `select id, name, age from users`)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"1", "alice", "30"}, {"2", "anon", "<nil>"}}, res.Values)
+	})
+
+	t.Run("update checks uniqueness after all changes", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertUpdated(t, s, `update users set id = 3 - id`, 2)
+
+		res, err := query(t, s, `select id, name from users`)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"2", "alice"}, {"1", "anon"}}, res.Values)
+	})
+
+	t.Run("changed rows are unique among each other and stored rows", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		_, err := s.Execute(`update users set id = 5`)
+		assertViolation(t, err, PrimaryKeyConstraint, "id")
+		_, err = s.Execute(`update users set email = "a@x.com" where id = 2`)
+		assertViolation(t, err, UniqueConstraint, "email")
+
+		// key of the row itself doesn't count
+		assertUpdated(t, s, `update users set email = "a@x.com", age = 31 where id = 1`, 1)
+		assertUpdated(t, s, `delete from users where id = 1`, 1)
+		assert.NoError(t, execute(t, s, `insert into users(id, email) VALUES (1, "a@x.com")`))
+	})
+
+	t.Run("constraints survive dump and load", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		recovered, err := NewDatabaseFromBytes(bytes.NewReader(s.Serialize()))
+		assert.NoError(t, err)
+
+		assert.True(t, recovered.Schema()["users"].Constraints["email"].Unique)
+		_, err = recovered.Execute(`insert into users(id, age) VALUES (3, 500)`)
+		assertViolation(t, err, CheckConstraint, "age")
+	})
+
+	t.Run("invalid definitions", func(t *testing.T) {
+		s := NewDatabase()
+		for _, q := range []string{
+			`create table foo(a int primary key, b int primary key)`,
+			`create table foo(a int default "x")`,
+			`create table foo(a int, b int default a)`,
+			`create table foo(a int check (c > 0))`,
+			`create table foo(a int check (count(a) > 0))`,
+			`create table foo(a int check (a + 1))`,
+			`create table foo(a integer)`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+		assert.NotContains(t, s.Schema(), TableName("foo"))
+	})
+
+	t.Run("alter table", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assert.NoError(t, execute(t, s, `alter table users add column score int not null default 5 check (score > 0 and score < age)`))
+		res, err := query(t, s, `select id, score from users`)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"1", "5"}, {"2", "5"}}, res.Values)
+
+		for _, q := range []string{
+			`alter table users add column level int not null`,
+			`alter table users add column level int default 0 check (level > 0)`,
+			`alter table users add column code int unique`,
+			`alter table users rename column age to years`,
+			`alter table users drop column age`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+		assert.Equal(t, []FieldName{"id", "email", "name", "age", "score"}, s.Schema()["users"].FieldNames)
+		res, err = query(t, s, `select age from users`)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, [][]string{{"30"}, {"<nil>"}}, res.Values, "failed drop should keep the data")
+
+		assert.NoError(t, execute(t, s, `alter table users drop column email`))
+		assert.Equal(t, []FieldName{"id", "name", "age", "score"}, s.Schema()["users"].FieldNames)
+	})
+}
+
+func TestForeignKeys(t *testing.T) {
+	prep := []string{
+		`create table users(id int primary key, name string)`,
+		`create table posts(id int primary key, user_id int references users(id) on delete cascade on update cascade, title string)`,
+		`create table comments(id int primary key, post_id int references posts(id) on delete cascade, editor_id int, foreign key (editor_id) references users(id) on delete set null on update set null)`,
+		`create table likes(user_id int references users(id), post_id int default null)`,
+		`insert into users(id, name) VALUES (1, "alice")`,
+		`insert into users(id, name) VALUES (2, "bob")`,
+		`insert into users(id, name) VALUES (3, "carol")`,
+		`insert into posts(id, user_id, title) VALUES (10, 1, "first")`,
+		`insert into posts(id, user_id, title) VALUES (11, 2, "second")`,
+		`insert into comments(id, post_id, editor_id) VALUES (100, 10, 2)`,
+		`insert into comments(id, post_id, editor_id) VALUES (101, 11, 1)`,
+		`insert into likes(user_id) VALUES (2)`,
+	}
+	assertViolation := func(t *testing.T, err error, table, column string) {
+		t.Helper()
+		var cErr *ConstraintError
+		if assert.ErrorAs(t, err, &cErr) {
+			assert.Equal(t, ForeignKeyConstraint, cErr.Kind)
+			assert.Equal(t, table, cErr.Table)
+			assert.Equal(t, column, cErr.Column)
+		}
+	}
+	assertRows := func(t *testing.T, s *Database, q string, expected [][]string) {
+		t.Helper()
+		res, err := query(t, s, q)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, expected, res.Values, q)
+	}
+
+	t.Run("insert and update of child", func(t *testing.T) {
+		testCases := []struct {
+			desc   string
+			query  string
+			table  string
+			column string
+		}{
+			{"insert missing parent", `insert into posts(id, user_id, title) VALUES (12, 4, "x")`, "posts", "user_id"},
+			{"insert missing table level parent", `insert into comments(id, post_id, editor_id) VALUES (102, 10, 4)`, "comments", "editor_id"},
+			{"update to missing parent", `update posts set user_id = 5 where id = 10`, "posts", "user_id"},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				s := prepareDb(t, prep)
+				_, err := s.Execute(tC.query)
+				assertViolation(t, err, tC.table, tC.column)
+				assertRows(t, s, `select id, user_id from posts`, [][]string{{"10", "1"}, {"11", "2"}})
+			})
+		}
+
+		s := prepareDb(t, prep)
+		assert.NoError(t, execute(t, s, `insert into posts(id, user_id, title) VALUES (12, null, "orphan")`))
+		assertUpdated(t, s, `update posts set user_id = 3 where id = 12`, 1)
+	})
+
+	t.Run("delete restrict", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		_, err := s.Execute(`delete from users where id = 2`)
+		assertViolation(t, err, "likes", "user_id")
+		assertRows(t, s, `select id from users`, [][]string{{"1"}, {"2"}, {"3"}})
+		assertRows(t, s, `select id from posts`, [][]string{{"10"}, {"11"}})
+
+		assertUpdated(t, s, `delete from likes`, 1)
+		assertUpdated(t, s, `delete from users where id = 2`, 1)
+	})
+
+	t.Run("delete cascade and set null", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertUpdated(t, s, `delete from users where id = 1`, 1)
+		assertRows(t, s, `select id, user_id from posts`, [][]string{{"11", "2"}})
+		assertRows(t, s, `select id, post_id, editor_id from comments`, [][]string{{"101", "11", "<nil>"}})
+	})
+
+	t.Run("update parent key", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertUpdated(t, s, `update users set id = id + 10 where id = 1`, 1)
+		assertRows(t, s, `select id, user_id from posts`, [][]string{{"10", "11"}, {"11", "2"}})
+		assertRows(t, s, `select id, editor_id from comments`, [][]string{{"100", "2"}, {"101", "<nil>"}})
+
+		_, err := s.Execute(`update users set id = 20 where id = 2`)
+		assertViolation(t, err, "likes", "user_id")
+		_, err = s.Execute(`update posts set id = 12 where id = 10`)
+		assertViolation(t, err, "comments", "post_id")
+		assertRows(t, s, `select id from users`, [][]string{{"11"}, {"2"}, {"3"}})
+
+		s = prepareDb(t, prep)
+		assertUpdated(t, s, `update users set id = 3 - id where id < 3`, 2)
+		assertRows(t, s, `select id, user_id from posts`, [][]string{{"10", "2"}, {"11", "1"}})
+	})
+
+	t.Run("self reference", func(t *testing.T) {
+		s := prepareDb(t, []string{
+			`create table nodes(id int primary key, parent int references nodes(id) on update cascade)`,
+			`insert into nodes(id, parent) VALUES (1, null)`,
+			`insert into nodes(id, parent) VALUES (2, 1)`,
+			`insert into nodes(id, parent) VALUES (3, 2)`,
+		})
+		_, err := s.Execute(`insert into nodes(id, parent) VALUES (4, 5)`)
+		assertViolation(t, err, "nodes", "parent")
+		assert.NoError(t, execute(t, s, `insert into nodes(id, parent) VALUES (4, 4)`))
+
+		assertUpdated(t, s, `update nodes set id = id * 10`, 4)
+		assertRows(t, s, `select id, parent from nodes`, [][]string{{"10", "<nil>"}, {"20", "10"}, {"30", "20"}, {"40", "40"}})
+
+		_, err = s.Execute(`delete from nodes where id = 10`)
+		assertViolation(t, err, "nodes", "parent")
+		assertUpdated(t, s, `delete from nodes where id < 40`, 3)
+
+		assert.NoError(t, execute(t, s, `alter table nodes rename column id to node_id`))
+		assert.NoError(t, execute(t, s, `alter table nodes rename to tree`))
+		assert.Equal(t, []sql.ForeignKey{{Column: "parent", RefTable: "tree", RefColumn: "node_id", OnUpdate: sql.ReferenceCascade}},
+			s.Schema()["tree"].ForeignKeys)
+	})
+
+	t.Run("schema changes", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		for _, q := range []string{
+			`drop table users`,
+			`alter table users rename to people`,
+			`alter table users rename column id to user_id`,
+			`alter table posts drop column id`,
+			`alter table comments drop column editor_id`,
+			`alter table likes add column post_ref int default 99 references posts(id)`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+
+		assert.NoError(t, execute(t, s, `alter table likes add column post_ref int default 10 references posts(id)`))
+		assertRows(t, s, `select user_id, post_ref from likes`, [][]string{{"2", "10"}})
+		assert.NoError(t, execute(t, s, `drop table likes`))
+		assert.NoError(t, execute(t, s, `alter table users rename column name to login`))
+	})
+
+	t.Run("invalid definitions", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		for _, q := range []string{
+			`create table foo(a int references missing(id))`,
+			`create table foo(a int references users(name))`,
+			`create table foo(a int references users(missing))`,
+			`create table foo(a string references users(id))`,
+			`create table foo(a int not null references users(id) on delete set null)`,
+			`create table foo(a int, foreign key (b) references users(id))`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+		assert.NotContains(t, s.Schema(), TableName("foo"))
+	})
+
+	t.Run("only changed rows are checked", func(t *testing.T) {
+		s := prepareDb(t, []string{
+			`create table users(id int primary key, bio string)`,
+			`create table posts(id int primary key, user_id int references users(id) on delete cascade, body string)`,
+			`create index posts_user on posts(user_id)`,
+			`create table drafts(id int primary key, bio string)`,
+		})
+		for i := range 600 {
+			for _, table := range []string{"users", "drafts"} {
+				assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into %s(id, bio) VALUES (%d, "%s")`, table, i, generateBigStr(500))))
+			}
+			assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into posts(id, user_id, body) VALUES (%d, %d, "%s")`, i, i, generateBigStr(500))))
+		}
+		tablePages := len(s.storage.tableTree(s.Schema()["users"].StartPage).pages())
+
+		pages := s.storage.pagesRead
+		assert.NoError(t, execute(t, s, `insert into posts(id, user_id, body) VALUES (600, 150, "x")`))
+		assert.Less(t, s.storage.pagesRead-pages, tablePages/2, "tables are not scanned on insert")
+
+		// delete itself scans the table, a table without references is the baseline
+		pages = s.storage.pagesRead
+		assertUpdated(t, s, `delete from drafts where id = 150`, 1)
+		baseline := s.storage.pagesRead - pages
+		pages = s.storage.pagesRead
+		assertUpdated(t, s, `delete from users where id = 150`, 1)
+		assert.Less(t, s.storage.pagesRead-pages-baseline, tablePages/2, "tables are not scanned on delete")
+		assertRows(t, s, `select count(*) from posts where user_id = 150`, [][]string{{"0"}})
+	})
+
+	t.Run("relationships survive dump and load", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		recovered, err := NewDatabaseFromBytes(bytes.NewReader(s.Serialize()))
+		assert.NoError(t, err)
+
+		assert.Equal(t, []sql.ForeignKey{
+			{Column: "post_id", RefTable: "posts", RefColumn: "id", OnDelete: sql.ReferenceCascade},
+			{Column: "editor_id", RefTable: "users", RefColumn: "id", OnDelete: sql.ReferenceSetNull, OnUpdate: sql.ReferenceSetNull},
+		}, recovered.Schema()["comments"].ForeignKeys)
+		_, err = recovered.Execute(`insert into likes(user_id) VALUES (7)`)
+		assertViolation(t, err, "likes", "user_id")
+	})
+}
+
+func TestIndexes(t *testing.T) {
+	prep := []string{
+		`create table users(id int, name string, age int, score float)`,
+		`insert into users(id, name, age, score) VALUES (1, "carol", 30, 1.5)`,
+		`insert into users(id, name, age, score) VALUES (2, "alice", 20, -2.5)`,
+		`insert into users(id, name, age, score) VALUES (3, "bob", null, 0.0)`,
+		`insert into users(id, name, age, score) VALUES (4, "dave", 25, 10.0)`,
+		`insert into users(id, name, age, score) VALUES (5, "alice", 40, -0.5)`,
+	}
+	indexKeys := func(t *testing.T, s *Database, table, index string) int {
+		t.Helper()
+		for _, idx := range s.Schema()[TableName(table)].Indexes {
+			if idx.Name == index {
+				n := 0
+				for range s.storage.indexTree(idx.StartPage).ascend(nil) {
+					n++
+				}
+				return n
+			}
+		}
+		assert.Fail(t, "index not found", index)
+		return 0
+	}
+	assertRows := func(t *testing.T, s *Database, q string, expected [][]string) {
+		t.Helper()
+		res, err := query(t, s, q)
+		assert.NoError(t, err, q)
+		assert.Equal(t, expected, res.Values, q)
+	}
+
+	t.Run("create and drop", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assert.NoError(t, execute(t, s, `create index users_age on users(age)`))
+		assert.NoError(t, execute(t, s, `create unique index users_name_age on users(name, age)`))
+
+		indexes := s.Schema()["users"].Indexes
+		if assert.Len(t, indexes, 2) {
+			assert.Equal(t, IndexSchema{Name: "users_age", Columns: []FieldName{"age"}, StartPage: indexes[0].StartPage}, indexes[0])
+			assert.Equal(t, IndexSchema{Name: "users_name_age", Columns: []FieldName{"name", "age"}, Unique: true, StartPage: indexes[1].StartPage}, indexes[1])
+		}
+		_, sch, ok := s.storage.findSchemaTuple("users_age")
+		assert.True(t, ok)
+		assert.Equal(t, IndexLeafPageType, sch.PageTyp)
+		assert.Equal(t, "create index users_age on users(age)", sch.SqlStatement)
+		assert.Equal(t, 5, indexKeys(t, s, "users", "users_age"))
+
+		for _, q := range []string{
+			`create index users_age on users(name)`,
+			`create index users on users(name)`,
+			`create table users_age(a int)`,
+			`create index foo on missing(name)`,
+			`create index foo on users(missing)`,
+			`create index foo on users(name, name)`,
+			`drop index missing`,
+			`drop index users`,
+			`drop table users_age`,
+			`alter table users_age add column a int`,
+			`alter table users rename to users_age`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+
+		assert.NoError(t, execute(t, s, `drop index users_age`))
+		assert.NoError(t, execute(t, s, `drop index if exists users_age`))
+		assert.Len(t, s.Schema()["users"].Indexes, 1)
+
+		pages := s.storage.root.NumberOfPages
+		assert.NoError(t, execute(t, s, `drop table users`))
+		_, _, ok = s.storage.findSchemaTuple("users_name_age")
+		assert.False(t, ok)
+		assert.NoError(t, execute(t, s, `create table users(id int)`))
+		assert.NoError(t, execute(t, s, `create index users_id on users(id)`))
+		assert.Equal(t, pages, s.storage.root.NumberOfPages, "pages of dropped table and indexes are reused")
+	})
+
+	t.Run("select uses index", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assert.NoError(t, execute(t, s, `create index users_age on users(age)`))
+		assert.NoError(t, execute(t, s, `create index users_name_age on users(name, age)`))
+		assert.NoError(t, execute(t, s, `create index users_score on users(score)`))
+
+		// rows found by an index come in its order
+		testCases := []struct {
+			query    string
+			expected [][]string
+		}{
+			{`select id from users where age = 25`, [][]string{{"4"}}},
+			{`select id from users where age > 20`, [][]string{{"4"}, {"1"}, {"5"}}},
+			{`select id from users where age >= 20 and age < 40`, [][]string{{"2"}, {"4"}, {"1"}}},
+			{`select id from users where age <= 30`, [][]string{{"2"}, {"4"}, {"1"}}},
+			{`select id from users where 30 > users.age`, [][]string{{"2"}, {"4"}}},
+			{`select id from users where age > 20 and id != 4`, [][]string{{"1"}, {"5"}}},
+			{`select id from users where name = "alice"`, [][]string{{"2"}, {"5"}}},
+			{`select id from users where name = "alice" and age > 30`, [][]string{{"5"}}},
+			{`select id from users where name >= "b" and name < "d"`, [][]string{{"3"}, {"1"}}},
+			{`select id from users where score < 0`, [][]string{{"2"}, {"5"}}},
+			{`select id from users where score >= -0.5`, [][]string{{"5"}, {"3"}, {"1"}, {"4"}}},
+			{`select id from users where age > 2147483648`, nil},
+			{`select id from users where age < 25.5`, [][]string{{"2"}, {"4"}}},
+			{`select id from users where age = null`, nil},
+			{`select id from users where age > 20 or id = 2`, [][]string{{"1"}, {"2"}, {"4"}, {"5"}}},
+		}
+		for _, tC := range testCases {
+			assertRows(t, s, tC.query, tC.expected)
+		}
+	})
+
+	t.Run("kept up to date", func(t *testing.T) {
+		s := prepareDb(t, []string{`create table nums(id int, v int, label string)`})
+		assert.NoError(t, execute(t, s, `create index nums_v on nums(v)`))
+		assert.NoError(t, execute(t, s, `create index nums_label on nums(label)`))
+		label := strings.Repeat("x", 100)
+		for i := range 300 {
+			assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into nums(id, v, label) VALUES (%d, %d, "%s%d")`, i, (i*7)%300, label, i)))
+		}
+		assert.Equal(t, 300, indexKeys(t, s, "nums", "nums_label"))
+
+		assertUpdated(t, s, `update nums set v = v + 1000 where id < 100`, 100)
+		assertUpdated(t, s, `delete from nums where id >= 250`, 50)
+		assertUpdated(t, s, `update nums set label = "short" where id = 10`, 1)
+		assert.Equal(t, 250, indexKeys(t, s, "nums", "nums_v"))
+		assert.Equal(t, 250, indexKeys(t, s, "nums", "nums_label"))
+
+		expected := [][]string{}
+		for i := range 250 {
+			if v := (i * 7) % 300; i >= 100 && v >= 100 && v < 110 {
+				expected = append(expected, []string{fmt.Sprint(i), fmt.Sprint(v)})
+			}
+		}
+		slices.SortFunc(expected, func(a, b []string) int { return strings.Compare(a[1], b[1]) })
+		assertRows(t, s, `select id, v from nums where v >= 100 and v < 110`, expected)
+		assertRows(t, s, `select id from nums where v = 1007`, [][]string{{"1"}})
+		assertRows(t, s, `select id from nums where label = "short"`, [][]string{{"10"}})
+		assertRows(t, s, `select id from nums where v = 266`, nil)
+
+		_, err := s.Execute(fmt.Sprintf(`insert into nums(id, v, label) VALUES (1, 1, "%s")`, strings.Repeat("x", 2000)))
+		assert.Error(t, err, "key too big for the index")
+		assert.Equal(t, 250, indexKeys(t, s, "nums", "nums_label"))
+	})
+
+	t.Run("unique index", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		_, err := s.Execute(`create unique index users_name on users(name)`)
+		var cErr *ConstraintError
+		if assert.ErrorAs(t, err, &cErr) {
+			assert.Equal(t, UniqueConstraint, cErr.Kind)
+		}
+		assert.Empty(t, s.Schema()["users"].Indexes)
+
+		assert.NoError(t, execute(t, s, `create unique index users_name_age on users(name, age)`))
+		for _, q := range []string{
+			`insert into users(id, name, age, score) VALUES (6, "alice", 20, 0.0)`,
+			`update users set age = 20 where id = 5`,
+		} {
+			_, err := s.Execute(q)
+			if assert.ErrorAs(t, err, &cErr, q) {
+				assert.Equal(t, &ConstraintError{Kind: UniqueConstraint, Table: "users", Column: "name, age"}, cErr)
+			}
+		}
+		assert.NoError(t, execute(t, s, `insert into users(id, name, age, score) VALUES (6, "alice", 21, 0.0)`))
+		assert.NoError(t, execute(t, s, `insert into users(id, name, age, score) VALUES (7, "bob", null, 0.0)`))
+		assertUpdated(t, s, `update users set age = age + 1 where name = "alice"`, 3)
+		assertRows(t, s, `select id, age from users where name = "alice"`, [][]string{{"2", "21"}, {"6", "22"}, {"5", "41"}})
+	})
+
+	t.Run("follows table changes", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assert.NoError(t, execute(t, s, `create index users_name_age on users(name, age)`))
+
+		_, err := s.Execute(`alter table users drop column age`)
+		assert.Error(t, err)
+		assert.NoError(t, execute(t, s, `alter table users drop column score`))
+		assert.NoError(t, execute(t, s, `alter table users add column email string default "x"`))
+		assert.NoError(t, execute(t, s, `alter table users rename column name to login`))
+		assert.NoError(t, execute(t, s, `alter table users rename to people`))
+
+		_, sch, _ := s.storage.findSchemaTuple("users_name_age")
+		assert.Equal(t, "create index users_name_age on people(login, age)", sch.SqlStatement)
+		assertRows(t, s, `select id, email from people where login = "alice" and age >= 20`, [][]string{{"2", "x"}, {"5", "x"}})
+	})
+
+	t.Run("unique keys are looked up in the index", func(t *testing.T) {
+		s := prepareDb(t, []string{`create table users(id int primary key, email string unique, name string, bio string default "")`})
+		for i := range 500 {
+			assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into users(id, email, name, bio) VALUES (%d, "%d@x.com", "user %d", "%s")`, i, i, i, generateBigStr(500))))
+		}
+		assert.NoError(t, execute(t, s, `create unique index users_name on users(name)`))
+
+		var implicit []string
+		for _, idx := range s.Schema()["users"].Indexes {
+			if idx.Implicit {
+				implicit = append(implicit, idx.Name)
+			}
+		}
+		assert.Equal(t, []string{"autoindex_users_id", "autoindex_users_email"}, implicit)
+
+		tablePages := len(s.storage.tableTree(s.Schema()["users"].StartPage).pages())
+		pages := s.storage.pagesRead
+		assert.NoError(t, execute(t, s, `insert into users(id, email, name) VALUES (500, "500@x.com", "x")`))
+		assert.Less(t, s.storage.pagesRead-pages, tablePages/2, "table is not scanned")
+
+		for _, q := range []string{
+			`insert into users(id, email, name) VALUES (250, "new@x.com", "y")`,
+			`insert into users(id, email, name) VALUES (501, "250@x.com", "y")`,
+			`insert into users(id, email, name) VALUES (501, "new@x.com", "user 7")`,
+		} {
+			_, err := s.Execute(q)
+			var cErr *ConstraintError
+			assert.ErrorAs(t, err, &cErr, q)
+		}
+	})
+
+	t.Run("implicit index follows its column", func(t *testing.T) {
+		s := prepareDb(t, []string{
+			`create table users(id int primary key, email string unique, name string)`,
+			`insert into users(id, email, name) VALUES (1, "a@x.com", "alice")`,
+		})
+		_, err := s.Execute(`drop index autoindex_users_id`)
+		assert.Error(t, err)
+		_, err = s.Execute(`create index autoindex_users_name on users(name)`)
+		assert.Error(t, err)
+
+		assert.NoError(t, execute(t, s, `alter table users rename column email to mail`))
+		assert.NoError(t, execute(t, s, `alter table users rename to people`))
+		assert.NoError(t, execute(t, s, `create table users(id int primary key)`))
+		_, sch, _ := s.storage.findSchemaTuple("autoindex_people_mail")
+		assert.Equal(t, "create unique index autoindex_people_mail on people(mail)", sch.SqlStatement)
+
+		assert.NoError(t, execute(t, s, `alter table people drop column mail`))
+		_, _, found := s.storage.findSchemaTuple("autoindex_people_mail")
+		assert.False(t, found)
+		assert.NoError(t, execute(t, s, `insert into people(id, name) VALUES (2, "alice")`))
+		_, err = s.Execute(`insert into people(id, name) VALUES (2, "bob")`)
+		assert.Error(t, err)
+		assertRows(t, s, `select name from people where id = 2`, [][]string{{"alice"}})
+	})
+
+	t.Run("survives dump and load", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assert.NoError(t, execute(t, s, `create unique index users_id on users(id)`))
+		recovered, err := NewDatabaseFromBytes(bytes.NewReader(s.Serialize()))
+		assert.NoError(t, err)
+
+		assert.Equal(t, s.Schema(), recovered.Schema())
+		assertRows(t, recovered, `select name from users where id > 3`, [][]string{{"dave"}, {"alice"}})
+		_, err = recovered.Execute(`insert into users(id, name, age, score) VALUES (1, "x", 1, 1.0)`)
+		assert.Error(t, err)
+	})
+
+	t.Run("encoded values keep their order", func(t *testing.T) {
+		day := func(s string) time.Time { return must(parseDate(s)) }
+		sorted := [][]ColumnData{
+			{{Null, nil}, {Int32, int32(math.MinInt32)}, {Int32, int32(-1)}, {Int32, int32(0)}, {Int32, int32(7)}, {Int32, int32(256)}},
+			{{Null, nil}, {Int64, int64(math.MinInt64)}, {Int64, int64(-300)}, {Int64, int64(2)}, {Int64, int64(math.MaxInt64)}},
+			{{Float, math.Inf(-1)}, {Float, -10.5}, {Float, -0.25}, {Float, 0.0}, {Float, 1e-9}, {Float, 3.0}, {Float, math.Inf(1)}},
+			{{String, ""}, {String, "\x00"}, {String, "\x00a"}, {String, "a"}, {String, "a\x00"}, {String, "ab"}, {String, "b"}},
+			{{Blob, []byte{}}, {Blob, []byte{0, 0}}, {Blob, []byte{1}}, {Blob, []byte{0xff}}},
+			{{Boolean, false}, {Boolean, true}},
+			{{Date, day("1969-12-31")}, {Date, day("1970-01-01")}, {Date, day("2024-02-29")}},
+		}
+		for _, values := range sorted {
+			for i := 1; i < len(values); i++ {
+				a, b := appendIndexValue(nil, values[i-1]), appendIndexValue(nil, values[i])
+				assert.Negative(t, bytes.Compare(a, b), "%v should go before %v", values[i-1], values[i])
+			}
+		}
+		assert.Equal(t, appendIndexValue(nil, ColumnData{Float, math.Copysign(0, -1)}), appendIndexValue(nil, ColumnData{Float, 0.0}))
+	})
+}
+
+func TestPlanner(t *testing.T) {
+	prep := []string{
+		`create table users(id int, name string, age int, bio string)`,
+		`create table orders(id int, user_id int, total float, day date)`,
+		`create index users_age on users(age)`,
+		`insert into users(id, name, age, bio) VALUES (1, "alice", 30, "a")`,
+		`insert into users(id, name, age, bio) VALUES (2, "bob", 20, "b")`,
+		`insert into users(id, name, age, bio) VALUES (3, "carol", 40, "c")`,
+		`insert into orders(id, user_id, total, day) VALUES (10, 3, 5.0, date '2024-01-01')`,
+		`insert into orders(id, user_id, total, day) VALUES (11, 1, 20.0, date '2024-01-02')`,
+		`insert into orders(id, user_id, total, day) VALUES (12, null, 7.5, date '2024-01-03')`,
+		`insert into orders(id, user_id, total, day) VALUES (13, 3, 1.0, date '2024-01-04')`,
+	}
+	assertRows := func(t *testing.T, s *Database, q string, expected [][]string) {
+		t.Helper()
+		res, err := query(t, s, q)
+		assert.NoError(t, err, q)
+		assert.Equal(t, expected, res.Values, q)
+	}
+
+	t.Run("chosen operators", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		testCases := []struct {
+			desc     string
+			query    string
+			expected string
+		}{
+			{
+				"filter pushed to index scan, true constants dropped",
+				`select name from users where age > 25 and 1 = 1`,
+				`project name
+	filter age > 25
+		index scan users(name, age) using users_age`,
+			},
+			{
+				"constants folded",
+				`select id + (1 + 2) from users where id > 2 * 3 and age < -(5 - 10) * 10`,
+				`project id + 3 as id + (1 + 2)
+	filter id > 6 and age < 50
+		index scan users(id, age) using users_age`,
+			},
+			{
+				"false filter reads nothing",
+				`select id from users where id > 1 and 1 = 2`,
+				`project id
+	empty id > 1 and false`,
+			},
+			{
+				"where split between join inputs, equality joined by hash",
+				`select name, total from users join orders on users.id = orders.user_id where total > 6.0 and name != "bob"`,
+				`project name, total
+	hash join inner join on users.id = orders.user_id
+		filter name != "bob"
+			seq scan users(id, name)
+		filter total > 6.0
+			seq scan orders(user_id, total)`,
+			},
+			{
+				"cross join with equality in where",
+				`select users.id from users, orders where orders.user_id = users.id and orders.id > users.age`,
+				`project users.id
+	hash join inner join on users.id = orders.user_id and orders.id > users.age
+		seq scan users(id, age)
+		seq scan orders(id, user_id)`,
+			},
+			{
+				"left join keeps conditions on the right side above it",
+				`select name from users left join orders on users.id = orders.user_id and total > 6.0 where orders.id is null and age < 35`,
+				`project name
+	filter orders.id is null
+		hash join left join on users.id = orders.user_id
+			filter age < 35
+				index scan users(id, name, age) using users_age
+			filter total > 6.0
+				seq scan orders(id, user_id, total)`,
+			},
+			{
+				"float constant",
+				`select id from orders where total < 1.5 * 2`,
+				`project id
+	filter total < 3.0
+		seq scan orders(id, total)`,
+			},
+			{
+				"different types use nested loop",
+				`select name from users join orders on users.id = orders.total`,
+				`project name
+	nested loop inner join on users.id = orders.total
+		seq scan users(id, name)
+		seq scan orders(total)`,
+			},
+			{
+				"aggregate with having",
+				`select user_id, count(*) from orders group by user_id having count(*) > 1 order by user_id limit 5`,
+				`limit 5
+	project user_id, count(*)
+		sort user_id
+			filter count(*) > 1
+				hash aggregate count(*) by user_id
+					seq scan orders(user_id)`,
+			},
+			{
+				"compound select",
+				`select id from users where id = 1 union select user_id from orders order by id desc`,
+				`sort id desc
+	union
+		project id
+			filter id = 1
+				seq scan users(id)
+		project user_id
+			seq scan orders(user_id)`,
+			},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				stmt, err := sql.Parse(sql.Lex(tC.query))
+				assert.NoError(t, err)
+
+				var plan *queryPlan
+				switch stmt := stmt.(type) {
+				case *sql.SelectStatement:
+					plan, err = s.planSelect(*stmt)
+				case *sql.CompoundSelectStatement:
+					plan, err = s.planCompound(*stmt)
+				}
+				if assert.NoError(t, err) {
+					assert.Equal(t, tC.expected, s.physical(plan.node).String())
+				}
+			})
+		}
+	})
+
+	t.Run("results", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		testCases := []struct {
+			query    string
+			expected [][]string
+		}{
+			{`select name, orders.id from users join orders on users.id = orders.user_id`, [][]string{{"alice", "11"}, {"carol", "10"}, {"carol", "13"}}},
+			{`select orders.id, name from orders join users on orders.user_id = users.id`, [][]string{{"10", "carol"}, {"11", "alice"}, {"13", "carol"}}},
+			{`select orders.id, name from orders left join users on users.id = orders.user_id`, [][]string{{"10", "carol"}, {"11", "alice"}, {"12", "<nil>"}, {"13", "carol"}}},
+			{`select name, orders.id from users left join orders on users.id = orders.user_id and total > 2.0`, [][]string{{"alice", "11"}, {"bob", "<nil>"}, {"carol", "10"}}},
+			{`select name from users left join orders on users.id = orders.user_id where orders.id is null`, [][]string{{"bob"}}},
+			{`select name from users join orders on users.id = orders.user_id and 1 = 0`, nil},
+			{`select name, orders.id from users left join orders on 1 = 0 where users.id = 2`, [][]string{{"bob", "<nil>"}}},
+			{`select orders.id from users, orders where orders.user_id = users.id and users.age = 40`, [][]string{{"10"}, {"13"}}},
+			{`select count(*), sum(age) from users where 2 > 1`, [][]string{{"3", "90"}}},
+			{`select id from users where 1 / 0 = 1 and 1 = 2`, nil},
+		}
+		for _, tC := range testCases {
+			assertRows(t, s, tC.query, tC.expected)
+		}
+	})
+
+	t.Run("errors are raised only for rows", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		assertRows(t, s, `select id / 0 from users where id > 5`, nil)
+		assertRows(t, s, `select 1 / 0 from users where id > 5`, nil)
+		_, err := s.Execute(`select 1 / 0 from users`)
+		assert.Error(t, err)
+		_, err = s.Execute(`select id from users where name = "x" and age`)
+		assert.Error(t, err)
+	})
+
+	t.Run("unused columns are not read", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		bio := strings.Repeat("x", 3000)
+		assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into users(id, name, age, bio) VALUES (4, "dave", 50, "%s")`, bio)))
+
+		schema := s.Schema()["users"]
+		for tup := range s.storage.Tuples(schema.StartPage) {
+			row := s.parseColumns(tup, schema, []FieldName{"id", "bio"})
+			assert.Len(t, row, 2)
+			assert.Contains(t, row, FieldName("bio"))
+		}
+		assertRows(t, s, `select bio from users where id = 4`, [][]string{{bio}})
+	})
+}
+
+func TestExplain(t *testing.T) {
+	prep := []string{
+		`create table users(id int, name string, bio string)`,
+		`create table orders(id int, user_id int, total float)`,
+		`insert into users(id, name, bio) VALUES (1, "alice", "a")`,
+		`insert into users(id, name, bio) VALUES (2, "bob", "b")`,
+		`insert into users(id, name, bio) VALUES (3, "carol", "c")`,
+		`insert into orders(id, user_id, total) VALUES (10, 3, 5.0)`,
+		`insert into orders(id, user_id, total) VALUES (11, 1, 20.0)`,
+		`insert into orders(id, user_id, total) VALUES (12, 3, 7.5)`,
+		`insert into orders(id, user_id, total) VALUES (13, 2, 1.0)`,
+	}
+
+	t.Run("explain", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		res, err := query(t, s, `explain select name from users join orders on users.id = orders.user_id where total > 6.0`)
+		assert.NoError(t, err)
+		assert.Equal(t, QueryResult{
+			Header: []FieldName{"plan"},
+			Values: [][]string{
+				{"project name"},
+				{"  hash join inner join on users.id = orders.user_id"},
+				{"    seq scan users(id, name)"},
+				{"    filter total > 6.0"},
+				{"      seq scan orders(user_id, total)"},
+			},
+		}, res)
+	})
+
+	t.Run("analyze counts rows of every operator", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		res, err := query(t, s, `explain analyze select name from users join orders on users.id < orders.user_id order by name limit 2`)
+		assert.NoError(t, err)
+		assert.Equal(t, []FieldName{"plan", "rows", "pages", "time"}, res.Header)
+
+		var plan, rows []string
+		for _, v := range res.Values {
+			plan, rows = append(plan, v[0]), append(rows, v[1])
+			_, err := time.ParseDuration(v[3])
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, []string{
+			"limit 2",
+			"  project name",
+			"    sort name",
+			"      nested loop inner join on users.id < orders.user_id",
+			"        seq scan users(id, name)",
+			"        seq scan orders(user_id)",
+		}, plan)
+		// inner side of the nested loop is scanned once per user
+		assert.Equal(t, []string{"2", "2", "2", "5", "3", "12"}, rows)
+	})
+
+	t.Run("analyze counts pages, overflow pages included", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		bio := strings.Repeat("x", 3*PageSize)
+		assert.NoError(t, execute(t, s, fmt.Sprintf(`insert into users(id, name, bio) VALUES (4, "dave", "%s")`, bio)))
+
+		pages := func(q string) int {
+			t.Helper()
+			res, err := query(t, s, q)
+			assert.NoError(t, err)
+			scan := res.Values[len(res.Values)-1]
+			assert.Contains(t, scan[0], "seq scan users")
+			return must(strconv.Atoi(scan[2]))
+		}
+		withoutBio := pages(`explain analyze select name from users`)
+		assert.Positive(t, withoutBio)
+		assert.GreaterOrEqual(t, pages(`explain analyze select bio from users`), withoutBio+3)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		s := prepareDb(t, prep)
+		for _, q := range []string{
+			`explain select nope from users`,
+			`explain analyze select name from nope`,
+			`explain analyze select 1 / 0 from users`,
+		} {
+			_, err := s.Execute(q)
+			assert.Error(t, err, q)
+		}
+	})
+}
+
+func TestOpen(t *testing.T) {
+	prep := []string{
+		`create table users(id int, name string, bio string)`,
+		`create index users_name on users(name)`,
+		`insert into users(id, name, bio) VALUES (1, "alice", "a")`,
+		fmt.Sprintf(`insert into users(id, name, bio) VALUES (2, "bob", "%s")`, strings.Repeat("b", 3*PageSize)),
+		`insert into users(id, name, bio) VALUES (3, "carol", "c")`,
+	}
+
+	t.Run("changes survive reopening", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		db, err := Open(path)
+		assert.NoError(t, err)
+		for _, stmt := range prep {
+			assert.NoError(t, execute(t, db, stmt))
+		}
+		assert.NoError(t, db.Close())
+
+		reopened, err := Open(path)
+		assert.NoError(t, err)
+		defer reopened.Close()
+		assert.Equal(t, prepareDb(t, prep).Schema(), reopened.Schema())
+		res, err := query(t, reopened, `select id, name from users where name > "a"`)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"1", "alice"}, {"2", "bob"}, {"3", "carol"}}, res.Values)
+
+		assert.NoError(t, execute(t, reopened, `insert into users(id, name, bio) VALUES (4, "dave", "d")`))
+		assertUpdated(t, reopened, `update users set bio = "short" where id = 2`, 1)
+		assertUpdated(t, reopened, `delete from users where id = 1`, 1)
+	})
+
+	t.Run("every statement is written without closing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		db, err := Open(path)
+		assert.NoError(t, err)
+		defer db.Close()
+		for _, stmt := range prep {
+			assert.NoError(t, execute(t, db, stmt))
+		}
+
+		// another process opening the file sees everything
+		other, err := Open(path)
+		assert.NoError(t, err)
+		defer other.Close()
+		assert.Equal(t, db.Serialize(), other.Serialize())
+		assert.Equal(t, prepareDb(t, prep).Serialize(), other.Serialize())
+	})
+
+	t.Run("pages are written through and synced on flush", func(t *testing.T) {
+		f := &recordingFile{}
+		p := &filePager{f: f, synced: true}
+		page := NewPage(TableLeafPageType, PageSize).Serialize()
+		for _, id := range []PageID{2, 0, 1} {
+			assert.NoError(t, p.write(id, page))
+		}
+		assert.NoError(t, p.flush())
+		assert.Equal(t, []string{"write 2", "write 0", "write 1", "sync"}, f.ops)
+		assert.Equal(t, 3, p.size)
+
+		f.ops = nil
+		assert.NoError(t, p.flush())
+		assert.Nil(t, f.ops, "nothing to flush")
+
+		f.fail = true
+		assert.ErrorIs(t, p.write(3, page), io.ErrShortWrite)
+		_, ok := p.read(3)
+		assert.False(t, ok, "failed write doesn't grow the file")
+		assert.Equal(t, 3, p.size)
+
+		f.ops = nil
+		assert.NoError(t, p.truncate(5))
+		assert.NoError(t, p.truncate(1))
+		assert.NoError(t, p.flush())
+		assert.Equal(t, []string{"truncate 1", "sync"}, f.ops)
+		_, ok = p.read(1)
+		assert.False(t, ok)
+	})
+
+	t.Run("invalid files", func(t *testing.T) {
+		dir := t.TempDir()
+		files := map[string][]byte{
+			"not a multiple of page size": make([]byte, PageSize+1),
+			"bad magic number":            make([]byte, PageSize),
+			"truncated":                   NewDatabase().Serialize()[:PageSize],
+		}
+		for name, data := range files {
+			path := filepath.Join(dir, name)
+			assert.NoError(t, os.WriteFile(path, data, 0o644))
+			_, err := Open(path)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+// page file recording writes and syncs
+type recordingFile struct {
+	ops  []string
+	fail bool // writes fail
+}
+
+func (r *recordingFile) ReadAt(b []byte, off int64) (int, error) { return 0, io.EOF }
+func (r *recordingFile) WriteAt(b []byte, off int64) (int, error) {
+	if r.fail {
+		return 0, io.ErrShortWrite
+	}
+	r.ops = append(r.ops, fmt.Sprintf("write %d", off/PageSize))
+	return len(b), nil
+}
+func (r *recordingFile) Truncate(size int64) error {
+	r.ops = append(r.ops, fmt.Sprintf("truncate %d", size/PageSize))
+	return nil
+}
+func (r *recordingFile) Sync() error  { r.ops = append(r.ops, "sync"); return nil }
+func (r *recordingFile) Close() error { return nil }
+
+func TestBufferPool(t *testing.T) {
+	page := func(id PageID) []byte {
+		p := NewPage(TableLeafPageType, PageSize)
+		p.Header.NextPage = id
+		return p.Serialize()
+	}
+	nextPage := func(b *BufferPool, id PageID) PageID {
+		f, ok, err := b.pin(id)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		defer b.unpin(id)
+		return must(DeserializeGenericHeader(bytes.NewBuffer(f.data))).NextPage
+	}
+
+	t.Run("evicted pages are written back", func(t *testing.T) {
+		pages := &memoryPager{}
+		b := newBufferPool(pages, 2)
+		for id := range PageID(5) {
+			b.write(id, page(id+10))
+		}
+		assert.Equal(t, BufferPoolStats{Evictions: 3}, b.Stats())
+		for id := PageID(4); id >= 0; id-- {
+			assert.Equal(t, id+10, nextPage(b, id))
+		}
+		assert.Equal(t, 2, b.Stats().Hits, "last two pages were still cached")
+		assert.Equal(t, 3, b.Stats().Misses)
+
+		_, ok, err := b.pin(100)
+		assert.NoError(t, err)
+		assert.False(t, ok, "missing page")
+	})
+
+	t.Run("clock gives referenced pages a second chance", func(t *testing.T) {
+		b := newBufferPool(&memoryPager{}, 3)
+		for id := range PageID(3) {
+			b.write(id, page(id))
+		}
+		b.write(3, page(3)) // clears all reference bits, evicts page 0
+		nextPage(b, 1)
+		b.write(4, page(4)) // page 1 was used since
+		assert.Contains(t, b.table, PageID(1))
+		assert.NotContains(t, b.table, PageID(2))
+	})
+
+	t.Run("pinned pages stay in the pool", func(t *testing.T) {
+		b := newBufferPool(&memoryPager{}, 2)
+		assert.NoError(t, b.write(1, page(1)))
+		_, _, err := b.pin(1)
+		assert.NoError(t, err)
+		for id := range PageID(5) {
+			assert.NoError(t, b.write(id+2, page(id+2)))
+		}
+		assert.Contains(t, b.table, PageID(1))
+
+		_, _, err = b.pin(6)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, b.write(7, page(7)), errPoolPinned)
+		_, _, err = b.pin(2)
+		assert.ErrorIs(t, err, errPoolPinned)
+
+		b.unpin(1)
+		assert.NoError(t, b.write(7, page(7)))
+		assert.NotContains(t, b.table, PageID(1))
+		assert.Contains(t, b.table, PageID(6))
+	})
+
+	t.Run("generic page is deserialized once", func(t *testing.T) {
+		s := NewStorageEngine()
+		first, _ := s.ReadGenericPage(s.root.SchemaPageStart)
+		second, _ := s.ReadGenericPage(s.root.SchemaPageStart)
+		assert.Same(t, first, second)
+		s.ReleasePage(s.root.SchemaPageStart)
+		s.ReleasePage(s.root.SchemaPageStart)
+
+		changed := first.clone()
+		changed.Header.NextPage = 7
+		s.persistPage(s.root.SchemaPageStart, changed.Serialize())
+		third, _ := s.ReadGenericPage(s.root.SchemaPageStart)
+		defer s.ReleasePage(s.root.SchemaPageStart)
+		assert.True(t, first != third, "written page is deserialized again")
+		assert.Equal(t, PageID(7), third.Header.NextPage)
+	})
+
+	t.Run("statements work with a tiny pool", func(t *testing.T) {
+		prep := []string{
+			`create table users(id int, name string, bio string)`,
+			`create index users_name on users(name)`,
+		}
+		for i := range 200 {
+			prep = append(prep, fmt.Sprintf(`insert into users(id, name, bio) VALUES (%d, "user %d", "%s")`, i, i, strings.Repeat("b", i*30)))
+		}
+
+		tiny := NewDatabaseWithStorage(newStorageEngine(newBufferPool(&memoryPager{}, 3), newMemoryLog()))
+		for _, stmt := range prep {
+			assert.NoError(t, execute(t, tiny, stmt))
+		}
+		assertUpdated(t, tiny, `delete from users where id > 100`, 99)
+		assertUpdated(t, tiny, `update users set bio = "short" where id < 50`, 50)
+
+		expected := prepareDb(t, prep)
+		assertUpdated(t, expected, `delete from users where id > 100`, 99)
+		assertUpdated(t, expected, `update users set bio = "short" where id < 50`, 50)
+		for _, q := range []string{`select * from users`, `select id from users where name > "user 42"`} {
+			want, err := query(t, expected, q)
+			assert.NoError(t, err)
+			got, err := query(t, tiny, q)
+			assert.NoError(t, err)
+			assert.Equal(t, want, got, q)
+		}
+
+		stats := tiny.storage.BufferPoolStats()
+		assert.Greater(t, stats.Evictions, 0)
+		assert.Greater(t, stats.Hits, 0)
+		for _, f := range tiny.storage.pool.frames {
+			assert.Zero(t, f.pins, "page %d is still pinned", f.id)
+		}
+	})
+}
+
+func TestLog(t *testing.T) {
+	t.Run("page changes", func(t *testing.T) {
+		page := func(next PageID, cells ...string) []byte {
+			p := NewPage(TableLeafPageType, PageSize)
+			p.Header.NextPage = next
+			for _, c := range cells {
+				assert.NoError(t, p.AppendCell([]byte(c)))
+			}
+			return p.Serialize()
+		}
+		content := func(data []byte) any {
+			if p, ok := slottedPage(data); ok {
+				return []any{p.Header.PageTyp, p.Header.NextPage, slices.Collect(p.Cells())}
+			}
+			return data
+		}
+		free := NewPage(FreePageType, PageSize)
+		free.Header.NextPage = 9
+		before := page(0, "a", "b", "c", "d")
+
+		testCases := []struct {
+			desc     string
+			after    []byte
+			expected []PageChange
+		}{
+			{"nothing", before, nil},
+			{"insert", page(0, "a", "b", "x", "c", "d"), []PageChange{{Kind: ChangeInsert, Slot: 2, After: []byte("x")}}},
+			{"delete", page(0, "a", "c", "d"), []PageChange{{Kind: ChangeDelete, Slot: 1, Before: []byte("b")}}},
+			{"replace", page(0, "a", "y", "c", "d"), []PageChange{{Kind: ChangeReplace, Slot: 1, Before: []byte("b"), After: []byte("y")}}},
+			{"split", page(0, "a", "b"), []PageChange{
+				{Kind: ChangeDelete, Slot: 2, Before: []byte("c")},
+				{Kind: ChangeDelete, Slot: 2, Before: []byte("d")},
+			}},
+			{"merge", page(0, "a", "b", "c", "d", "e", "f"), []PageChange{
+				{Kind: ChangeInsert, Slot: 4, After: []byte("e")},
+				{Kind: ChangeInsert, Slot: 5, After: []byte("f")},
+			}},
+			{"header and cells", page(5, "x", "b", "c"), []PageChange{
+				{Kind: ChangeHeader, Before: headerImage(GenericPageHeader{PageTyp: TableLeafPageType}), After: headerImage(GenericPageHeader{PageTyp: TableLeafPageType, NextPage: 5})},
+				{Kind: ChangeReplace, Slot: 0, Before: []byte("a"), After: []byte("x")},
+				{Kind: ChangeDelete, Slot: 3, Before: []byte("d")},
+			}},
+			{"page that is not slotted", free.Serialize(), []PageChange{{Kind: ChangeImage, Before: pageImageBytes(before), After: pageImageBytes(free.Serialize())}}},
+		}
+		for _, tC := range testCases {
+			t.Run(tC.desc, func(t *testing.T) {
+				changes := pageChanges(before, tC.after)
+				assert.Equal(t, tC.expected, changes)
+
+				// redo gives the new page, undo the old one
+				redone := applyPageChanges(slices.Clone(before), changes)
+				assert.Equal(t, content(tC.after), content(redone))
+				var inverse []PageChange
+				for _, c := range slices.Backward(changes) {
+					inverse = append(inverse, c.inverse())
+				}
+				assert.Equal(t, content(before), content(applyPageChanges(redone, inverse)))
+			})
+		}
+	})
+
+	t.Run("records survive reopening", func(t *testing.T) {
+		pages := &memoryPager{}
+		l := must(openLog(pages))
+		entries := []LogEntry{
+			{TxID: 1, Kind: LogUpdate, Page: 3, Changes: []PageChange{
+				{Kind: ChangeHeader, Before: []byte{1}, After: []byte{2}},
+				{Kind: ChangeReplace, Slot: 10, Before: []byte{1}, After: []byte{2}},
+			}},
+			// spans several log pages
+			{PrevLSN: 1, TxID: 1, Kind: LogUpdate, Page: 4, Changes: []PageChange{{Kind: ChangeImage, Before: bytes.Repeat([]byte{1}, PageSize), After: bytes.Repeat([]byte{7}, PageSize)}}},
+			{PrevLSN: 2, TxID: 1, Kind: LogCommit},
+		}
+		for i, e := range entries {
+			assert.Equal(t, LSN(i+1), l.Append(e))
+			entries[i].LSN = LSN(i + 1)
+		}
+		assert.NoError(t, l.flush())
+
+		reopened := must(openLog(pages))
+		assert.Equal(t, entries, slices.Collect(reopened.Iterator()))
+		backward := slices.Collect(reopened.Backward())
+		slices.Reverse(backward)
+		assert.Equal(t, entries, backward)
+		assert.Equal(t, LSN(4), reopened.Append(LogEntry{TxID: 2, Kind: LogCommit}))
+
+		// record cut off by a crash is ignored, with everything after it
+		data, _ := pages.read(0)
+		data[len(data)-logPageData+20]++
+		assert.Empty(t, slices.Collect(must(openLog(pages)).Iterator()))
+	})
+
+	t.Run("written records are read back from the pages", func(t *testing.T) {
+		s := NewStorageEngine()
+		first := s.log.lastLsn + 1
+		for i := range 300 {
+			_, err := s.AddTuple(schemaName, SchemaTuple{PageTyp: TableLeafPageType, Name: fmt.Sprint("t", i), SqlStatement: generateBigStr(500)}.ToTuple())
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, len(s.log.stream), logBufferSize+2*PageSize, "log buffer is bounded")
+		}
+		assert.Greater(t, s.log.written, logBufferSize, "records were written during the transaction")
+
+		e, ok := s.log.entry(first)
+		assert.True(t, ok)
+		assert.Equal(t, first, e.LSN)
+		assert.Equal(t, LogUpdate, e.Kind)
+		entries := slices.Collect(s.log.Iterator())
+		for i, e := range entries {
+			assert.Equal(t, s.log.first+LSN(i), e.LSN)
+		}
+		assert.Equal(t, s.log.lastLsn, entries[len(entries)-1].LSN)
+		backward := slices.Collect(s.log.Backward())
+		slices.Reverse(backward)
+		assert.Equal(t, entries, backward)
+
+		assert.NoError(t, s.rollback(0))
+		assert.Equal(t, Schema{schemaName: s.GetSchema()[schemaName]}, s.GetSchema())
+	})
+
+	t.Run("truncated log keeps LSNs growing", func(t *testing.T) {
+		pages := &memoryPager{}
+		l := must(openLog(pages))
+		for range 3 {
+			l.Append(LogEntry{TxID: 1, Kind: LogCommit})
+		}
+		assert.NoError(t, l.flush())
+		assert.NoError(t, l.truncate())
+		assert.Empty(t, slices.Collect(l.Iterator()))
+
+		reopened := must(openLog(pages))
+		assert.Empty(t, slices.Collect(reopened.Iterator()))
+		assert.Equal(t, LSN(4), reopened.Append(LogEntry{TxID: 2, Kind: LogCommit}))
+	})
+
+	t.Run("page is logged before it's changed", func(t *testing.T) {
+		s := NewStorageEngine()
+		before := map[PageID][]byte{}
+		for id := range PageID(s.root.NumberOfPages) {
+			before[id], _ = s.pool.peek(id)
+		}
+		created := s.log.lastLsn
+		_, err := s.AddTuple(schemaName, SchemaTuple{PageTyp: TableLeafPageType, Name: "t", SqlStatement: "create table t(id int)"}.ToTuple())
+		assert.NoError(t, err)
+		s.commit()
+
+		var prev LSN
+		kinds := map[ChangeKind]int{}
+		for e := range s.log.Iterator() {
+			if e.LSN <= created {
+				continue
+			}
+			assert.Equal(t, prev, e.PrevLSN)
+			assert.Equal(t, TxID(2), e.TxID, "schema table was created by the first one")
+			prev = e.LSN
+			if e.Kind == LogCommit {
+				continue
+			}
+
+			for _, c := range e.Changes {
+				kinds[c.Kind]++
+			}
+			// changes applied to the old page give the new one, before images are checked on the way
+			page := applyPageChanges(slices.Clone(before[e.Page]), e.Changes)
+			setPageLSN(e.Page, page, e.LSN)
+			before[e.Page] = page
+		}
+		for id, data := range before {
+			got, _ := s.pool.peek(id)
+			if p, ok := slottedPage(data); ok {
+				gotPage, _ := slottedPage(got)
+				assert.Equal(t, gotPage.Header, p.Header, "page %d", id)
+				assert.Equal(t, slices.Collect(gotPage.Cells()), slices.Collect(p.Cells()), "page %d", id)
+			} else {
+				assert.Equal(t, got, data, "page %d", id)
+			}
+		}
+		assert.Equal(t, map[ChangeKind]int{ChangeInsert: 1}, kinds, "schema tuple is inserted into its slot")
+		last := slices.Collect(s.log.Backward())[0]
+		assert.Equal(t, LogCommit, last.Kind)
+	})
+
+	t.Run("log file is truncated after every statement", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		db, err := Open(path)
+		assert.NoError(t, err)
+		assert.NoError(t, execute(t, db, `create table t(id int)`))
+		assert.NoError(t, execute(t, db, `insert into t(id) VALUES (1)`))
+		assert.Empty(t, slices.Collect(db.storage.log.Iterator()))
+		assert.NoError(t, db.Close())
+
+		wal, err := os.ReadFile(path + "-wal")
+		assert.NoError(t, err)
+		assert.Len(t, wal, PageSize)
+		log := must(openLog(&memoryPager{wal}))
+		assert.Greater(t, log.lastLsn, LSN(4), "records were written before")
+	})
+}
+
+func TestRecovery(t *testing.T) {
+	// process dies, nothing that wasn't flushed reaches the files
+	crash := func(db *Database) {
+		db.storage.pool.pages.(*filePager).f.Close()
+		db.storage.log.pages.(*filePager).f.Close()
+	}
+	open := func(t *testing.T, path string) *Database {
+		t.Helper()
+		db, err := Open(path)
+		assert.NoError(t, err)
+		assert.Empty(t, slices.Collect(db.storage.log.Iterator()), "log is truncated after recovery")
+		return db
+	}
+	ids := func(t *testing.T, db *Database) [][]string {
+		t.Helper()
+		res, err := query(t, db, `select id from users`)
+		assert.NoError(t, err)
+		return res.Values
+	}
+	prepare := func(t *testing.T) (*Database, string) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		db := open(t, path)
+		assert.NoError(t, execute(t, db, `create table users(id int, name string)`))
+		assert.NoError(t, execute(t, db, `create index users_name on users(name)`))
+		assert.NoError(t, execute(t, db, `insert into users(id, name) VALUES (1, "alice")`))
+		return db, path
+	}
+	// statement without commit and flush
+	run := func(t *testing.T, db *Database, stmt string) {
+		t.Helper()
+		_, err := db.execute(must(sql.Parse(sql.Lex(stmt))))
+		assert.NoError(t, err)
+	}
+
+	t.Run("committed changes only in the log are redone", func(t *testing.T) {
+		db, path := prepare(t)
+		for i := range 50 {
+			run(t, db, fmt.Sprintf(`insert into users(id, name) VALUES (%d, "%s")`, i+2, strings.Repeat("x", i*20)))
+		}
+		db.storage.commit()
+		assert.NoError(t, db.storage.log.flush())
+		crash(db)
+
+		db = open(t, path)
+		defer db.Close()
+		assert.Len(t, ids(t, db), 51)
+		res, err := query(t, db, fmt.Sprintf(`select id from users where name = "%s"`, strings.Repeat("x", 60)))
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"5"}}, res.Values)
+	})
+
+	t.Run("uncommitted changes written to the file are undone", func(t *testing.T) {
+		db, path := prepare(t)
+		schema := db.Schema()
+		run(t, db, `create table other(id int)`)
+		run(t, db, `delete from users where id = 1`)
+		for i := range 50 {
+			run(t, db, fmt.Sprintf(`insert into users(id, name) VALUES (%d, "%s")`, i+2, strings.Repeat("x", i*20)))
+		}
+		assert.NoError(t, db.storage.log.flush())
+		assert.NoError(t, db.storage.pool.flush())
+		crash(db)
+
+		db = open(t, path)
+		defer db.Close()
+		assert.Equal(t, [][]string{{"1"}}, ids(t, db))
+		assert.Equal(t, schema, db.Schema())
+		assert.NoError(t, execute(t, db, `insert into users(id, name) VALUES (2, "bob")`))
+		assert.Len(t, ids(t, db), 2)
+	})
+
+	t.Run("pages evicted during a transaction are undone", func(t *testing.T) {
+		db, path := prepare(t)
+		size := must(os.Stat(path)).Size()
+		run(t, db, `create table notes(id int, body string)`)
+		for i := range 2 * defaultPoolFrames {
+			run(t, db, fmt.Sprintf(`insert into notes(id, body) VALUES (%d, "%s")`, i, strings.Repeat("n", PageSize/2)))
+		}
+		assert.Greater(t, db.storage.BufferPoolStats().Evictions, 0)
+		assert.Greater(t, must(os.Stat(path)).Size(), size, "evicted pages are in the file")
+		crash(db)
+
+		db = open(t, path)
+		defer db.Close()
+		assert.NotContains(t, db.Schema(), TableName("notes"))
+		assert.Equal(t, [][]string{{"1"}}, ids(t, db))
+		assert.Equal(t, size, must(os.Stat(path)).Size(), "pages allocated by the transaction are dropped")
+	})
+
+	t.Run("crash during recovery", func(t *testing.T) {
+		db, path := prepare(t)
+		for i := range 20 {
+			run(t, db, fmt.Sprintf(`insert into users(id, name) VALUES (%d, "%s")`, i+2, strings.Repeat("x", i*20)))
+		}
+		assert.NoError(t, db.storage.log.flush())
+		assert.NoError(t, db.storage.pool.flush())
+		crash(db)
+
+		// undo is logged, but pages it changed are lost
+		f := must(os.OpenFile(path, os.O_RDWR, 0))
+		wal := must(os.OpenFile(path+"-wal", os.O_RDWR, 0))
+		s := &StorageEngine{pool: newBufferPool(must(openFilePager(f)), defaultPoolFrames), log: must(openLog(must(openFilePager(wal))))}
+		assert.NoError(t, s.recover())
+		kinds := map[LogKind]int{}
+		for e := range s.log.Iterator() {
+			kinds[e.Kind]++
+		}
+		assert.Equal(t, kinds[LogUpdate], kinds[LogCompensation])
+		assert.Equal(t, 1, kinds[LogAbort])
+		assert.NoError(t, s.log.flush())
+		f.Close()
+		wal.Close()
+
+		db = open(t, path)
+		defer db.Close()
+		assert.Equal(t, [][]string{{"1"}}, ids(t, db))
+	})
+
+	t.Run("redo skips pages that have the change", func(t *testing.T) {
+		db, path := prepare(t)
+		run(t, db, `insert into users(id, name) VALUES (2, "bob")`)
+		db.storage.commit()
+		assert.NoError(t, db.storage.log.flush())
+		assert.NoError(t, db.storage.pool.flush())
+		updates := 0
+		for e := range db.storage.log.Iterator() {
+			if e.Kind == LogUpdate {
+				updates++
+			}
+		}
+		assert.Greater(t, updates, 0)
+		crash(db)
+
+		f := must(os.OpenFile(path, os.O_RDWR, 0))
+		wal := must(os.OpenFile(path+"-wal", os.O_RDWR, 0))
+		s := &StorageEngine{pool: newBufferPool(must(openFilePager(f)), defaultPoolFrames), log: must(openLog(must(openFilePager(wal))))}
+		assert.NoError(t, s.recover())
+		assert.Zero(t, s.pool.Stats().Evictions)
+		for i := range s.pool.frames {
+			assert.False(t, s.pool.frames[i].dirty, "page %d was written again", s.pool.frames[i].id)
+		}
+		f.Close()
+		wal.Close()
+
+		db = open(t, path)
+		defer db.Close()
+		assert.Equal(t, [][]string{{"1"}, {"2"}}, ids(t, db))
+	})
+}
+
+func TestTransactions(t *testing.T) {
+	prepare := func(t *testing.T) (*Database, string) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		db, err := Open(path)
+		assert.NoError(t, err)
+		assert.NoError(t, execute(t, db, `create table users(id int unique, name string)`))
+		assert.NoError(t, execute(t, db, `insert into users(id, name) VALUES (1, "alice")`))
+		return db, path
+	}
+	rows := func(t *testing.T, db *Database) [][]string {
+		t.Helper()
+		res, err := query(t, db, `select id, name from users order by id`)
+		assert.NoError(t, err)
+		return res.Values
+	}
+
+	t.Run("commit", func(t *testing.T) {
+		db, path := prepare(t)
+		assert.NoError(t, execute(t, db, `BEGIN`))
+		assert.NoError(t, execute(t, db, `insert into users(id, name) VALUES (2, "bob")`))
+		assertUpdated(t, db, `update users set name = "carol" where id = 1`, 1)
+		assert.Equal(t, [][]string{{"1", "carol"}, {"2", "bob"}}, rows(t, db), "changes are visible within the transaction")
+		assert.NoError(t, execute(t, db, `commit`))
+		assert.Empty(t, slices.Collect(db.storage.log.Iterator()))
+		assert.NoError(t, db.Close())
+
+		db, err := Open(path)
+		assert.NoError(t, err)
+		defer db.Close()
+		assert.Equal(t, [][]string{{"1", "carol"}, {"2", "bob"}}, rows(t, db))
+	})
+
+	t.Run("rollback undoes every change", func(t *testing.T) {
+		db, _ := prepare(t)
+		defer db.Close()
+		schema, pages := db.Schema(), db.storage.root.NumberOfPages
+
+		assert.NoError(t, execute(t, db, `begin`))
+		for i := range 50 {
+			assert.NoError(t, execute(t, db, fmt.Sprintf(`insert into users(id, name) VALUES (%d, "%s")`, i+2, strings.Repeat("x", i*200))))
+		}
+		assertUpdated(t, db, `update users set name = "carol" where id = 1`, 1)
+		assertUpdated(t, db, `delete from users where id < 10`, 9)
+		assert.NoError(t, execute(t, db, `create table other(id int)`))
+		assert.NoError(t, execute(t, db, `create index users_id on users(id)`))
+		assert.NotEqual(t, schema, db.Schema())
+		assert.NoError(t, execute(t, db, `rollback`))
+
+		assert.Equal(t, [][]string{{"1", "alice"}}, rows(t, db))
+		assert.Equal(t, schema, db.Schema())
+		assert.Equal(t, pages, db.storage.root.NumberOfPages)
+		assert.Empty(t, slices.Collect(db.storage.log.Iterator()))
+		assert.NoError(t, execute(t, db, `insert into users(id, name) VALUES (2, "bob")`))
+		assert.Equal(t, [][]string{{"1", "alice"}, {"2", "bob"}}, rows(t, db))
+	})
+
+	t.Run("failed statement is undone, transaction goes on", func(t *testing.T) {
+		db, _ := prepare(t)
+		defer db.Close()
+		tx, err := db.Begin()
+		assert.NoError(t, err)
+		_, err = tx.Execute(`insert into users(id, name) VALUES (2, "bob")`)
+		assert.NoError(t, err)
+		_, err = tx.Execute(`insert into users(id, name) VALUES (1, "bob")`)
+		assert.Error(t, err)
+
+		// statement failing halfway through
+		savepoint := db.storage.savepoint()
+		for i := range 20 {
+			_, err := db.execute(must(sql.Parse(sql.Lex(fmt.Sprintf(`insert into users(id, name) VALUES (%d, "%s")`, i+3, strings.Repeat("x", i*200))))))
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, db.storage.rollback(savepoint))
+		assert.Equal(t, [][]string{{"1", "alice"}, {"2", "bob"}}, rows(t, db))
+
+		_, err = tx.Execute(`insert into users(id, name) VALUES (3, "carol")`)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+		assert.Equal(t, [][]string{{"1", "alice"}, {"2", "bob"}, {"3", "carol"}}, rows(t, db))
+	})
+
+	t.Run("failed statement outside of transaction leaves nothing behind", func(t *testing.T) {
+		db, _ := prepare(t)
+		defer db.Close()
+		_, err := db.Execute(`insert into users(id, name) VALUES (1, "bob")`)
+		assert.Error(t, err)
+		assert.Equal(t, [][]string{{"1", "alice"}}, rows(t, db))
+		assert.Empty(t, slices.Collect(db.storage.log.Iterator()))
+	})
+
+	t.Run("transaction api", func(t *testing.T) {
+		db, _ := prepare(t)
+		defer db.Close()
+		assert.ErrorIs(t, execute(t, db, `commit`), errNoTransaction)
+		assert.ErrorIs(t, execute(t, db, `rollback`), errNoTransaction)
+
+		tx, err := db.Begin()
+		assert.NoError(t, err)
+		_, err = db.Begin()
+		assert.Error(t, err)
+		assert.Error(t, execute(t, db, `begin`))
+		// statements executed on the database are part of the transaction
+		assert.NoError(t, execute(t, db, `insert into users(id, name) VALUES (2, "bob")`))
+		assert.NoError(t, tx.Rollback())
+		assert.Equal(t, [][]string{{"1", "alice"}}, rows(t, db))
+
+		assert.ErrorIs(t, tx.Commit(), errTxFinished)
+		assert.ErrorIs(t, tx.Rollback(), errTxFinished)
+		_, err = tx.Execute(`select * from users`)
+		assert.ErrorIs(t, err, errTxFinished)
+
+		tx, err = db.Begin()
+		assert.NoError(t, err)
+		_, err = tx.Execute(`commit`)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, tx.Commit(), errTxFinished)
+	})
+
+	t.Run("open transaction is lost on close or crash", func(t *testing.T) {
+		db, path := prepare(t)
+		assert.NoError(t, execute(t, db, `begin`))
+		assert.NoError(t, execute(t, db, `insert into users(id, name) VALUES (2, "bob")`))
+		assert.NoError(t, db.Close())
+
+		db, err := Open(path)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"1", "alice"}}, rows(t, db))
+		assert.NoError(t, execute(t, db, `begin`))
+		for i := range 30 {
+			assert.NoError(t, execute(t, db, fmt.Sprintf(`insert into users(id, name) VALUES (%d, "%s")`, i+2, strings.Repeat("x", i*200))))
+		}
+		// pages of the transaction reach the file, the log isn't truncated
+		assert.NoError(t, db.storage.Flush())
+		assert.NotEmpty(t, slices.Collect(db.storage.log.Iterator()))
+		db.storage.pool.pages.(*filePager).f.Close()
+		db.storage.log.pages.(*filePager).f.Close()
+
+		db, err = Open(path)
+		assert.NoError(t, err)
+		defer db.Close()
+		assert.Equal(t, [][]string{{"1", "alice"}}, rows(t, db))
+	})
+}
@@ -0,0 +1,61 @@
+package naive
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	errNoTransaction = errors.New("no transaction is active")
+	errTxFinished    = errors.New("transaction was already committed or rolled back")
+)
+
+// explicit transaction, its statements are committed or rolled back together.
+// Database runs one transaction at a time, statements executed on the database
+// while it's open are part of it too. Changes are written once it's committed
+type Tx struct {
+	db *Database
+}
+
+// starts a transaction, same as executing begin
+func (d *Database) Begin() (*Tx, error) {
+	if d.tx != nil {
+		return nil, errors.New("transaction is already active")
+	}
+	d.tx = &Tx{db: d}
+	return d.tx, nil
+}
+
+// executes the statement within the transaction, a failed one is undone and the transaction stays open
+func (t *Tx) Execute(sqlStatement string) (any, error) {
+	if t.db.tx != t {
+		return nil, errTxFinished
+	}
+	return t.db.Execute(sqlStatement)
+}
+
+func (t *Tx) Commit() error {
+	if t.db.tx != t {
+		return errTxFinished
+	}
+	t.db.tx = nil
+	t.db.storage.commit()
+	if err := t.db.storage.Flush(); err != nil {
+		return fmt.Errorf("writing changes: %w", err)
+	}
+	return nil
+}
+
+// undoes every change of the transaction
+func (t *Tx) Rollback() error {
+	if t.db.tx != t {
+		return errTxFinished
+	}
+	t.db.tx = nil
+	if err := t.db.storage.rollback(0); err != nil {
+		return fmt.Errorf("rolling back: %w", err)
+	} else if err := t.db.storage.Flush(); err != nil {
+		return fmt.Errorf("writing changes: %w", err)
+	}
+	return nil
+}
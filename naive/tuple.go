@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"simple-db/sql"
 )
 
 type ColumnType int32
@@ -17,8 +18,20 @@ const (
 	// var size
 	StringField   // size 4 + len
 	OverflowField // size 4 + 4 (PageID)
+
+	// added later so stored type ids don't change
+	FloatField        // size 8
+	BigIntField       // size 8
+	DateField         // size 4, days since unix epoch
+	TimestampField    // size 8, microseconds since unix epoch
+	BlobField         // size 4 + len
+	OverflowBlobField // size 4 + 4 (PageID)
 )
 
+func (c ColumnType) isOverflow() bool {
+	return c == OverflowField || c == OverflowBlobField
+}
+
 func ColumnTypeFromInt(i int32) (ColumnType, error) {
 	switch i {
 	case 0:
@@ -31,6 +44,18 @@ func ColumnTypeFromInt(i int32) (ColumnType, error) {
 		return StringField, nil
 	case 4:
 		return OverflowField, nil
+	case 5:
+		return FloatField, nil
+	case 6:
+		return BigIntField, nil
+	case 7:
+		return DateField, nil
+	case 8:
+		return TimestampField, nil
+	case 9:
+		return BlobField, nil
+	case 10:
+		return OverflowBlobField, nil
 	default:
 		return 0, fmt.Errorf("invalid column type: %d", i)
 	}
@@ -95,13 +120,37 @@ func DeserializeTuple(b []byte) (*Tuple, error) {
 						return fmt.Errorf("error deserializing tuple, int column %d/%d: %w", i, t.NumberOfFields, err)
 					}
 					t.ColumnDatas = append(t.ColumnDatas, SerializeInt(v))
+				case FloatField:
+					v, err := ReadFloat(r)
+					if err != nil {
+						return fmt.Errorf("error deserializing tuple, float column %d/%d: %w", i, t.NumberOfFields, err)
+					}
+					t.ColumnDatas = append(t.ColumnDatas, SerializeFloat(v))
+				case BigIntField, TimestampField:
+					v, err := ReadInt64(r)
+					if err != nil {
+						return fmt.Errorf("error deserializing tuple, int64 column %d/%d: %w", i, t.NumberOfFields, err)
+					}
+					t.ColumnDatas = append(t.ColumnDatas, SerializeInt64(v))
+				case DateField:
+					v, err := ReadInt(r)
+					if err != nil {
+						return fmt.Errorf("error deserializing tuple, date column %d/%d: %w", i, t.NumberOfFields, err)
+					}
+					t.ColumnDatas = append(t.ColumnDatas, SerializeInt(v))
+				case BlobField:
+					v, err := ReadBytes(r)
+					if err != nil {
+						return fmt.Errorf("error deserializing tuple, blob column %d/%d: %w", i, t.NumberOfFields, err)
+					}
+					t.ColumnDatas = append(t.ColumnDatas, SerializeBytes(v))
 				case StringField:
 					v, err := ReadString(r)
 					if err != nil {
 						return fmt.Errorf("error deserializing tuple, string column %d/%d: %w", i, t.NumberOfFields, err)
 					}
 					t.ColumnDatas = append(t.ColumnDatas, SerializeString(v))
-				case OverflowField:
+				case OverflowField, OverflowBlobField:
 					ln, err := ReadInt(r)
 					if err != nil {
 						return fmt.Errorf("error deserializing tuple, overflow length column %d/%d: %w", i, t.NumberOfFields, err)
@@ -128,6 +177,30 @@ type SchemaTuple struct {
 	SqlStatement   string // sql stmt used to create this. Will be parsed on boot and cached
 }
 
+func (s SchemaTuple) CreateStatement() (*sql.CreateStatement, error) {
+	got, err := sql.Parse(sql.Lex(s.SqlStatement))
+	if err != nil {
+		return nil, err
+	}
+	createStmt, ok := got.(*sql.CreateStatement)
+	if !ok {
+		return nil, fmt.Errorf("should be create statement, got %T", got)
+	}
+	return createStmt, nil
+}
+
+func (s SchemaTuple) CreateIndexStatement() (*sql.CreateIndexStatement, error) {
+	got, err := sql.Parse(sql.Lex(s.SqlStatement))
+	if err != nil {
+		return nil, err
+	}
+	createStmt, ok := got.(*sql.CreateIndexStatement)
+	if !ok {
+		return nil, fmt.Errorf("should be create index statement, got %T", got)
+	}
+	return createStmt, nil
+}
+
 const SchemaTypleSql = "create table " + schemaName + "(page_type int, starting_page_id int, name string, sql_statement string)"
 
 func (s SchemaTuple) ToTuple() Tuple {
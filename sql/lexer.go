@@ -34,6 +34,51 @@ const (
 	Values
 	Into
 	Null
+	Update
+	Set
+	Delete
+	Drop
+	If
+	Exists
+	Alter
+	Add
+	Column
+	Rename
+	To
+	Inner
+	On
+	Order
+	By
+	Asc
+	Desc
+	Nulls
+	Group
+	Limit
+	Offset
+	Distinct
+	Union
+	All
+	Intersect
+	Except
+	Blob
+	Date
+	Timestamp
+	Is
+	Default
+	Check
+	Primary
+	Key
+	Unique
+	References
+	Foreign
+	Cascade
+	Restrict
+	Index
+	Explain
+	Analyze
+	Begin
+	Commit
+	Rollback
 )
 
 func (t TokenType) String() string {
@@ -63,6 +108,51 @@ func (t TokenType) String() string {
 		"Values",
 		"Into",
 		"Null",
+		"Update",
+		"Set",
+		"Delete",
+		"Drop",
+		"If",
+		"Exists",
+		"Alter",
+		"Add",
+		"Column",
+		"Rename",
+		"To",
+		"Inner",
+		"On",
+		"Order",
+		"By",
+		"Asc",
+		"Desc",
+		"Nulls",
+		"Group",
+		"Limit",
+		"Offset",
+		"Distinct",
+		"Union",
+		"All",
+		"Intersect",
+		"Except",
+		"Blob",
+		"Date",
+		"Timestamp",
+		"Is",
+		"Default",
+		"Check",
+		"Primary",
+		"Key",
+		"Unique",
+		"References",
+		"Foreign",
+		"Cascade",
+		"Restrict",
+		"Index",
+		"Explain",
+		"Analyze",
+		"Begin",
+		"Commit",
+		"Rollback",
 	}[int(t)]
 }
 
@@ -87,27 +177,74 @@ func Lex(in string) []Token {
 		'=': Operator,
 		'(': OpenParen,
 		')': CloseParen,
+		'+': Operator,
+		'-': Operator,
+		'/': Operator,
+		'%': Operator,
 	}
 
 	keyword := map[string]TokenType{
-		"select": Select,
-		"from":   From,
-		"having": Having,
-		"where":  Where,
-		"join":   Join,
-		"left":   Left,
-		"right":  Right,
-		"outer":  Outer,
-		"insert": Insert,
-		"table":  Table,
-		"create": Create,
-		"values": Values,
-		"into":   Into,
-		"null":   Null,
-		"true":   Boolean,
-		"false":  Boolean,
-		"and":    Operator,
-		"or":     Operator,
+		"select":     Select,
+		"from":       From,
+		"having":     Having,
+		"where":      Where,
+		"join":       Join,
+		"left":       Left,
+		"right":      Right,
+		"outer":      Outer,
+		"insert":     Insert,
+		"table":      Table,
+		"create":     Create,
+		"values":     Values,
+		"into":       Into,
+		"null":       Null,
+		"update":     Update,
+		"set":        Set,
+		"delete":     Delete,
+		"drop":       Drop,
+		"if":         If,
+		"exists":     Exists,
+		"alter":      Alter,
+		"add":        Add,
+		"column":     Column,
+		"rename":     Rename,
+		"to":         To,
+		"inner":      Inner,
+		"on":         On,
+		"order":      Order,
+		"by":         By,
+		"asc":        Asc,
+		"desc":       Desc,
+		"nulls":      Nulls,
+		"group":      Group,
+		"limit":      Limit,
+		"offset":     Offset,
+		"distinct":   Distinct,
+		"union":      Union,
+		"all":        All,
+		"intersect":  Intersect,
+		"except":     Except,
+		"is":         Is,
+		"default":    Default,
+		"check":      Check,
+		"primary":    Primary,
+		"key":        Key,
+		"unique":     Unique,
+		"references": References,
+		"foreign":    Foreign,
+		"cascade":    Cascade,
+		"restrict":   Restrict,
+		"index":      Index,
+		"explain":    Explain,
+		"analyze":    Analyze,
+		"begin":      Begin,
+		"commit":     Commit,
+		"rollback":   Rollback,
+		"true":       Boolean,
+		"false":      Boolean,
+		"and":        Operator,
+		"or":         Operator,
+		"not":        Operator,
 	}
 	stringToType := func(w string) TokenType {
 		lower := strings.ToLower(w)
@@ -123,7 +260,7 @@ func Lex(in string) []Token {
 		} else if c == '!' || c == '<' || c == '>' {
 			if next, ok := it.peek(); ok && next == '=' {
 				it.next()
-				out = append(out, emit(Operator, string(c+next), it.line))
+				out = append(out, emit(Operator, string(c)+string(next), it.line))
 			} else {
 				out = append(out, emit(Operator, string(c), it.line))
 			}
@@ -131,11 +268,19 @@ func Lex(in string) []Token {
 			out = append(out, emit(typ, string(c), it.line))
 		} else if unicode.IsDigit(c) {
 			dig := readUntil(c, it, unicode.IsDigit)
+			if next, ok := it.peek(); ok && next == '.' {
+				it.next()
+				dig += readUntil(next, it, unicode.IsDigit)
+			}
 			out = append(out, emit(Number, dig, it.line))
 		} else if c == '"' {
 			word := readUntil(c, it, func(r rune) bool { return r != '"' })
 			it.next() // consume trailing "
 			out = append(out, emit(String, word[1:], it.line))
+		} else if c == '\'' {
+			word := readUntil(c, it, func(r rune) bool { return r != '\'' })
+			it.next() // consume trailing '
+			out = typedLiteral(out, word[1:], it.line)
 		} else {
 			word := readUntil(c, it, func(r rune) bool { return unicode.IsLetter(r) || r == '_' })
 			out = append(out, emit(stringToType(word), word, it.line))
@@ -146,6 +291,23 @@ func Lex(in string) []Token {
 	return out
 }
 
+// single quoted literal is typed by the word in front of it: x'0a' is a blob,
+// date '2024-01-31' and timestamp '2024-01-31 10:00:00' are dates and timestamps.
+// Without a type it's a plain string
+func typedLiteral(out []Token, lexeme string, line int) []Token {
+	literalTypes := map[string]TokenType{
+		"x":         Blob,
+		"date":      Date,
+		"timestamp": Timestamp,
+	}
+	if len(out) > 0 && out[len(out)-1].Typ == Identifier {
+		if typ, ok := literalTypes[strings.ToLower(out[len(out)-1].Lexeme)]; ok {
+			return append(out[:len(out)-1], emit(typ, lexeme, line))
+		}
+	}
+	return append(out, emit(String, lexeme, line))
+}
+
 func readUntil(first rune, si *strIter, fn func(rune) bool) string {
 	out := string(first)
 	for next, ok := si.peek(); ok; next, ok = si.peek() {
@@ -75,6 +75,62 @@ cd`, 2},
 				{EOF, "", 1},
 			},
 		},
+		{
+			desc:  "arithmetic and decimals",
+			input: `a+1.5*-b/2 % 3.`,
+			expected: []Token{
+				{Identifier, "a", 1},
+				{Operator, "+", 1},
+				{Number, "1.5", 1},
+				{Wildcard, "*", 1},
+				{Operator, "-", 1},
+				{Identifier, "b", 1},
+				{Operator, "/", 1},
+				{Number, "2", 1},
+				{Operator, "%", 1},
+				{Number, "3.", 1},
+				{EOF, "", 1},
+			},
+		},
+		{
+			desc:  "two character operators",
+			input: `a != 1 <= 2 >= 3 < 4`,
+			expected: []Token{
+				{Identifier, "a", 1},
+				{Operator, "!=", 1},
+				{Number, "1", 1},
+				{Operator, "<=", 1},
+				{Number, "2", 1},
+				{Operator, ">=", 1},
+				{Number, "3", 1},
+				{Operator, "<", 1},
+				{Number, "4", 1},
+				{EOF, "", 1},
+			},
+		},
+		{
+			desc:  "typed literals",
+			input: `x'0aFF' date '2024-01-31' Timestamp'2024-01-31 10:00:00' 'plain' x`,
+			expected: []Token{
+				{Blob, "0aFF", 1},
+				{Date, "2024-01-31", 1},
+				{Timestamp, "2024-01-31 10:00:00", 1},
+				{String, "plain", 1},
+				{Identifier, "x", 1},
+				{EOF, "", 1},
+			},
+		},
+		{
+			desc:  "not and qualified column",
+			input: `not t.x`,
+			expected: []Token{
+				{Operator, "not", 1},
+				{Identifier, "t", 1},
+				{Dot, ".", 1},
+				{Identifier, "x", 1},
+				{EOF, "", 1},
+			},
+		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
@@ -1,6 +1,10 @@
 package sql
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 func Parse(tokens []Token) (Statement, error) {
 	p := &parser{toks: tokens}
@@ -18,34 +22,146 @@ func (p *parser) parse() (Statement, error) {
 	case Select:
 		return p.parseSelectStatement()
 	case Create:
+		if typ := p.peek().Typ; typ == Index || typ == Unique {
+			return p.parseCreateIndexStatement()
+		}
 		return p.parseCreateStatement()
 	case Insert:
 		return p.parseInsertStatement()
+	case Update:
+		return p.parseUpdateStatement()
+	case Delete:
+		return p.parseDeleteStatement()
+	case Drop:
+		if p.peek().Typ == Index {
+			return p.parseDropIndexStatement()
+		}
+		return p.parseDropStatement()
+	case Alter:
+		return p.parseAlterStatement()
+	case Explain:
+		return p.parseExplainStatement()
+	case Begin:
+		return p.parseTransactionStatement("begin", &BeginStatement{})
+	case Commit:
+		return p.parseTransactionStatement("commit", &CommitStatement{})
+	case Rollback:
+		return p.parseTransactionStatement("rollback", &RollbackStatement{})
 	}
 	return nil, fmt.Errorf("unknown token type: %v", t)
 }
 
+// begin, commit or rollback, there is nothing after the keyword
+func (p *parser) parseTransactionStatement(name string, stmt Statement) (Statement, error) {
+	if t := p.next(); !eof(t) {
+		return nil, fmt.Errorf("%s: unexpected token at the end of statement: %v", name, t)
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseExplainStatement() (*ExplainStatement, error) {
+	out := &ExplainStatement{}
+	if p.peek().Typ == Analyze {
+		p.next()
+		out.Analyze = true
+	}
+	if t := p.next(); t.Typ != Select {
+		return nil, fmt.Errorf("explain: expected select statement, got: %v", t)
+	}
+
+	stmt, err := p.parseSelectStatement()
+	if err != nil {
+		return nil, err
+	}
+	out.Statement = stmt
+	return out, nil
+}
+
 func (p *parser) parseSelectStatement() (Statement, error) {
-	var columns []string
+	first, err := p.parseSelectCore()
+	if err != nil {
+		return nil, err
+	}
+
+	var out Statement = first
+	last := first
+	for {
+		var op SetOperation
+		switch t := p.peek(); t.Typ {
+		case Union:
+			p.next()
+			op = SetUnion
+			if p.peek().Typ == All {
+				p.next()
+				op = SetUnionAll
+			}
+		case Intersect:
+			p.next()
+			op = SetIntersect
+		case Except:
+			p.next()
+			op = SetExcept
+		default:
+			if t := p.next(); !eof(t) {
+				return nil, fmt.Errorf("error parsing Select statement, unexpected token: %v", t)
+			}
+			if compound, ok := out.(*CompoundSelectStatement); ok {
+				// trailing order by and limit belong to the whole compound
+				compound.OrderBy, last.OrderBy = last.OrderBy, nil
+				compound.Limit, last.Limit = last.Limit, nil
+			}
+			return out, nil
+		}
+
+		if last.OrderBy != nil || last.Limit != nil {
+			return nil, fmt.Errorf("error parsing Select statement, order by and limit are allowed only after the last select of compound")
+		}
+		if sel := p.next(); sel.Typ != Select {
+			return nil, fmt.Errorf("error parsing Select statement, expected 'select' after set operation, got %v", sel)
+		}
+		right, err := p.parseSelectCore()
+		if err != nil {
+			return nil, err
+		}
+		out = &CompoundSelectStatement{Left: out, Op: op, Right: right}
+		last = right
+	}
+}
+
+func (p *parser) parseSelectCore() (*SelectStatement, error) {
+	distinct := false
+	if p.peek().Typ == Distinct {
+		p.next()
+		distinct = true
+	}
+
+	var columns []ResultColumn
 	hasWildcard := false
-	for t := p.next(); !eof(t); t = p.next() {
-		next := p.next()
+	if p.peek().Typ == Wildcard {
+		p.next()
+		hasWildcard = true
+	} else {
+		for {
+			expr, err := p.parsePredicate(Lowest)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing Select statement, unknown token when parsing columns: %w", err)
+			}
+			columns = append(columns, ResultColumn{Expr: expr, Name: expr.String()})
 
-		if t.Typ == Identifier && next.Typ == Comma {
-			columns = append(columns, t.Lexeme)
-		} else if t.Typ == Identifier && next.Typ == From {
-			columns = append(columns, t.Lexeme)
-			break
-		} else if t.Typ == Wildcard && next.Typ == From {
-			if len(columns) != 0 {
-				return nil, fmt.Errorf("sql error: found select wildcard and other columns")
+			if p.peek().Typ != Comma {
+				break
 			}
-			hasWildcard = true
-			break
-		} else {
-			return nil, fmt.Errorf("error parsing Select statement, unknown token when parsing columns: %v", t)
+			p.next()
 		}
 	}
+
+	if from := p.next(); from.Typ != From {
+		if from.Typ == Comma && hasWildcard {
+			return nil, fmt.Errorf("sql error: found select wildcard and other columns")
+		}
+		return nil, fmt.Errorf("error parsing Select statement, expected 'from', got %v", from)
+	}
+
 	t := p.next()
 	tableName := ""
 	if t.Typ == Identifier {
@@ -54,6 +170,11 @@ func (p *parser) parseSelectStatement() (Statement, error) {
 		return nil, fmt.Errorf("expected table name, got %v", t)
 	}
 
+	joins, err := p.parseJoins()
+	if err != nil {
+		return nil, err
+	}
+
 	var where *WhereStatement
 	if p.peek().Typ == Where {
 		p.next()
@@ -64,7 +185,194 @@ func (p *parser) parseSelectStatement() (Statement, error) {
 		where = whreSt
 	}
 
-	return &SelectStatement{columns, hasWildcard, tableName, where}, nil
+	var groupBy []Expression
+	if p.peek().Typ == Group {
+		p.next()
+		groupBy, err = p.parseGroupBy()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing group by: %w", err)
+		}
+	}
+
+	var having Expression
+	if p.peek().Typ == Having {
+		p.next()
+		having, err = p.parsePredicate(Lowest)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing having: %w", err)
+		}
+	}
+
+	var orderBy []OrderByClause
+	if p.peek().Typ == Order {
+		p.next()
+		orderBy, err = p.parseOrderBy()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing order by: %w", err)
+		}
+	}
+
+	var limit *LimitClause
+	if p.peek().Typ == Limit {
+		p.next()
+		limit, err = p.parseLimit()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing limit: %w", err)
+		}
+	}
+
+	return &SelectStatement{
+		Columns:     columns,
+		HasWildcard: hasWildcard,
+		Distinct:    distinct,
+		Table:       tableName,
+		Joins:       joins,
+		Where:       where,
+		GroupBy:     groupBy,
+		Having:      having,
+		OrderBy:     orderBy,
+		Limit:       limit,
+	}, nil
+}
+
+func (p *parser) parseLimit() (*LimitClause, error) {
+	nonNegative := func(what string) (int, error) {
+		t := p.next()
+		if t.Typ != Number {
+			return 0, fmt.Errorf("expected number of rows for %v, got %v", what, t)
+		}
+		n, err := strconv.Atoi(t.Lexeme)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %v %q: %w", what, t.Lexeme, err)
+		}
+		return n, nil
+	}
+
+	count, err := nonNegative("limit")
+	if err != nil {
+		return nil, err
+	}
+	out := &LimitClause{Count: count}
+
+	if p.peek().Typ == Offset {
+		p.next()
+		out.Offset, err = nonNegative("offset")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (p *parser) parseGroupBy() ([]Expression, error) {
+	if by := p.next(); by.Typ != By {
+		return nil, fmt.Errorf("expected 'by' after 'group', got %v", by)
+	}
+
+	var out []Expression
+	for {
+		expr, err := p.parsePredicate(Lowest)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, expr)
+
+		if p.peek().Typ != Comma {
+			return out, nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseOrderBy() ([]OrderByClause, error) {
+	if by := p.next(); by.Typ != By {
+		return nil, fmt.Errorf("expected 'by' after 'order', got %v", by)
+	}
+
+	var out []OrderByClause
+	for {
+		expr, err := p.parsePredicate(Lowest)
+		if err != nil {
+			return nil, err
+		}
+		clause := OrderByClause{Expr: expr}
+
+		if t := p.peek(); t.Typ == Asc || t.Typ == Desc {
+			p.next()
+			clause.Desc = t.Typ == Desc
+		}
+
+		if p.peek().Typ == Nulls {
+			p.next()
+			// first and last are not keywords, so they can still be used as column names
+			switch t := p.next(); strings.ToLower(t.Lexeme) {
+			case "first":
+				clause.Nulls = NullsFirst
+			case "last":
+				clause.Nulls = NullsLast
+			default:
+				return nil, fmt.Errorf("expected 'first' or 'last' after 'nulls', got %v", t)
+			}
+		}
+		out = append(out, clause)
+
+		if p.peek().Typ != Comma {
+			return out, nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseJoins() ([]JoinClause, error) {
+	var joins []JoinClause
+	for {
+		var kind JoinKind
+		switch t := p.peek(); t.Typ {
+		case Comma:
+			p.next()
+			kind = CrossJoin
+		case Join:
+			p.next()
+			kind = InnerJoin
+		case Inner:
+			p.next()
+			if j := p.next(); j.Typ != Join {
+				return nil, fmt.Errorf("join: expected 'join' after 'inner', got %v", j)
+			}
+			kind = InnerJoin
+		case Left:
+			p.next()
+			if p.peek().Typ == Outer {
+				p.next()
+			}
+			if j := p.next(); j.Typ != Join {
+				return nil, fmt.Errorf("join: expected 'join' after 'left', got %v", j)
+			}
+			kind = LeftJoin
+		case Right:
+			return nil, fmt.Errorf("join: right join is not supported")
+		default:
+			return joins, nil
+		}
+
+		table := p.next()
+		if table.Typ != Identifier {
+			return nil, fmt.Errorf("join: expected table name, got %v", table)
+		}
+
+		clause := JoinClause{Kind: kind, Table: table.Lexeme}
+		if kind != CrossJoin {
+			if on := p.next(); on.Typ != On {
+				return nil, fmt.Errorf("join: expected 'on' after joined table %q, got %v", table.Lexeme, on)
+			}
+			pred, err := p.parsePredicate(Lowest)
+			if err != nil {
+				return nil, fmt.Errorf("join: error parsing join condition: %w", err)
+			}
+			clause.On = pred
+		}
+		joins = append(joins, clause)
+	}
 }
 
 func (p *parser) parseWhere() (*WhereStatement, error) {
@@ -96,18 +404,94 @@ func (p *parser) parsePredicate(precedence Precedence) (Expression, error) {
 
 func (p *parser) parseSingleExpr() (Expression, error) {
 	t := p.next()
-	if t.Typ == Number || t.Typ == Boolean || t.Typ == String {
+	if isLiteral(t.Typ) {
 		return ValueLiteral{t}, nil
+	} else if t.Typ == Operator && (t.Lexeme == "-" || t.Lexeme == "not") {
+		return p.parsePrefixExpression(t)
+	} else if t.Typ == OpenParen {
+		expr, err := p.parsePredicate(Lowest)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.Typ != CloseParen {
+			return nil, fmt.Errorf("expected ')', got %v", closing)
+		}
+		return expr, nil
+	} else if t.Typ == Identifier && p.peek().Typ == OpenParen {
+		return p.parseFunctionCall(t)
 	} else if t.Typ == Identifier {
+		if p.peek().Typ == Dot {
+			p.next()
+			col := p.next()
+			if col.Typ != Identifier {
+				return nil, fmt.Errorf("expected column name after %q, got %v", t.Lexeme+".", col)
+			}
+			t.Lexeme += "." + col.Lexeme
+		}
 		return ColumnLiteral{t}, nil
+	} else if t.Typ == Null {
+		return NullLiteral{}, nil
 	}
 	return nil, fmt.Errorf("invalid expression token: %v", t)
 }
 
-func (p *parser) parseInfixExpression(left Expression) (*InfixExpression, error) {
+func (p *parser) parseFunctionCall(name Token) (*FunctionCall, error) {
+	p.next() // (
+	call := &FunctionCall{Name: strings.ToLower(name.Lexeme)}
+
+	if p.peek().Typ == Wildcard {
+		p.next()
+		call.Wildcard = true
+	} else if p.peek().Typ != CloseParen {
+		for {
+			arg, err := p.parsePredicate(Lowest)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing arguments of %v: %w", call.Name, err)
+			}
+			call.Args = append(call.Args, arg)
+
+			if p.peek().Typ != Comma {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if closing := p.next(); closing.Typ != CloseParen {
+		return nil, fmt.Errorf("expected ')' after arguments of %v, got %v", call.Name, closing)
+	}
+	return call, nil
+}
+
+func (p *parser) parsePrefixExpression(op Token) (Expression, error) {
+	if op.Lexeme == "-" && p.peek().Typ == Number {
+		// negative literal, so it can be used everywhere a number can
+		num := p.next()
+		return ValueLiteral{Token{Number, "-" + num.Lexeme, num.Line}}, nil
+	}
+
+	// not binds weaker than comparisons: not a = b is not (a = b)
+	precedence := Prefix
+	if op.Lexeme == "not" {
+		precedence = Logical
+	}
+	right, err := p.parsePredicate(precedence)
+	if err != nil {
+		return nil, err
+	}
+	return &PrefixExpression{Operator: op, Right: right}, nil
+}
+
+func (p *parser) parseInfixExpression(left Expression) (Expression, error) {
 	t := p.next()
+	if t.Typ == Is {
+		return p.parseIsNull(left)
+	}
 	// todo: restrict only to infix token types
 	op := t
+	if op.Typ == Wildcard {
+		op = Token{Operator, "*", t.Line}
+	}
 	right, err := p.parsePredicate(precedenceForToken(op))
 	if err != nil {
 		return nil, err
@@ -120,6 +504,19 @@ func (p *parser) parseInfixExpression(left Expression) (*InfixExpression, error)
 	}, nil
 }
 
+// x is null, x is not null
+func (p *parser) parseIsNull(left Expression) (Expression, error) {
+	out := &IsNullExpression{Expr: left}
+	if next := p.peek(); next.Typ == Operator && next.Lexeme == "not" {
+		p.next()
+		out.Not = true
+	}
+	if null := p.next(); null.Typ != Null {
+		return nil, fmt.Errorf("expected 'null' after 'is', got %v", null)
+	}
+	return out, nil
+}
+
 func (p *parser) parseCreateStatement() (*CreateStatement, error) {
 	if next := p.next(); next.Typ != Table {
 		return nil, fmt.Errorf("create table: expected 'table' after 'create' token, got: %v", next)
@@ -134,33 +531,176 @@ func (p *parser) parseCreateStatement() (*CreateStatement, error) {
 		return nil, fmt.Errorf("create table: expected open param after 'create table identifier' tokens, got: %v", open)
 	}
 
-	var columns []ColumnDefinition
-	for t := p.next(); !eof(t); t = p.next() {
-		if t.Typ == CloseParen {
-			return &CreateStatement{Columns: columns, Table: identifier.Lexeme}, nil
+	out := &CreateStatement{Table: identifier.Lexeme}
+	for !eof(p.peek()) {
+		if p.peek().Typ == CloseParen {
+			p.next()
+			return out, nil
 		}
 
-		next := p.next()
-		maybeComma := p.peek()
+		if p.peek().Typ == Foreign {
+			fk, err := p.parseForeignKey()
+			if err != nil {
+				return nil, fmt.Errorf("create table: %w", err)
+			}
+			out.ForeignKeys = append(out.ForeignKeys, fk)
+		} else {
+			col, err := p.parseColumnDefinition()
+			if err != nil {
+				return nil, fmt.Errorf("create table: %w", err)
+			}
+			out.Columns = append(out.Columns, col)
+		}
+
+		if maybeComma := p.peek(); maybeComma.Typ == Comma {
+			p.next()
+		} else if maybeComma.Typ != CloseParen {
+			return nil, fmt.Errorf("create table: unknown token when defining column. Expected comma or close paren, got %v", maybeComma)
+		}
+	}
+	return nil, fmt.Errorf("create table: unexpected od of tokens at the end of column definition")
+}
 
-		if t.Typ == Identifier && next.Typ == Identifier {
-			columns = append(columns, ColumnDefinition{
-				Name: t.Lexeme,
-				Typ:  next.Lexeme,
-			})
+// name, type and optional constraints, like: id int primary key
+func (p *parser) parseColumnDefinition() (ColumnDefinition, error) {
+	name, typ := p.next(), p.next()
+	if name.Typ != Identifier || typ.Typ != Identifier {
+		return ColumnDefinition{}, fmt.Errorf("unknown token when defining column. Expected 2 identifiers, got %v and %v", name, typ)
+	}
+	out := ColumnDefinition{Name: name.Lexeme, Typ: typ.Lexeme}
 
-			if maybeComma.Typ == Comma {
-				p.next()
-			} else if maybeComma.Typ == CloseParen {
-				return &CreateStatement{Columns: columns, Table: identifier.Lexeme}, nil
-			} else {
-				return nil, fmt.Errorf("create table: unknown token when defining column. Expected comma or close paren, got %v", maybeComma)
+	c := &out.Constraints
+	for {
+		t := p.peek()
+		switch {
+		case t.Typ == Operator && t.Lexeme == "not" && !c.NotNull:
+			p.next()
+			if null := p.next(); null.Typ != Null {
+				return out, fmt.Errorf("column %v: expected 'null' after 'not', got %v", name.Lexeme, null)
+			}
+			c.NotNull = true
+		case t.Typ == Primary && !c.PrimaryKey:
+			p.next()
+			if key := p.next(); key.Typ != Key {
+				return out, fmt.Errorf("column %v: expected 'key' after 'primary', got %v", name.Lexeme, key)
+			}
+			c.PrimaryKey = true
+		case t.Typ == Unique && !c.Unique:
+			p.next()
+			c.Unique = true
+		case t.Typ == Default && c.Default == nil:
+			p.next()
+			expr, err := p.parsePredicate(Lowest)
+			if err != nil {
+				return out, fmt.Errorf("column %v: error parsing default: %w", name.Lexeme, err)
+			}
+			c.Default = expr
+		case t.Typ == Check && c.Check == nil:
+			p.next()
+			if open := p.next(); open.Typ != OpenParen {
+				return out, fmt.Errorf("column %v: expected '(' after 'check', got %v", name.Lexeme, open)
+			}
+			expr, err := p.parsePredicate(Lowest)
+			if err != nil {
+				return out, fmt.Errorf("column %v: error parsing check: %w", name.Lexeme, err)
+			}
+			if closing := p.next(); closing.Typ != CloseParen {
+				return out, fmt.Errorf("column %v: expected ')' after check, got %v", name.Lexeme, closing)
+			}
+			c.Check = expr
+		case t.Typ == References && c.References == nil:
+			p.next()
+			fk, err := p.parseReference()
+			if err != nil {
+				return out, fmt.Errorf("column %v: %w", name.Lexeme, err)
+			}
+			c.References = &fk
+		case t.Typ == Comma || t.Typ == CloseParen || eof(t):
+			return out, nil
+		default:
+			return out, fmt.Errorf("column %v: unexpected or repeated constraint %v", name.Lexeme, t)
+		}
+	}
+}
+
+// table level clause: foreign key (column) references parent(column) ...
+func (p *parser) parseForeignKey() (ForeignKey, error) {
+	p.next()
+	if key := p.next(); key.Typ != Key {
+		return ForeignKey{}, fmt.Errorf("expected 'key' after 'foreign', got %v", key)
+	}
+	column, err := p.parseParenIdentifier()
+	if err != nil {
+		return ForeignKey{}, fmt.Errorf("foreign key: %w", err)
+	}
+	if references := p.next(); references.Typ != References {
+		return ForeignKey{}, fmt.Errorf("foreign key: expected 'references' after column, got %v", references)
+	}
+
+	fk, err := p.parseReference()
+	if err != nil {
+		return fk, fmt.Errorf("foreign key (%v): %w", column, err)
+	}
+	fk.Column = column
+	return fk, nil
+}
+
+// parent(column) followed by optional on delete and on update actions, after 'references' token
+func (p *parser) parseReference() (ForeignKey, error) {
+	table := p.next()
+	if table.Typ != Identifier {
+		return ForeignKey{}, fmt.Errorf("expected table name after 'references', got %v", table)
+	}
+	column, err := p.parseParenIdentifier()
+	if err != nil {
+		return ForeignKey{}, fmt.Errorf("references %v: %w", table.Lexeme, err)
+	}
+	out := ForeignKey{RefTable: table.Lexeme, RefColumn: column}
+
+	seen := map[TokenType]bool{}
+	for p.peek().Typ == On {
+		p.next()
+		event := p.next()
+		if event.Typ != Delete && event.Typ != Update {
+			return out, fmt.Errorf("expected 'delete' or 'update' after 'on', got %v", event)
+		} else if seen[event.Typ] {
+			return out, fmt.Errorf("repeated 'on %v' action", event.Lexeme)
+		}
+		seen[event.Typ] = true
+
+		var action ReferentialAction
+		switch t := p.next(); t.Typ {
+		case Restrict:
+			action = ReferenceRestrict
+		case Cascade:
+			action = ReferenceCascade
+		case Set:
+			if null := p.next(); null.Typ != Null {
+				return out, fmt.Errorf("expected 'null' after 'set', got %v", null)
 			}
+			action = ReferenceSetNull
+		default:
+			return out, fmt.Errorf("expected 'restrict', 'cascade' or 'set null' after 'on %v', got %v", event.Lexeme, t)
+		}
+
+		if event.Typ == Delete {
+			out.OnDelete = action
 		} else {
-			return nil, fmt.Errorf("create table: unknown token when defining column. Expected 2 identifiers, got %v and %v", t, next)
+			out.OnUpdate = action
 		}
 	}
-	return nil, fmt.Errorf("create table: unexpected od of tokens at the end of column definition")
+	return out, nil
+}
+
+// single identifier in parens, like: (id). Composite keys are not supported
+func (p *parser) parseParenIdentifier() (string, error) {
+	open, name, closing := p.next(), p.next(), p.next()
+	if open.Typ != OpenParen || name.Typ != Identifier {
+		return "", fmt.Errorf("expected single column in parens, got %v and %v", open, name)
+	} else if closing.Typ != CloseParen {
+		return "", fmt.Errorf("expected ')' after column %v, got %v", name.Lexeme, closing)
+	}
+	return name.Lexeme, nil
 }
 
 func (p *parser) parseInsertStatement() (*InsertStatement, error) {
@@ -200,26 +740,270 @@ func (p *parser) parseInsertStatement() (*InsertStatement, error) {
 	}
 
 	var vals []Expression
-	for t := p.next(); !eof(t); t = p.next() {
-		next := p.next()
-
-		if t.Typ == Identifier || t.Typ == Number || t.Typ == Boolean || t.Typ == String || t.Typ == Null {
-			vals = append(vals, toExpression(t))
-
-			if next.Typ == CloseParen {
-				if len(vals) != len(columns) {
-					return nil, fmt.Errorf("insert table: mismatched number of columns and values: %v, %v", vals, columns)
-				}
-				return &InsertStatement{Columns: columns, Values: vals, Table: identifier.Lexeme}, nil
-			} else if next.Typ != Comma {
-				return nil, fmt.Errorf("insert table: values should be separated by commas, got %v", next)
+	for {
+		val, err := p.parsePredicate(Lowest)
+		if err != nil {
+			return nil, fmt.Errorf("insert table: error parsing value: %w", err)
+		}
+		vals = append(vals, val)
+
+		if next := p.next(); next.Typ == CloseParen {
+			break
+		} else if next.Typ != Comma {
+			return nil, fmt.Errorf("insert table: values should be separated by commas, got %v", next)
+		}
+	}
+
+	if len(vals) != len(columns) {
+		return nil, fmt.Errorf("insert table: mismatched number of columns and values: %v, %v", vals, columns)
+	}
+	return &InsertStatement{Columns: columns, Values: vals, Table: identifier.Lexeme}, nil
+}
+
+func (p *parser) parseUpdateStatement() (*UpdateStatement, error) {
+	identifier := p.next()
+	if identifier.Typ != Identifier {
+		return nil, fmt.Errorf("update table: expected identifier after 'update' token, got: %v", identifier)
+	}
+	if set := p.next(); set.Typ != Set {
+		return nil, fmt.Errorf("update table: expected 'set' after 'update identifier' tokens, got: %v", set)
+	}
+
+	var assignments []Assignment
+	for {
+		col := p.next()
+		if col.Typ != Identifier {
+			return nil, fmt.Errorf("update table: expected column name in assignment, got: %v", col)
+		}
+		if eq := p.next(); eq.Typ != Operator || eq.Lexeme != "=" {
+			return nil, fmt.Errorf("update table: expected '=' after column name %q, got: %v", col.Lexeme, eq)
+		}
+		val, err := p.parsePredicate(Lowest)
+		if err != nil {
+			return nil, fmt.Errorf("update table: error parsing value for column %q: %w", col.Lexeme, err)
+		}
+		assignments = append(assignments, Assignment{Column: col.Lexeme, Value: val})
+
+		if p.peek().Typ != Comma {
+			break
+		}
+		p.next()
+	}
+
+	var where *WhereStatement
+	if p.peek().Typ == Where {
+		p.next()
+		whereSt, err := p.parseWhere()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing where statement: %w", err)
+		}
+		where = whereSt
+	}
+
+	if t := p.next(); !eof(t) {
+		return nil, fmt.Errorf("update table: unexpected token at the end of statement: %v", t)
+	}
+	return &UpdateStatement{Table: identifier.Lexeme, Assignments: assignments, Where: where}, nil
+}
+
+func (p *parser) parseDeleteStatement() (*DeleteStatement, error) {
+	if from := p.next(); from.Typ != From {
+		return nil, fmt.Errorf("delete: expected 'from' after 'delete' token, got: %v", from)
+	}
+
+	identifier := p.next()
+	if identifier.Typ != Identifier {
+		return nil, fmt.Errorf("delete: expected identifier after 'delete from' tokens, got: %v", identifier)
+	}
+
+	var where *WhereStatement
+	if p.peek().Typ == Where {
+		p.next()
+		whereSt, err := p.parseWhere()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing where statement: %w", err)
+		}
+		where = whereSt
+	}
+
+	if t := p.next(); !eof(t) {
+		return nil, fmt.Errorf("delete: unexpected token at the end of statement: %v", t)
+	}
+	return &DeleteStatement{Table: identifier.Lexeme, Where: where}, nil
+}
+
+func (p *parser) parseDropStatement() (*DropTableStatement, error) {
+	if next := p.next(); next.Typ != Table {
+		return nil, fmt.Errorf("drop table: expected 'table' after 'drop' token, got: %v", next)
+	}
+
+	ifExists := false
+	if p.peek().Typ == If {
+		p.next()
+		if exists := p.next(); exists.Typ != Exists {
+			return nil, fmt.Errorf("drop table: expected 'exists' after 'if' token, got: %v", exists)
+		}
+		ifExists = true
+	}
+
+	identifier := p.next()
+	if identifier.Typ != Identifier {
+		return nil, fmt.Errorf("drop table: expected table name, got: %v", identifier)
+	}
+	if t := p.next(); !eof(t) {
+		return nil, fmt.Errorf("drop table: unexpected token at the end of statement: %v", t)
+	}
+	return &DropTableStatement{Table: identifier.Lexeme, IfExists: ifExists}, nil
+}
+
+func (p *parser) parseCreateIndexStatement() (*CreateIndexStatement, error) {
+	out := &CreateIndexStatement{}
+	if p.peek().Typ == Unique {
+		p.next()
+		out.Unique = true
+	}
+	if next := p.next(); next.Typ != Index {
+		return nil, fmt.Errorf("create index: expected 'index' after 'create' token, got: %v", next)
+	}
+
+	name := p.next()
+	if name.Typ != Identifier {
+		return nil, fmt.Errorf("create index: expected index name, got: %v", name)
+	} else if on := p.next(); on.Typ != On {
+		return nil, fmt.Errorf("create index: expected 'on' after index name, got: %v", on)
+	}
+	table := p.next()
+	if table.Typ != Identifier {
+		return nil, fmt.Errorf("create index: expected table name after 'on', got: %v", table)
+	} else if open := p.next(); open.Typ != OpenParen {
+		return nil, fmt.Errorf("create index: expected open paren after table name, got: %v", open)
+	}
+	out.Name, out.Table = name.Lexeme, table.Lexeme
+
+	for {
+		col := p.next()
+		if col.Typ != Identifier {
+			return nil, fmt.Errorf("create index: expected column name, got: %v", col)
+		}
+		out.Columns = append(out.Columns, col.Lexeme)
+
+		if next := p.next(); next.Typ == CloseParen {
+			break
+		} else if next.Typ != Comma {
+			return nil, fmt.Errorf("create index: expected comma or close paren after column, got: %v", next)
+		}
+	}
+	if t := p.next(); !eof(t) {
+		return nil, fmt.Errorf("create index: unexpected token at the end of statement: %v", t)
+	}
+	return out, nil
+}
+
+func (p *parser) parseDropIndexStatement() (*DropIndexStatement, error) {
+	p.next() // index
+
+	ifExists := false
+	if p.peek().Typ == If {
+		p.next()
+		if exists := p.next(); exists.Typ != Exists {
+			return nil, fmt.Errorf("drop index: expected 'exists' after 'if' token, got: %v", exists)
+		}
+		ifExists = true
+	}
+
+	identifier := p.next()
+	if identifier.Typ != Identifier {
+		return nil, fmt.Errorf("drop index: expected index name, got: %v", identifier)
+	}
+	if t := p.next(); !eof(t) {
+		return nil, fmt.Errorf("drop index: unexpected token at the end of statement: %v", t)
+	}
+	return &DropIndexStatement{Name: identifier.Lexeme, IfExists: ifExists}, nil
+}
+
+func (p *parser) parseAlterStatement() (*AlterTableStatement, error) {
+	if next := p.next(); next.Typ != Table {
+		return nil, fmt.Errorf("alter table: expected 'table' after 'alter' token, got: %v", next)
+	}
+	identifier := p.next()
+	if identifier.Typ != Identifier {
+		return nil, fmt.Errorf("alter table: expected table name, got: %v", identifier)
+	}
+	out := &AlterTableStatement{Table: identifier.Lexeme}
+
+	skipColumnKeyword := func() {
+		if p.peek().Typ == Column {
+			p.next()
+		}
+	}
+	expectIdentifier := func(what string) (string, error) {
+		t := p.next()
+		if t.Typ != Identifier {
+			return "", fmt.Errorf("alter table: expected %s, got: %v", what, t)
+		}
+		return t.Lexeme, nil
+	}
+
+	switch action := p.next(); action.Typ {
+	case Add:
+		skipColumnKeyword()
+		col, err := p.parseColumnDefinition()
+		if err != nil {
+			return nil, fmt.Errorf("alter table: %w", err)
+		}
+		out.Action = AddColumn
+		out.Column = col
+	case Drop:
+		skipColumnKeyword()
+		name, err := expectIdentifier("column name")
+		if err != nil {
+			return nil, err
+		}
+		out.Action = DropColumn
+		out.Column = ColumnDefinition{Name: name}
+	case Rename:
+		if p.peek().Typ == To {
+			p.next()
+			name, err := expectIdentifier("new table name")
+			if err != nil {
+				return nil, err
 			}
-		} else {
-			return nil, fmt.Errorf("insert table: unknown token when defining values. Expected identifier, boolean, string, null or number, got %v", t)
+			out.Action = RenameTable
+			out.NewName = name
+			break
+		}
+
+		skipColumnKeyword()
+		name, err := expectIdentifier("column name")
+		if err != nil {
+			return nil, err
+		}
+		if to := p.next(); to.Typ != To {
+			return nil, fmt.Errorf("alter table: expected 'to' after column name, got: %v", to)
+		}
+		newName, err := expectIdentifier("new column name")
+		if err != nil {
+			return nil, err
 		}
+		out.Action = RenameColumn
+		out.Column = ColumnDefinition{Name: name}
+		out.NewName = newName
+	default:
+		return nil, fmt.Errorf("alter table: expected 'add', 'drop' or 'rename', got: %v", action)
 	}
 
-	return nil, fmt.Errorf("insert table: unexpected end of tokens when defining values")
+	if t := p.next(); !eof(t) {
+		return nil, fmt.Errorf("alter table: unexpected token at the end of statement: %v", t)
+	}
+	return out, nil
+}
+
+func isLiteral(t TokenType) bool {
+	switch t {
+	case Number, Boolean, String, Blob, Date, Timestamp:
+		return true
+	}
+	return false
 }
 
 func toExpression(t Token) Expression {
@@ -232,7 +1016,7 @@ func toExpression(t Token) Expression {
 		return ValueLiteral{t}
 	case Boolean:
 		return ValueLiteral{t}
-	case String:
+	case String, Blob, Date, Timestamp:
 		return ValueLiteral{t}
 	}
 	panic(fmt.Sprintf("unsupported type for expression %v", t.Typ))
@@ -272,7 +1056,11 @@ const (
 )
 
 func precedenceForToken(tok Token) Precedence {
-	if tok.Typ != Operator {
+	if tok.Typ == Wildcard {
+		return Product
+	} else if tok.Typ == Is {
+		return Equals
+	} else if tok.Typ != Operator {
 		return Lowest
 	}
 
@@ -283,8 +1071,10 @@ func precedenceForToken(tok Token) Precedence {
 		return LessGreater
 	case "and", "or":
 		return Logical
-	// case "+", "-": return Sum
-	// case Asterisk, Slash: return Product
+	case "+", "-":
+		return Sum
+	case "*", "/", "%":
+		return Product
 	// case LParen: return Call
 	default:
 		return Lowest
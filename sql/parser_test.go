@@ -25,7 +25,11 @@ func TestParser(t *testing.T) {
 			desc:  "select with columns",
 			input: "select a,asdf , bar from foobar",
 			expected: &SelectStatement{
-				Columns:     []string{"a", "asdf", "bar"},
+				Columns: []ResultColumn{
+					{ColumnLiteral{Token{Identifier, "a", 1}}, "a"},
+					{ColumnLiteral{Token{Identifier, "asdf", 1}}, "asdf"},
+					{ColumnLiteral{Token{Identifier, "bar", 1}}, "bar"},
+				},
 				HasWildcard: false,
 				Table:       "foobar",
 			},
@@ -120,20 +124,60 @@ func TestParser(t *testing.T) {
 			)`,
 			expected: &CreateStatement{
 				Columns: []ColumnDefinition{
-					{"abc", "int"},
-					{"foobarz", "varchar"},
-					{"asdf", "boolean"},
+					{Name: "abc", Typ: "int"},
+					{Name: "foobarz", Typ: "varchar"},
+					{Name: "asdf", Typ: "boolean"},
+				},
+				Table: "foobar",
+			},
+		},
+		{
+			desc:  "create with constraints",
+			input: `create table foobar(id int primary key, name string not null unique default "x", age int check (age >= 0) default -1)`,
+			expected: &CreateStatement{
+				Columns: []ColumnDefinition{
+					{Name: "id", Typ: "int", Constraints: ColumnConstraints{PrimaryKey: true}},
+					{Name: "name", Typ: "string", Constraints: ColumnConstraints{
+						NotNull: true,
+						Unique:  true,
+						Default: ValueLiteral{Token{String, "x", 1}},
+					}},
+					{Name: "age", Typ: "int", Constraints: ColumnConstraints{
+						Check: &InfixExpression{
+							Operator: Token{Operator, ">=", 1},
+							Left:     ColumnLiteral{Token{Identifier, "age", 1}},
+							Right:    ValueLiteral{Token{Number, "0", 1}},
+						},
+						Default: ValueLiteral{Token{Number, "-1", 1}},
+					}},
 				},
 				Table: "foobar",
 			},
 		},
+		{
+			desc:  "create with foreign keys",
+			input: `create table orders(id int primary key, user_id int references users(id) on delete cascade, item_id int, foreign key (item_id) references items(id) on update set null on delete restrict)`,
+			expected: &CreateStatement{
+				Columns: []ColumnDefinition{
+					{Name: "id", Typ: "int", Constraints: ColumnConstraints{PrimaryKey: true}},
+					{Name: "user_id", Typ: "int", Constraints: ColumnConstraints{
+						References: &ForeignKey{RefTable: "users", RefColumn: "id", OnDelete: ReferenceCascade},
+					}},
+					{Name: "item_id", Typ: "int"},
+				},
+				Table: "orders",
+				ForeignKeys: []ForeignKey{
+					{Column: "item_id", RefTable: "items", RefColumn: "id", OnUpdate: ReferenceSetNull},
+				},
+			},
+		},
 		{
 			desc:  "create 2",
 			input: `create table foobar(abc int, asdf boolean)`,
 			expected: &CreateStatement{
 				Columns: []ColumnDefinition{
-					{"abc", "int"},
-					{"asdf", "boolean"},
+					{Name: "abc", Typ: "int"},
+					{Name: "asdf", Typ: "boolean"},
 				},
 				Table: "foobar",
 			},
@@ -153,6 +197,498 @@ func TestParser(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc:  "update single column",
+			input: `update foobar set name = "abc"`,
+			expected: &UpdateStatement{
+				Table: "foobar",
+				Assignments: []Assignment{
+					{"name", ValueLiteral{Token{String, "abc", 1}}},
+				},
+			},
+		},
+		{
+			desc:  "update with where",
+			input: `UPDATE foobar SET name = "abc", age = null, id = other WHERE id = 4`,
+			expected: &UpdateStatement{
+				Table: "foobar",
+				Assignments: []Assignment{
+					{"name", ValueLiteral{Token{String, "abc", 1}}},
+					{"age", NullLiteral{}},
+					{"id", ColumnLiteral{Token{Identifier, "other", 1}}},
+				},
+				Where: &WhereStatement{&InfixExpression{
+					Operator: Token{Operator, "=", 1},
+					Left:     ColumnLiteral{Token{Identifier, "id", 1}},
+					Right:    ValueLiteral{Token{Number, "4", 1}},
+				}},
+			},
+		},
+		{
+			desc:     "delete all",
+			input:    `delete from foobar`,
+			expected: &DeleteStatement{Table: "foobar"},
+		},
+		{
+			desc:  "delete with where",
+			input: `DELETE FROM foobar WHERE id = 4`,
+			expected: &DeleteStatement{
+				Table: "foobar",
+				Where: &WhereStatement{&InfixExpression{
+					Operator: Token{Operator, "=", 1},
+					Left:     ColumnLiteral{Token{Identifier, "id", 1}},
+					Right:    ValueLiteral{Token{Number, "4", 1}},
+				}},
+			},
+		},
+		{
+			desc:     "drop table",
+			input:    `drop table foobar`,
+			expected: &DropTableStatement{Table: "foobar"},
+		},
+		{
+			desc:     "drop table if exists",
+			input:    `DROP TABLE IF EXISTS foobar`,
+			expected: &DropTableStatement{Table: "foobar", IfExists: true},
+		},
+		{
+			desc:     "create index",
+			input:    `create index foobar_name on foobar(name)`,
+			expected: &CreateIndexStatement{Name: "foobar_name", Table: "foobar", Columns: []string{"name"}},
+		},
+		{
+			desc:     "create unique index on many columns",
+			input:    `CREATE UNIQUE INDEX foobar_name_age ON foobar(name, age)`,
+			expected: &CreateIndexStatement{Name: "foobar_name_age", Table: "foobar", Columns: []string{"name", "age"}, Unique: true},
+		},
+		{
+			desc:     "drop index",
+			input:    `drop index foobar_name`,
+			expected: &DropIndexStatement{Name: "foobar_name"},
+		},
+		{
+			desc:     "drop index if exists",
+			input:    `drop index if exists foobar_name`,
+			expected: &DropIndexStatement{Name: "foobar_name", IfExists: true},
+		},
+		{
+			desc:     "alter add column",
+			input:    `alter table foobar add column age int`,
+			expected: &AlterTableStatement{Table: "foobar", Action: AddColumn, Column: ColumnDefinition{Name: "age", Typ: "int"}},
+		},
+		{
+			desc:     "alter add without column keyword",
+			input:    `ALTER TABLE foobar ADD age int`,
+			expected: &AlterTableStatement{Table: "foobar", Action: AddColumn, Column: ColumnDefinition{Name: "age", Typ: "int"}},
+		},
+		{
+			desc:     "alter drop column",
+			input:    `alter table foobar drop column age`,
+			expected: &AlterTableStatement{Table: "foobar", Action: DropColumn, Column: ColumnDefinition{Name: "age"}},
+		},
+		{
+			desc:     "alter rename column",
+			input:    `alter table foobar rename column age to years`,
+			expected: &AlterTableStatement{Table: "foobar", Action: RenameColumn, Column: ColumnDefinition{Name: "age"}, NewName: "years"},
+		},
+		{
+			desc:     "alter rename table",
+			input:    `alter table foobar rename to barfoo`,
+			expected: &AlterTableStatement{Table: "foobar", Action: RenameTable, NewName: "barfoo"},
+		},
+		{
+			desc:  "select qualified columns",
+			input: "select foobar.a, b from foobar",
+			expected: &SelectStatement{
+				Columns: []ResultColumn{
+					{ColumnLiteral{Token{Identifier, "foobar.a", 1}}, "foobar.a"},
+					{ColumnLiteral{Token{Identifier, "b", 1}}, "b"},
+				},
+				Table: "foobar",
+			},
+		},
+		{
+			desc:  "inner join",
+			input: "select * from foobar join other on foobar.id = other.foo_id where other.x = 1",
+			expected: &SelectStatement{
+				HasWildcard: true,
+				Table:       "foobar",
+				Joins: []JoinClause{{
+					Kind:  InnerJoin,
+					Table: "other",
+					On: &InfixExpression{
+						Operator: Token{Operator, "=", 1},
+						Left:     ColumnLiteral{Token{Identifier, "foobar.id", 1}},
+						Right:    ColumnLiteral{Token{Identifier, "other.foo_id", 1}},
+					},
+				}},
+				Where: &WhereStatement{&InfixExpression{
+					Operator: Token{Operator, "=", 1},
+					Left:     ColumnLiteral{Token{Identifier, "other.x", 1}},
+					Right:    ValueLiteral{Token{Number, "1", 1}},
+				}},
+			},
+		},
+		{
+			desc:  "left outer, inner and cross joins",
+			input: "select a from foobar left outer join other on a = b inner join third on c = d, fourth",
+			expected: &SelectStatement{
+				Columns: []ResultColumn{{ColumnLiteral{Token{Identifier, "a", 1}}, "a"}},
+				Table:   "foobar",
+				Joins: []JoinClause{
+					{
+						Kind:  LeftJoin,
+						Table: "other",
+						On: &InfixExpression{
+							Operator: Token{Operator, "=", 1},
+							Left:     ColumnLiteral{Token{Identifier, "a", 1}},
+							Right:    ColumnLiteral{Token{Identifier, "b", 1}},
+						},
+					},
+					{
+						Kind:  InnerJoin,
+						Table: "third",
+						On: &InfixExpression{
+							Operator: Token{Operator, "=", 1},
+							Left:     ColumnLiteral{Token{Identifier, "c", 1}},
+							Right:    ColumnLiteral{Token{Identifier, "d", 1}},
+						},
+					},
+					{Kind: CrossJoin, Table: "fourth"},
+				},
+			},
+		},
+		{
+			desc:  "cross join",
+			input: "select * from foobar, other",
+			expected: &SelectStatement{
+				HasWildcard: true,
+				Table:       "foobar",
+				Joins:       []JoinClause{{Kind: CrossJoin, Table: "other"}},
+			},
+		},
+		{
+			desc:  "order by",
+			input: "select * from foobar where a = 1 order by a, b desc, c asc nulls first, d nulls last",
+			expected: &SelectStatement{
+				HasWildcard: true,
+				Table:       "foobar",
+				Where: &WhereStatement{&InfixExpression{
+					Operator: Token{Operator, "=", 1},
+					Left:     ColumnLiteral{Token{Identifier, "a", 1}},
+					Right:    ValueLiteral{Token{Number, "1", 1}},
+				}},
+				OrderBy: []OrderByClause{
+					{Expr: ColumnLiteral{Token{Identifier, "a", 1}}},
+					{Expr: ColumnLiteral{Token{Identifier, "b", 1}}, Desc: true},
+					{Expr: ColumnLiteral{Token{Identifier, "c", 1}}, Nulls: NullsFirst},
+					{Expr: ColumnLiteral{Token{Identifier, "d", 1}}, Nulls: NullsLast},
+				},
+			},
+		},
+		{
+			desc:  "aggregates with group by and having",
+			input: "select dept, count(*), SUM(salary) from emp group by dept having count(*) > 1",
+			expected: &SelectStatement{
+				Columns: []ResultColumn{
+					{ColumnLiteral{Token{Identifier, "dept", 1}}, "dept"},
+					{&FunctionCall{Name: "count", Wildcard: true}, "count(*)"},
+					{&FunctionCall{Name: "sum", Args: []Expression{ColumnLiteral{Token{Identifier, "salary", 1}}}}, "sum(salary)"},
+				},
+				Table:   "emp",
+				GroupBy: []Expression{ColumnLiteral{Token{Identifier, "dept", 1}}},
+				Having: &InfixExpression{
+					Operator: Token{Operator, ">", 1},
+					Left:     &FunctionCall{Name: "count", Wildcard: true},
+					Right:    ValueLiteral{Token{Number, "1", 1}},
+				},
+			},
+		},
+		{
+			desc:  "aggregate without group by",
+			input: "select min(emp.age), max(age) from emp",
+			expected: &SelectStatement{
+				Columns: []ResultColumn{
+					{&FunctionCall{Name: "min", Args: []Expression{ColumnLiteral{Token{Identifier, "emp.age", 1}}}}, "min(emp.age)"},
+					{&FunctionCall{Name: "max", Args: []Expression{ColumnLiteral{Token{Identifier, "age", 1}}}}, "max(age)"},
+				},
+				Table: "emp",
+			},
+		},
+		{
+			desc:  "limit",
+			input: "select * from foobar limit 10",
+			expected: &SelectStatement{
+				HasWildcard: true,
+				Table:       "foobar",
+				Limit:       &LimitClause{Count: 10},
+			},
+		},
+		{
+			desc:  "order by with limit and offset",
+			input: "select * from foobar order by a limit 5 offset 20",
+			expected: &SelectStatement{
+				HasWildcard: true,
+				Table:       "foobar",
+				OrderBy:     []OrderByClause{{Expr: ColumnLiteral{Token{Identifier, "a", 1}}}},
+				Limit:       &LimitClause{Count: 5, Offset: 20},
+			},
+		},
+		{
+			desc:  "select distinct",
+			input: "select distinct a from foobar",
+			expected: &SelectStatement{
+				Columns:  []ResultColumn{{ColumnLiteral{Token{Identifier, "a", 1}}, "a"}},
+				Distinct: true,
+				Table:    "foobar",
+			},
+		},
+		{
+			desc:  "union all",
+			input: "select a from foobar union all select b from other",
+			expected: &CompoundSelectStatement{
+				Left: &SelectStatement{
+					Columns: []ResultColumn{{ColumnLiteral{Token{Identifier, "a", 1}}, "a"}},
+					Table:   "foobar",
+				},
+				Op: SetUnionAll,
+				Right: &SelectStatement{
+					Columns: []ResultColumn{{ColumnLiteral{Token{Identifier, "b", 1}}, "b"}},
+					Table:   "other",
+				},
+			},
+		},
+		{
+			desc:  "explain",
+			input: "explain select a from foobar",
+			expected: &ExplainStatement{Statement: &SelectStatement{
+				Columns: []ResultColumn{{ColumnLiteral{Token{Identifier, "a", 1}}, "a"}},
+				Table:   "foobar",
+			}},
+		},
+		{
+			desc:  "explain analyze compound select",
+			input: "EXPLAIN ANALYZE select a from foobar union all select b from other",
+			expected: &ExplainStatement{Analyze: true, Statement: &CompoundSelectStatement{
+				Left: &SelectStatement{
+					Columns: []ResultColumn{{ColumnLiteral{Token{Identifier, "a", 1}}, "a"}},
+					Table:   "foobar",
+				},
+				Op: SetUnionAll,
+				Right: &SelectStatement{
+					Columns: []ResultColumn{{ColumnLiteral{Token{Identifier, "b", 1}}, "b"}},
+					Table:   "other",
+				},
+			}},
+		},
+		{
+			desc:     "begin",
+			input:    "BEGIN",
+			expected: &BeginStatement{},
+		},
+		{
+			desc:     "commit",
+			input:    "commit",
+			expected: &CommitStatement{},
+		},
+		{
+			desc:     "rollback",
+			input:    "rollback",
+			expected: &RollbackStatement{},
+		},
+		{
+			desc:  "compound is left associative with trailing order by and limit",
+			input: "select * from a union select * from b intersect select * from c except select * from d order by x limit 3",
+			expected: &CompoundSelectStatement{
+				Left: &CompoundSelectStatement{
+					Left: &CompoundSelectStatement{
+						Left:  &SelectStatement{HasWildcard: true, Table: "a"},
+						Op:    SetUnion,
+						Right: &SelectStatement{HasWildcard: true, Table: "b"},
+					},
+					Op:    SetIntersect,
+					Right: &SelectStatement{HasWildcard: true, Table: "c"},
+				},
+				Op:      SetExcept,
+				Right:   &SelectStatement{HasWildcard: true, Table: "d"},
+				OrderBy: []OrderByClause{{Expr: ColumnLiteral{Token{Identifier, "x", 1}}}},
+				Limit:   &LimitClause{Count: 3},
+			},
+		},
+		{
+			desc:  "arithmetic precedence",
+			input: "select a + b * 2 - c % 3 from foobar",
+			expected: &SelectStatement{
+				Columns: []ResultColumn{{
+					&InfixExpression{
+						Operator: Token{Operator, "-", 1},
+						Left: &InfixExpression{
+							Operator: Token{Operator, "+", 1},
+							Left:     ColumnLiteral{Token{Identifier, "a", 1}},
+							Right: &InfixExpression{
+								Operator: Token{Operator, "*", 1},
+								Left:     ColumnLiteral{Token{Identifier, "b", 1}},
+								Right:    ValueLiteral{Token{Number, "2", 1}},
+							},
+						},
+						Right: &InfixExpression{
+							Operator: Token{Operator, "%", 1},
+							Left:     ColumnLiteral{Token{Identifier, "c", 1}},
+							Right:    ValueLiteral{Token{Number, "3", 1}},
+						},
+					},
+					"a + b * 2 - c % 3",
+				}},
+				Table: "foobar",
+			},
+		},
+		{
+			desc:  "parens, unary minus and not",
+			input: "select -(a + 1.5) / -2 from foobar where not a > 1 and b",
+			expected: &SelectStatement{
+				Columns: []ResultColumn{{
+					&InfixExpression{
+						Operator: Token{Operator, "/", 1},
+						Left: &PrefixExpression{
+							Operator: Token{Operator, "-", 1},
+							Right: &InfixExpression{
+								Operator: Token{Operator, "+", 1},
+								Left:     ColumnLiteral{Token{Identifier, "a", 1}},
+								Right:    ValueLiteral{Token{Number, "1.5", 1}},
+							},
+						},
+						Right: ValueLiteral{Token{Number, "-2", 1}},
+					},
+					"-(a + 1.5) / -2",
+				}},
+				Table: "foobar",
+				Where: &WhereStatement{&InfixExpression{
+					Operator: Token{Operator, "and", 1},
+					Left: &PrefixExpression{
+						Operator: Token{Operator, "not", 1},
+						Right: &InfixExpression{
+							Operator: Token{Operator, ">", 1},
+							Left:     ColumnLiteral{Token{Identifier, "a", 1}},
+							Right:    ValueLiteral{Token{Number, "1", 1}},
+						},
+					},
+					Right: ColumnLiteral{Token{Identifier, "b", 1}},
+				}},
+			},
+		},
+		{
+			desc:  "parens keep right operand together",
+			input: "select a - (b - c) from foobar",
+			expected: &SelectStatement{
+				Columns: []ResultColumn{{
+					&InfixExpression{
+						Operator: Token{Operator, "-", 1},
+						Left:     ColumnLiteral{Token{Identifier, "a", 1}},
+						Right: &InfixExpression{
+							Operator: Token{Operator, "-", 1},
+							Left:     ColumnLiteral{Token{Identifier, "b", 1}},
+							Right:    ColumnLiteral{Token{Identifier, "c", 1}},
+						},
+					},
+					"a - (b - c)",
+				}},
+				Table: "foobar",
+			},
+		},
+		{
+			desc:  "insert with expressions",
+			input: `insert into foobar(a, b) values (-1, 2 * 3)`,
+			expected: &InsertStatement{
+				Table:   "foobar",
+				Columns: []string{"a", "b"},
+				Values: []Expression{
+					ValueLiteral{Token{Number, "-1", 1}},
+					&InfixExpression{
+						Operator: Token{Operator, "*", 1},
+						Left:     ValueLiteral{Token{Number, "2", 1}},
+						Right:    ValueLiteral{Token{Number, "3", 1}},
+					},
+				},
+			},
+		},
+		{
+			desc:  "typed literals",
+			input: `select x'cafe' from foobar where d > date '2024-01-31'`,
+			expected: &SelectStatement{
+				Columns: []ResultColumn{{ValueLiteral{Token{Blob, "cafe", 1}}, "x'cafe'"}},
+				Table:   "foobar",
+				Where: &WhereStatement{&InfixExpression{
+					Operator: Token{Operator, ">", 1},
+					Left:     ColumnLiteral{Token{Identifier, "d", 1}},
+					Right:    ValueLiteral{Token{Date, "2024-01-31", 1}},
+				}},
+			},
+		},
+		{
+			desc:  "is null and is not null",
+			input: `select coalesce(a, 0) from foobar where not a is null and b + 1 is not null`,
+			expected: &SelectStatement{
+				Columns: []ResultColumn{{&FunctionCall{
+					Name: "coalesce",
+					Args: []Expression{ColumnLiteral{Token{Identifier, "a", 1}}, ValueLiteral{Token{Number, "0", 1}}},
+				}, "coalesce(a, 0)"}},
+				Table: "foobar",
+				Where: &WhereStatement{&InfixExpression{
+					Operator: Token{Operator, "and", 1},
+					Left: &PrefixExpression{
+						Operator: Token{Operator, "not", 1},
+						Right:    &IsNullExpression{Expr: ColumnLiteral{Token{Identifier, "a", 1}}},
+					},
+					Right: &IsNullExpression{
+						Expr: &InfixExpression{
+							Operator: Token{Operator, "+", 1},
+							Left:     ColumnLiteral{Token{Identifier, "b", 1}},
+							Right:    ValueLiteral{Token{Number, "1", 1}},
+						},
+						Not: true,
+					},
+				}},
+			},
+		},
+		{
+			desc:  "is null binds weaker than comparison",
+			input: `select (a = b) is null, a = (b is null) from foobar`,
+			expected: &SelectStatement{
+				Columns: []ResultColumn{
+					{&IsNullExpression{Expr: &InfixExpression{
+						Operator: Token{Operator, "=", 1},
+						Left:     ColumnLiteral{Token{Identifier, "a", 1}},
+						Right:    ColumnLiteral{Token{Identifier, "b", 1}},
+					}}, "(a = b) is null"},
+					{&InfixExpression{
+						Operator: Token{Operator, "=", 1},
+						Left:     ColumnLiteral{Token{Identifier, "a", 1}},
+						Right:    &IsNullExpression{Expr: ColumnLiteral{Token{Identifier, "b", 1}}},
+					}, "a = (b is null)"},
+				},
+				Table: "foobar",
+			},
+		},
+		{
+			desc:  "order by qualified column",
+			input: "select a from foobar join other on a = b order by other.x desc",
+			expected: &SelectStatement{
+				Columns: []ResultColumn{{ColumnLiteral{Token{Identifier, "a", 1}}, "a"}},
+				Table:   "foobar",
+				Joins: []JoinClause{{
+					Kind:  InnerJoin,
+					Table: "other",
+					On: &InfixExpression{
+						Operator: Token{Operator, "=", 1},
+						Left:     ColumnLiteral{Token{Identifier, "a", 1}},
+						Right:    ColumnLiteral{Token{Identifier, "b", 1}},
+					},
+				}},
+				OrderBy: []OrderByClause{
+					{Expr: ColumnLiteral{Token{Identifier, "other.x", 1}}, Desc: true},
+				},
+			},
+		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
@@ -162,3 +698,88 @@ func TestParser(t *testing.T) {
 		})
 	}
 }
+
+func TestParserErrors(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		input string
+	}{
+		{"update without set", `update foobar name = 1`},
+		{"update without value", `update foobar set name =`},
+		{"update trailing tokens", `update foobar set name = 1 foo`},
+		{"delete without from", `delete foobar`},
+		{"delete without table", `delete from where id = 1`},
+		{"drop without table keyword", `drop foobar`},
+		{"drop if without exists", `drop table if foobar`},
+		{"alter unknown action", `alter table foobar modify age int`},
+		{"select wildcard and columns", `select *, a from foobar`},
+		{"join without on", `select * from foobar join other`},
+		{"right join", `select * from foobar right join other on a = b`},
+		{"select trailing tokens", `select * from foobar other`},
+		{"order without by", `select * from foobar order a`},
+		{"order by invalid nulls", `select * from foobar order by a nulls middle`},
+		{"alter add without type", `alter table foobar add column age`},
+		{"group without by", `select a from foobar group a`},
+		{"unclosed function call", `select count(a from foobar`},
+		{"having without predicate", `select a from foobar group by a having`},
+		{"limit without count", `select a from foobar limit`},
+		{"limit with column", `select a from foobar limit a`},
+		{"offset without count", `select a from foobar limit 1 offset`},
+		{"offset before limit", `select a from foobar offset 1 limit 1`},
+		{"union without select", `select a from foobar union b`},
+		{"order by before union", `select a from foobar order by a union select a from other`},
+		{"limit before except", `select a from foobar limit 1 except select a from other`},
+		{"intersect all", `select a from foobar intersect all select a from other`},
+		{"unclosed paren", `select (a + 1 from foobar`},
+		{"dangling operator", `select a + from foobar`},
+		{"insert dangling operator", `insert into foobar(a) values (1 +)`},
+		{"alter rename column without to", `alter table foobar rename column age years`},
+		{"is without null", `select a from foobar where a is 1`},
+		{"is not without null", `select a from foobar where a is not`},
+		{"not without null", `create table foobar(a int not)`},
+		{"primary without key", `create table foobar(a int primary)`},
+		{"repeated constraint", `create table foobar(a int unique unique)`},
+		{"check without parens", `create table foobar(a int check a > 0)`},
+		{"default without value", `create table foobar(a int default)`},
+		{"references without column", `create table foobar(a int references users)`},
+		{"composite foreign key", `create table foobar(a int, b int, foreign key (a, b) references users(id, x))`},
+		{"foreign key without references", `create table foobar(a int, foreign key (a) users(id))`},
+		{"unknown referential action", `create table foobar(a int references users(id) on delete nothing)`},
+		{"set without null", `create table foobar(a int references users(id) on update set)`},
+		{"repeated referential action", `create table foobar(a int references users(id) on delete cascade on delete restrict)`},
+		{"index without on", `create index foobar_name foobar(name)`},
+		{"index without columns", `create index foobar_name on foobar()`},
+		{"index trailing comma", `create index foobar_name on foobar(name,)`},
+		{"unique without index", `create unique foobar_name on foobar(name)`},
+		{"drop index without name", `drop index`},
+		{"explain without statement", `explain`},
+		{"explain insert", `explain insert into foobar(a) values (1)`},
+		{"explain analyze twice", `explain analyze analyze select a from foobar`},
+		{"begin trailing tokens", `begin foobar`},
+		{"commit trailing tokens", `commit work now`},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := Parse(Lex(tC.input))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCreateStatementString(t *testing.T) {
+	inputs := []string{
+		`create table foobar(id int primary key, name string unique not null default "x", age int default -1 check (age >= 0 and age < 200))`,
+		`create table foobar(id int, parent int references foobar(id) on delete set null on update cascade, owner int, foreign key (owner) references users(id))`,
+	}
+	for _, input := range inputs {
+		stmt, err := Parse(Lex(input))
+		assert.NoError(t, err)
+		assert.Equal(t, input, stmt.(*CreateStatement).String())
+	}
+
+	for _, input := range []string{`create index foobar_name on foobar(name)`, `create unique index foobar_name on foobar(name, age)`} {
+		stmt, err := Parse(Lex(input))
+		assert.NoError(t, err)
+		assert.Equal(t, input, stmt.(*CreateIndexStatement).String())
+	}
+}
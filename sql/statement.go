@@ -1,6 +1,9 @@
 package sql
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 type Statement interface {
 	statementTag()
@@ -11,14 +14,101 @@ type WhereStatement struct {
 }
 
 type SelectStatement struct {
-	Columns     []string
+	Columns     []ResultColumn
 	HasWildcard bool
+	Distinct    bool
 	Table       string
+	Joins       []JoinClause
 	Where       *WhereStatement
+	GroupBy     []Expression
+	Having      Expression
+	OrderBy     []OrderByClause
+	Limit       *LimitClause
+}
+
+type LimitClause struct {
+	Count  int
+	Offset int
+}
+
+// expression from the select list, name is used as a header of the result
+type ResultColumn struct {
+	Expr Expression
+	Name string
+}
+
+type NullsOrder int
+
+const (
+	NullsDefault NullsOrder = iota // nulls are bigger than any value
+	NullsFirst
+	NullsLast
+)
+
+type OrderByClause struct {
+	Expr  Expression
+	Desc  bool
+	Nulls NullsOrder
+}
+
+type JoinKind int
+
+const (
+	InnerJoin JoinKind = iota
+	LeftJoin
+	CrossJoin
+)
+
+type JoinClause struct {
+	Kind  JoinKind
+	Table string
+	On    Expression // nil for cross joins
 }
 
 func (*SelectStatement) statementTag() {}
 
+type SetOperation int
+
+const (
+	SetUnion SetOperation = iota
+	SetUnionAll
+	SetIntersect
+	SetExcept
+)
+
+// two queries combined with a set operation. Compound statements are evaluated
+// left to right, order by and limit apply to the whole result
+type CompoundSelectStatement struct {
+	Left    Statement // *SelectStatement or nested *CompoundSelectStatement
+	Op      SetOperation
+	Right   *SelectStatement
+	OrderBy []OrderByClause
+	Limit   *LimitClause
+}
+
+func (*CompoundSelectStatement) statementTag() {}
+
+// plan of the select, with per operator statistics of running it when analyzed
+type ExplainStatement struct {
+	Analyze   bool
+	Statement Statement // *SelectStatement or *CompoundSelectStatement
+}
+
+func (*ExplainStatement) statementTag() {}
+
+// starts a transaction, statements until commit or rollback are applied together
+type BeginStatement struct{}
+
+func (*BeginStatement) statementTag() {}
+
+type CommitStatement struct{}
+
+func (*CommitStatement) statementTag() {}
+
+type RollbackStatement struct{}
+
+func (*RollbackStatement) statementTag() {}
+
 type InsertStatement struct {
 	Columns []string
 	Values  []Expression
@@ -28,27 +118,171 @@ type InsertStatement struct {
 func (*InsertStatement) statementTag() {}
 
 type CreateStatement struct {
-	Columns []ColumnDefinition
-	Table   string
+	Columns     []ColumnDefinition
+	Table       string
+	ForeignKeys []ForeignKey // table level foreign key clauses
 }
 
 func (c CreateStatement) String() string {
 	cols := []string{}
 	for _, col := range c.Columns {
-		cols = append(cols, col.Name+" "+col.Typ)
+		cols = append(cols, col.String())
+	}
+	for _, fk := range c.ForeignKeys {
+		cols = append(cols, fk.String())
 	}
 	return "create table " + c.Table + "(" + strings.Join(cols, ", ") + ")"
 }
 
 type ColumnDefinition struct {
-	Name string
-	Typ  string
+	Name        string
+	Typ         string
+	Constraints ColumnConstraints
+}
+
+func (c ColumnDefinition) String() string {
+	out := c.Name + " " + c.Typ
+	if c.Constraints.PrimaryKey {
+		out += " primary key"
+	}
+	if c.Constraints.Unique {
+		out += " unique"
+	}
+	if c.Constraints.NotNull {
+		out += " not null"
+	}
+	if c.Constraints.Default != nil {
+		out += " default " + c.Constraints.Default.String()
+	}
+	if c.Constraints.Check != nil {
+		out += " check (" + c.Constraints.Check.String() + ")"
+	}
+	if c.Constraints.References != nil {
+		out += " " + c.Constraints.References.String()
+	}
+	return out
+}
+
+type ColumnConstraints struct {
+	NotNull    bool
+	PrimaryKey bool
+	Unique     bool
+	Default    Expression  // nil when there is no default
+	Check      Expression  // nil when there is no check
+	References *ForeignKey // nil when column doesn't reference other table
+}
+
+// column referencing a unique column of the parent table.
+// Column is empty when the reference is defined on the column itself
+type ForeignKey struct {
+	Column    string
+	RefTable  string
+	RefColumn string
+	OnDelete  ReferentialAction
+	OnUpdate  ReferentialAction
+}
+
+func (f ForeignKey) String() string {
+	out := "references " + f.RefTable + "(" + f.RefColumn + ")"
+	if f.OnDelete != ReferenceRestrict {
+		out += " on delete " + f.OnDelete.String()
+	}
+	if f.OnUpdate != ReferenceRestrict {
+		out += " on update " + f.OnUpdate.String()
+	}
+	if f.Column != "" {
+		out = "foreign key (" + f.Column + ") " + out
+	}
+	return out
+}
+
+// what happens to referencing rows when the parent row is deleted or its key is updated
+type ReferentialAction int
+
+const (
+	ReferenceRestrict ReferentialAction = iota
+	ReferenceCascade
+	ReferenceSetNull
+)
+
+func (a ReferentialAction) String() string {
+	return [...]string{"restrict", "cascade", "set null"}[a]
 }
 
 func (*CreateStatement) statementTag() {}
 
+type UpdateStatement struct {
+	Table       string
+	Assignments []Assignment
+	Where       *WhereStatement
+}
+
+type Assignment struct {
+	Column string
+	Value  Expression
+}
+
+func (*UpdateStatement) statementTag() {}
+
+type DeleteStatement struct {
+	Table string
+	Where *WhereStatement
+}
+
+func (*DeleteStatement) statementTag() {}
+
+type DropTableStatement struct {
+	Table    string
+	IfExists bool
+}
+
+func (*DropTableStatement) statementTag() {}
+
+type CreateIndexStatement struct {
+	Name    string
+	Table   string
+	Columns []string
+	Unique  bool
+}
+
+func (c CreateIndexStatement) String() string {
+	out := "create index "
+	if c.Unique {
+		out = "create unique index "
+	}
+	return out + c.Name + " on " + c.Table + "(" + strings.Join(c.Columns, ", ") + ")"
+}
+
+func (*CreateIndexStatement) statementTag() {}
+
+type DropIndexStatement struct {
+	Name     string
+	IfExists bool
+}
+
+func (*DropIndexStatement) statementTag() {}
+
+type AlterAction int
+
+const (
+	AddColumn AlterAction = iota
+	DropColumn
+	RenameColumn
+	RenameTable
+)
+
+type AlterTableStatement struct {
+	Table   string
+	Action  AlterAction
+	Column  ColumnDefinition // added column, or just the name of dropped/renamed one
+	NewName string           // new name of the column or the table
+}
+
+func (*AlterTableStatement) statementTag() {}
+
 type Expression interface {
 	expressionTag()
+	String() string
 }
 
 type InfixExpression struct {
@@ -59,18 +293,128 @@ type InfixExpression struct {
 
 func (*InfixExpression) expressionTag() {}
 
+func (i *InfixExpression) String() string {
+	precedence := precedenceForToken(i.Operator)
+	left, right := i.Left.String(), i.Right.String()
+	if l, ok := bindingPower(i.Left); ok && l < precedence {
+		left = "(" + left + ")"
+	}
+	// operators are left associative, so equal precedence on the right needs parens too
+	if r, ok := bindingPower(i.Right); ok && r <= precedence {
+		right = "(" + right + ")"
+	}
+	return left + " " + i.Operator.Lexeme + " " + right
+}
+
+// precedence of expressions that may need parens when nested
+func bindingPower(e Expression) (Precedence, bool) {
+	switch v := e.(type) {
+	case *InfixExpression:
+		return precedenceForToken(v.Operator), true
+	case *IsNullExpression:
+		return Equals, true
+	}
+	return 0, false
+}
+
+// unary minus or not
+type PrefixExpression struct {
+	Operator Token
+	Right    Expression
+}
+
+func (*PrefixExpression) expressionTag() {}
+
+func (p *PrefixExpression) String() string {
+	right := p.Right.String()
+	if r, ok := p.Right.(*InfixExpression); ok && (p.Operator.Lexeme == "-" || precedenceForToken(r.Operator) <= Logical) {
+		right = "(" + right + ")"
+	}
+	if p.Operator.Lexeme == "not" {
+		return "not " + right
+	}
+	return p.Operator.Lexeme + right
+}
+
+type IsNullExpression struct {
+	Expr Expression
+	Not  bool
+}
+
+func (*IsNullExpression) expressionTag() {}
+
+func (i *IsNullExpression) String() string {
+	expr := i.Expr.String()
+	if p, ok := bindingPower(i.Expr); ok && p <= Equals {
+		expr = "(" + expr + ")"
+	}
+	if i.Not {
+		return expr + " is not null"
+	}
+	return expr + " is null"
+}
+
 type ValueLiteral struct {
 	Tok Token
 }
 
 func (ValueLiteral) expressionTag() {}
 
+func (v ValueLiteral) String() string {
+	switch v.Tok.Typ {
+	case String:
+		return fmt.Sprintf("%q", v.Tok.Lexeme)
+	case Blob:
+		return "x'" + v.Tok.Lexeme + "'"
+	case Date:
+		return "date '" + v.Tok.Lexeme + "'"
+	case Timestamp:
+		return "timestamp '" + v.Tok.Lexeme + "'"
+	}
+	return v.Tok.Lexeme
+}
+
 type NullLiteral struct{}
 
 func (NullLiteral) expressionTag() {}
 
+func (NullLiteral) String() string { return "null" }
+
+// value computed before the query runs, e.g. a folded constant expression.
+// Value is owned by the engine that evaluates expressions
+type ConstantLiteral struct {
+	Value any
+	Text  string
+}
+
+func (ConstantLiteral) expressionTag() {}
+
+func (c ConstantLiteral) String() string { return c.Text }
+
 type ColumnLiteral struct {
 	Name Token
 }
 
 func (ColumnLiteral) expressionTag() {}
+
+func (c ColumnLiteral) String() string { return c.Name.Lexeme }
+
+// function call like count(*) or sum(col), name is lowercase
+type FunctionCall struct {
+	Name     string
+	Args     []Expression
+	Wildcard bool // count(*)
+}
+
+func (*FunctionCall) expressionTag() {}
+
+func (f *FunctionCall) String() string {
+	if f.Wildcard {
+		return f.Name + "(*)"
+	}
+	args := []string{}
+	for _, a := range f.Args {
+		args = append(args, a.String())
+	}
+	return f.Name + "(" + strings.Join(args, ", ") + ")"
+}